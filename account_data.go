@@ -0,0 +1,613 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Players can download everything the server keeps about them and can delete
+// their account. Deletion is scheduled ACCOUNT_DELETION_GRACE_DAYS ahead and
+// can be cancelled until then; the leader then purges the account. Season
+// results are not deleted but re-keyed to a fresh anonymous player ID, so
+// final rankings keep every rank and tier while no longer pointing at the
+// person. Requests, cancellations and completions are recorded only in
+// account_deletions, which holds no username or IP; they are the player's own
+// actions, not admin ones, so they stay out of the admin audit log.
+const (
+	AccountDeletionScheduled = "scheduled"
+	AccountDeletionCancelled = "cancelled"
+	AccountDeletionCompleted = "completed"
+
+	accountDeletionInterval = 10 * time.Minute
+)
+
+func accountDeletionGrace() time.Duration {
+	days := parseEnvInt("ACCOUNT_DELETION_GRACE_DAYS", 14)
+	if days < 0 {
+		days = 0
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+type AccountDeleteRequest struct {
+	Password     string `json:"password"`
+	TOTPCode     string `json:"totpCode,omitempty"`
+	RecoveryCode string `json:"recoveryCode,omitempty"`
+}
+
+type AccountDeletionResponse struct {
+	OK           bool   `json:"ok"`
+	Error        string `json:"error,omitempty"`
+	Scheduled    bool   `json:"scheduled"`
+	ScheduledFor string `json:"scheduledFor,omitempty"`
+}
+
+// exportRows runs query and returns each row as a column -> value map.
+// JSONB columns are embedded as JSON rather than as strings.
+func exportRows(db *sql.DB, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	out := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			value := values[i]
+			if raw, ok := value.([]byte); ok {
+				if strings.HasPrefix(types[i].DatabaseTypeName(), "JSON") {
+					value = json.RawMessage(raw)
+				} else {
+					value = string(raw)
+				}
+			}
+			row[column] = value
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+func buildAccountExport(db *sql.DB, account *Account) (map[string]interface{}, error) {
+	sections := []struct {
+		key   string
+		query string
+		arg   string
+	}{
+		{"account", `
+			SELECT account_id, username, display_name, email, email_verified_at, pending_email, role, trust_status,
+				bio, pronouns, location, website, avatar_url, created_at, last_login_at,
+				totp_enabled_at IS NOT NULL AS two_factor_enabled
+			FROM accounts
+			WHERE account_id = $1
+		`, account.AccountID},
+		{"player", `
+			SELECT player_id, coins, stars, created_at, last_active_at
+			FROM players
+			WHERE player_id = $1
+		`, account.PlayerID},
+		{"seasonResults", `
+			SELECT season_id, final_rank, tier, stars, coins, captured_at
+			FROM season_final_rankings
+			WHERE player_id = $1
+			ORDER BY captured_at
+		`, account.PlayerID},
+		{"rankHistory", `
+			SELECT season_id, rank, previous_rank, stars, recorded_at
+			FROM leaderboard_rank_history
+			WHERE player_id = $1
+			ORDER BY recorded_at
+		`, account.PlayerID},
+		{"starPurchases", `
+			SELECT season_id, purchase_type, variant, price_paid, coins_before, coins_after, stars_before, stars_after, created_at
+			FROM star_purchase_log
+			WHERE player_id = $1
+			ORDER BY created_at
+		`, account.PlayerID},
+		{"coinEarnings", `
+			SELECT season_id, source_type, amount, coins_before, coins_after, created_at
+			FROM coin_earning_log
+			WHERE player_id = $1
+			ORDER BY created_at
+		`, account.PlayerID},
+		{"notifications", `
+			SELECT id, category, type, priority, message, link, payload, created_at
+			FROM notifications
+			WHERE recipient_account_id = $1 OR account_id = $1
+			ORDER BY created_at
+		`, account.AccountID},
+		{"notificationSettings", `
+			SELECT category, enabled, push_enabled, updated_at
+			FROM notification_settings
+			WHERE account_id = $1
+		`, account.AccountID},
+		{"telemetry", `
+			SELECT event_type, payload, created_at
+			FROM player_telemetry
+			WHERE account_id = $1 OR player_id = $2
+			ORDER BY created_at
+		`, account.AccountID},
+		{"friendships", `
+			SELECT requester_account_id, addressee_account_id, status, created_at, responded_at
+			FROM friendships
+			WHERE requester_account_id = $1 OR addressee_account_id = $1
+		`, account.AccountID},
+		{"teamMembership", `
+			SELECT team_id, role, joined_at
+			FROM team_members
+			WHERE account_id = $1
+		`, account.AccountID},
+		{"ipAddresses", `
+			SELECT ip, first_seen, last_seen
+			FROM player_ip_associations
+			WHERE player_id = $1
+		`, account.PlayerID},
+		{"networks", `
+			SELECT ip_range, first_seen_at, last_seen_at
+			FROM account_login_ranges
+			WHERE account_id = $1
+		`, account.AccountID},
+		{"devices", `
+			SELECT user_agent, first_seen_at, last_seen_at, last_ip
+			FROM account_devices
+			WHERE account_id = $1
+		`, account.AccountID},
+		{"apiTokens", `
+			SELECT token_id, name, scopes, created_at, expires_at, last_used_at, revoked_at
+			FROM api_tokens
+			WHERE account_id = $1
+		`, account.AccountID},
+	}
+
+	archive := map[string]interface{}{
+		"exportedAt": time.Now().UTC().Format(time.RFC3339),
+		"format":     "too-many-coins-account-export/v1",
+	}
+	for _, section := range sections {
+		args := []interface{}{section.arg}
+		if section.key == "telemetry" {
+			args = append(args, account.PlayerID)
+		}
+		rows, err := exportRows(db, section.query, args...)
+		if err != nil {
+			return nil, err
+		}
+		if section.key == "account" || section.key == "player" {
+			if len(rows) > 0 {
+				archive[section.key] = rows[0]
+			}
+			continue
+		}
+		archive[section.key] = rows
+	}
+	return archive, nil
+}
+
+func accountExportHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		account, ok := requireSession(db, w, r)
+		if !ok {
+			return
+		}
+		limit, window := authRateLimitConfig("account_export")
+		allowed, retryAfter, err := checkAuthRateLimit(db, getClientIP(r), "account_export", limit, window)
+		if err != nil {
+			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "RATE_LIMIT"})
+			return
+		}
+		archive, err := buildAccountExport(db, account)
+		if err != nil {
+			log.Println("account export: failed:", err)
+			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		filename := "too-many-coins-" + account.Username + "-" + time.Now().UTC().Format("20060102") + ".json"
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(archive)
+	}
+}
+
+func scheduledDeletion(db *sql.DB, accountID string) (*time.Time, error) {
+	var scheduledFor sql.NullTime
+	if err := db.QueryRow(`
+		SELECT deletion_scheduled_for
+		FROM accounts
+		WHERE account_id = $1
+	`, accountID).Scan(&scheduledFor); err != nil {
+		return nil, err
+	}
+	if !scheduledFor.Valid {
+		return nil, nil
+	}
+	return &scheduledFor.Time, nil
+}
+
+func scheduleAccountDeletion(db *sql.DB, account *Account) (time.Time, error) {
+	membership, err := loadTeamMembership(db, account.AccountID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if membership != nil && membership.Role == TeamRoleOwner {
+		var members int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM team_members WHERE team_id = $1`, membership.TeamID).Scan(&members); err != nil {
+			return time.Time{}, err
+		}
+		if members > 1 {
+			return time.Time{}, errors.New("OWNER_MUST_TRANSFER")
+		}
+	}
+
+	scheduledFor := time.Now().UTC().Add(accountDeletionGrace())
+	tx, err := db.Begin()
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`
+		UPDATE accounts
+		SET deletion_scheduled_for = $2
+		WHERE account_id = $1 AND deletion_scheduled_for IS NULL
+	`, account.AccountID, scheduledFor)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return time.Time{}, errors.New("DELETION_ALREADY_SCHEDULED")
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO account_deletions (account_id, player_id, status, requested_at, scheduled_for)
+		VALUES ($1, $2, $3, NOW(), $4)
+	`, account.AccountID, account.PlayerID, AccountDeletionScheduled, scheduledFor); err != nil {
+		return time.Time{}, err
+	}
+	// Integrations stop working as soon as deletion is requested.
+	if _, err := tx.Exec(`UPDATE api_tokens SET revoked_at = NOW() WHERE account_id = $1 AND revoked_at IS NULL`, account.AccountID); err != nil {
+		return time.Time{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return time.Time{}, err
+	}
+	return scheduledFor, nil
+}
+
+func cancelAccountDeletion(db *sql.DB, accountID string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`
+		UPDATE accounts
+		SET deletion_scheduled_for = NULL
+		WHERE account_id = $1 AND deletion_scheduled_for IS NOT NULL
+	`, accountID)
+	if err != nil {
+		return false, err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return false, nil
+	}
+	if _, err := tx.Exec(`
+		UPDATE account_deletions
+		SET status = $2, cancelled_at = NOW()
+		WHERE account_id = $1 AND status = $3
+	`, accountID, AccountDeletionCancelled, AccountDeletionScheduled); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// removeAccountFromTeam takes the account out of its team. A team it owned
+// passes to the longest-standing member, or disbands if it was the last one.
+func removeAccountFromTeam(tx *sql.Tx, accountID string) error {
+	membership, err := loadTeamMembership(tx, accountID)
+	if err != nil || membership == nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM team_members WHERE team_id = $1 AND account_id = $2`, membership.TeamID, accountID); err != nil {
+		return err
+	}
+	var heir string
+	if membership.Role == TeamRoleOwner {
+		err = tx.QueryRow(`
+			SELECT account_id
+			FROM team_members
+			WHERE team_id = $1
+			ORDER BY joined_at ASC
+			LIMIT 1
+		`, membership.TeamID).Scan(&heir)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+	action := "left"
+	if membership.Role == TeamRoleOwner && heir == "" {
+		action = "disbanded"
+	}
+	if err := logTeamMembership(tx, membership.TeamID, accountID, action, accountID, map[string]interface{}{
+		"reason": "account_deleted",
+	}); err != nil {
+		return err
+	}
+	if membership.Role != TeamRoleOwner {
+		return nil
+	}
+	if heir == "" {
+		if _, err := tx.Exec(`DELETE FROM team_join_requests WHERE team_id = $1`, membership.TeamID); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM teams WHERE team_id = $1`, membership.TeamID)
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE team_members SET role = $3 WHERE team_id = $1 AND account_id = $2`, membership.TeamID, heir, TeamRoleOwner); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE teams SET owner_account_id = $2 WHERE team_id = $1`, membership.TeamID, heir); err != nil {
+		return err
+	}
+	return logTeamMembership(tx, membership.TeamID, heir, "role_transfer", "", map[string]interface{}{
+		"role":   TeamRoleOwner,
+		"reason": "account_deleted",
+	})
+}
+
+// purgeAccount anonymizes the player's history and deletes the account.
+// Season results, rank history and economy logs move to a new random player
+// ID that nothing else references; everything personal is removed.
+func purgeAccount(tx *sql.Tx, accountID string, playerID string) error {
+	anonID, err := randomToken(12)
+	if err != nil {
+		return err
+	}
+	anonID = "anon_" + anonID
+
+	for _, query := range []string{
+		`UPDATE season_final_rankings SET player_id = $2 WHERE player_id = $1`,
+		`UPDATE leaderboard_rank_history SET player_id = $2 WHERE player_id = $1`,
+		`UPDATE star_purchase_log SET player_id = $2, account_id = NULL WHERE player_id = $1`,
+		`UPDATE coin_earning_log SET player_id = $2, account_id = NULL WHERE player_id = $1`,
+		`UPDATE abuse_events SET player_id = $2, account_id = NULL WHERE player_id = $1`,
+	} {
+		if _, err := tx.Exec(query, playerID, anonID); err != nil {
+			return err
+		}
+	}
+	for _, query := range []string{
+		`DELETE FROM leaderboard_ranks WHERE player_id = $1`,
+		`DELETE FROM player_telemetry WHERE player_id = $1`,
+		`DELETE FROM player_abuse_state WHERE player_id = $1`,
+	} {
+		if _, err := tx.Exec(query, playerID); err != nil {
+			return err
+		}
+	}
+
+	if err := removeAccountFromTeam(tx, accountID); err != nil {
+		return err
+	}
+	// The team log keeps its rows, including the departure just written, so
+	// team histories stay complete, but they no longer name the account.
+	for _, query := range []string{
+		`UPDATE team_membership_log SET account_id = $2 WHERE account_id = $1`,
+		`UPDATE team_membership_log SET actor_account_id = $2 WHERE actor_account_id = $1`,
+	} {
+		if _, err := tx.Exec(query, accountID, anonID); err != nil {
+			return err
+		}
+	}
+	for _, query := range []string{
+		`DELETE FROM player_telemetry WHERE account_id = $1`,
+		`DELETE FROM notifications WHERE recipient_account_id = $1 OR account_id = $1`,
+		`DELETE FROM notification_acks WHERE account_id = $1`,
+		`DELETE FROM notification_deletes WHERE account_id = $1`,
+		`DELETE FROM notification_settings WHERE account_id = $1`,
+		`DELETE FROM friendships WHERE requester_account_id = $1 OR addressee_account_id = $1`,
+		`DELETE FROM team_join_requests WHERE account_id = $1`,
+		`DELETE FROM password_resets WHERE account_id = $1`,
+		`DELETE FROM account_abuse_reputation WHERE account_id = $1`,
+	} {
+		if _, err := tx.Exec(query, accountID); err != nil {
+			return err
+		}
+	}
+	// A pending self-service request is closed out whichever path deleted
+	// the account.
+	if _, err := tx.Exec(`
+		UPDATE account_deletions
+		SET status = $2, completed_at = NOW()
+		WHERE account_id = $1 AND status = $3
+	`, accountID, AccountDeletionCompleted, AccountDeletionScheduled); err != nil {
+		return err
+	}
+	return deletePlayerData(tx, accountID, playerID)
+}
+
+func completeAccountDeletion(db *sql.DB, accountID string, playerID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := purgeAccount(tx, accountID, playerID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func processScheduledAccountDeletions(db *sql.DB) {
+	rows, err := db.Query(`
+		SELECT account_id, player_id
+		FROM accounts
+		WHERE deletion_scheduled_for IS NOT NULL AND deletion_scheduled_for <= NOW()
+		LIMIT 50
+	`)
+	if err != nil {
+		log.Println("account deletion: query failed:", err)
+		return
+	}
+	type dueAccount struct {
+		accountID string
+		playerID  string
+	}
+	var due []dueAccount
+	for rows.Next() {
+		var d dueAccount
+		if err := rows.Scan(&d.accountID, &d.playerID); err != nil {
+			log.Println("account deletion: scan failed:", err)
+			rows.Close()
+			return
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+
+	for _, d := range due {
+		if err := completeAccountDeletion(db, d.accountID, d.playerID); err != nil {
+			log.Println("account deletion: purge failed for", d.accountID, ":", err)
+		}
+	}
+}
+
+func startAccountDeletionWorker(db *sql.DB) {
+	go func() {
+		ticker := time.NewTicker(accountDeletionInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if isLeaderInstance() {
+				processScheduledAccountDeletions(db)
+			}
+		}
+	}()
+}
+
+func accountDeleteHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		account, ok := requireSession(db, w, r)
+		if !ok {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			scheduledFor, err := scheduledDeletion(db, account.AccountID)
+			if err != nil {
+				json.NewEncoder(w).Encode(AccountDeletionResponse{OK: false, Error: "INTERNAL_ERROR"})
+				return
+			}
+			response := AccountDeletionResponse{OK: true, Scheduled: scheduledFor != nil}
+			if scheduledFor != nil {
+				response.ScheduledFor = scheduledFor.UTC().Format(time.RFC3339)
+			}
+			json.NewEncoder(w).Encode(response)
+		case http.MethodPost:
+			limit, window := authRateLimitConfig("account_delete")
+			allowed, retryAfter, err := checkAuthRateLimit(db, getClientIP(r), "account_delete", limit, window)
+			if err != nil {
+				json.NewEncoder(w).Encode(AccountDeletionResponse{OK: false, Error: "INTERNAL_ERROR"})
+				return
+			}
+			if !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				w.WriteHeader(http.StatusTooManyRequests)
+				json.NewEncoder(w).Encode(AccountDeletionResponse{OK: false, Error: "RATE_LIMIT"})
+				return
+			}
+			var req AccountDeleteRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Password == "" {
+				json.NewEncoder(w).Encode(AccountDeletionResponse{OK: false, Error: "INVALID_REQUEST"})
+				return
+			}
+			if code, lockFor := verifyReauthentication(db, account, r, req.Password, req.TOTPCode, req.RecoveryCode); code != "" {
+				if lockFor > 0 {
+					w.Header().Set("Retry-After", strconv.Itoa(int(lockFor.Seconds())+1))
+					w.WriteHeader(http.StatusTooManyRequests)
+				}
+				json.NewEncoder(w).Encode(AccountDeletionResponse{OK: false, Error: code})
+				return
+			}
+			scheduledFor, err := scheduleAccountDeletion(db, account)
+			if err != nil {
+				switch err.Error() {
+				case "OWNER_MUST_TRANSFER", "DELETION_ALREADY_SCHEDULED":
+					json.NewEncoder(w).Encode(AccountDeletionResponse{OK: false, Error: err.Error()})
+				default:
+					log.Println("account delete: schedule failed:", err)
+					json.NewEncoder(w).Encode(AccountDeletionResponse{OK: false, Error: "INTERNAL_ERROR"})
+				}
+				return
+			}
+			message := "Your account is scheduled for deletion on " + scheduledFor.Format("2006-01-02") + ". Sign in and cancel before then to keep it."
+			emitNotification(db, NotificationInput{
+				RecipientRole:      NotificationRolePlayer,
+				RecipientAccountID: account.AccountID,
+				Category:           NotificationCategorySecurity,
+				Type:               "account_deletion_scheduled",
+				Priority:           NotificationPriorityHigh,
+				Message:            message,
+			})
+			sendSecurityAlertEmail(db, account.AccountID, "account deletion scheduled", message, describeUserAgent(r.UserAgent()), getClientIP(r))
+			json.NewEncoder(w).Encode(AccountDeletionResponse{OK: true, Scheduled: true, ScheduledFor: scheduledFor.Format(time.RFC3339)})
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func accountDeleteCancelHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		account, ok := requireSession(db, w, r)
+		if !ok {
+			return
+		}
+		cancelled, err := cancelAccountDeletion(db, account.AccountID)
+		if err != nil {
+			json.NewEncoder(w).Encode(AccountDeletionResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if !cancelled {
+			json.NewEncoder(w).Encode(AccountDeletionResponse{OK: false, Error: "NOT_SCHEDULED"})
+			return
+		}
+		json.NewEncoder(w).Encode(AccountDeletionResponse{OK: true, Scheduled: false})
+	}
+}
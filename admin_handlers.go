@@ -23,17 +23,18 @@ type AdminTelemetryResponse struct {
 }
 
 type AdminEconomyResponse struct {
-	OK                  bool    `json:"ok"`
-	Error               string  `json:"error,omitempty"`
-	DailyEmissionTarget int     `json:"dailyEmissionTarget,omitempty"`
-	BaseStarPrice       int     `json:"baseStarPrice,omitempty"`
-	CurrentStarPrice    int     `json:"currentStarPrice,omitempty"`
-	MarketPressure      float64 `json:"marketPressure,omitempty"`
-	DailyCapEarly       int     `json:"dailyCapEarly,omitempty"`
-	DailyCapLate        int     `json:"dailyCapLate,omitempty"`
-	FaucetsEnabled      bool    `json:"faucetsEnabled,omitempty"`
-	SinksEnabled        bool    `json:"sinksEnabled,omitempty"`
-	TelemetryEnabled    bool    `json:"telemetryEnabled,omitempty"`
+	OK                  bool            `json:"ok"`
+	Error               string          `json:"error,omitempty"`
+	DailyEmissionTarget int             `json:"dailyEmissionTarget,omitempty"`
+	BaseStarPrice       int             `json:"baseStarPrice,omitempty"`
+	CurrentStarPrice    int             `json:"currentStarPrice,omitempty"`
+	MarketPressure      float64         `json:"marketPressure,omitempty"`
+	DailyCapEarly       int             `json:"dailyCapEarly,omitempty"`
+	DailyCapLate        int             `json:"dailyCapLate,omitempty"`
+	FaucetsEnabled      bool            `json:"faucetsEnabled,omitempty"`
+	SinksEnabled        bool            `json:"sinksEnabled,omitempty"`
+	TelemetryEnabled    bool            `json:"telemetryEnabled,omitempty"`
+	Controls            *SeasonControls `json:"controls,omitempty"`
 }
 
 type AdminEconomyUpdateRequest struct {
@@ -83,17 +84,18 @@ type AdminAbuseEventsResponse struct {
 }
 
 type AdminOverviewResponse struct {
-	OK                   bool    `json:"ok"`
-	Error                string  `json:"error,omitempty"`
-	ActiveSeasons        int     `json:"activeSeasons"`
-	CoinsEmittedLastHour int64   `json:"coinsEmittedLastHour"`
-	StarsPurchasedHour   int64   `json:"starsPurchasedLastHour"`
-	MarketPressure       float64 `json:"marketPressure"`
-	MarketPressureRatio  float64 `json:"marketPressureRatio"`
-	ActiveThrottles      int     `json:"activeThrottles"`
-	ActiveAbuseFlags     int     `json:"activeAbuseFlags"`
-	AbuseEventsLastHour  int     `json:"abuseEventsLastHour"`
-	AbuseSevereLastHour  int     `json:"abuseSevereLastHour"`
+	OK                   bool          `json:"ok"`
+	Error                string        `json:"error,omitempty"`
+	ActiveSeasons        int           `json:"activeSeasons"`
+	CoinsEmittedLastHour int64         `json:"coinsEmittedLastHour"`
+	StarsPurchasedHour   int64         `json:"starsPurchasedLastHour"`
+	MarketPressure       float64       `json:"marketPressure"`
+	MarketPressureRatio  float64       `json:"marketPressureRatio"`
+	ActiveThrottles      int           `json:"activeThrottles"`
+	ActiveAbuseFlags     int           `json:"activeAbuseFlags"`
+	AbuseEventsLastHour  int           `json:"abuseEventsLastHour"`
+	AbuseSevereLastHour  int           `json:"abuseSevereLastHour"`
+	FeatureFlags         []FeatureFlag `json:"featureFlags"`
 }
 
 type AdminToggleStatus struct {
@@ -105,10 +107,11 @@ type AdminToggleStatus struct {
 }
 
 type AdminAntiCheatResponse struct {
-	OK          bool                `json:"ok"`
-	Error       string              `json:"error,omitempty"`
-	Toggles     []AdminToggleStatus `json:"toggles,omitempty"`
-	Sensitivity map[string]string   `json:"sensitivity,omitempty"`
+	OK           bool                `json:"ok"`
+	Error        string              `json:"error,omitempty"`
+	Toggles      []AdminToggleStatus `json:"toggles,omitempty"`
+	Sensitivity  map[string]string   `json:"sensitivity,omitempty"`
+	FeatureFlags []FeatureFlag       `json:"featureFlags,omitempty"`
 }
 
 type AdminPlayerSearchItem struct {
@@ -152,43 +155,9 @@ type AdminAuditLogResponse struct {
 	Query string              `json:"query,omitempty"`
 }
 
-func requireAdmin(db *sql.DB, w http.ResponseWriter, r *http.Request) (*Account, bool) {
-	account, _, err := getSessionAccount(db, r)
-	if err != nil || account == nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		return nil, false
-	}
-	if account.Role != "admin" {
-		w.WriteHeader(http.StatusForbidden)
-		return nil, false
-	}
-	if account.MustChangePassword {
-		w.WriteHeader(http.StatusForbidden)
-		return nil, false
-	}
-	return account, true
-}
-
-func requireModerator(db *sql.DB, w http.ResponseWriter, r *http.Request) (*Account, bool) {
-	account, _, err := getSessionAccount(db, r)
-	if err != nil || account == nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		return nil, false
-	}
-	if account.Role != "admin" && account.Role != "moderator" {
-		w.WriteHeader(http.StatusForbidden)
-		return nil, false
-	}
-	if account.Role == "admin" && account.MustChangePassword {
-		w.WriteHeader(http.StatusForbidden)
-		return nil, false
-	}
-	return account, true
-}
-
 func adminTelemetryHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if _, ok := requireAdmin(db, w, r); !ok {
+		if _, ok := requirePermission(db, w, r, PermViewTelemetry); !ok {
 			return
 		}
 
@@ -227,7 +196,7 @@ func adminEconomyHandler(db *sql.DB) http.HandlerFunc {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
-		if _, ok := requireAdmin(db, w, r); !ok {
+		if _, ok := requirePermission(db, w, r, PermViewEconomy); !ok {
 			return
 		}
 
@@ -236,6 +205,7 @@ func adminEconomyHandler(db *sql.DB) http.HandlerFunc {
 			params := economy.Calibration()
 			coins := economy.CoinsInCirculation()
 			remaining := seasonSecondsRemaining(time.Now().UTC())
+			controls := currentSeasonControls()
 			json.NewEncoder(w).Encode(AdminEconomyResponse{
 				OK:                  true,
 				DailyEmissionTarget: economy.DailyEmissionTarget(),
@@ -244,9 +214,10 @@ func adminEconomyHandler(db *sql.DB) http.HandlerFunc {
 				MarketPressure:      economy.MarketPressure(),
 				DailyCapEarly:       params.DailyCapEarly,
 				DailyCapLate:        params.DailyCapLate,
-				FaucetsEnabled:      featureFlags.FaucetsEnabled,
-				SinksEnabled:        featureFlags.SinksEnabled,
-				TelemetryEnabled:    featureFlags.Telemetry,
+				FaucetsEnabled:      currentFeatureFlags().FaucetsEnabled,
+				SinksEnabled:        currentFeatureFlags().SinksEnabled,
+				TelemetryEnabled:    currentFeatureFlags().Telemetry,
+				Controls:            &controls,
 			})
 			return
 		default:
@@ -262,7 +233,7 @@ func adminAbuseEventsHandler(db *sql.DB) http.HandlerFunc {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
-		if _, ok := requireAdmin(db, w, r); !ok {
+		if _, ok := requirePermission(db, w, r, PermViewAbuse); !ok {
 			return
 		}
 
@@ -311,7 +282,7 @@ func adminOverviewHandler(db *sql.DB) http.HandlerFunc {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
-		if _, ok := requireAdmin(db, w, r); !ok {
+		if _, ok := requirePermission(db, w, r, PermViewOverview); !ok {
 			return
 		}
 
@@ -391,6 +362,7 @@ func adminOverviewHandler(db *sql.DB) http.HandlerFunc {
 			ActiveAbuseFlags:     activeFlags,
 			AbuseEventsLastHour:  abuseEvents,
 			AbuseSevereLastHour:  abuseSevere,
+			FeatureFlags:         listFeatureFlags(),
 		})
 	}
 }
@@ -401,7 +373,7 @@ func adminAntiCheatHandler(db *sql.DB) http.HandlerFunc {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
-		if _, ok := requireAdmin(db, w, r); !ok {
+		if _, ok := requirePermission(db, w, r, PermViewAbuse); !ok {
 			return
 		}
 
@@ -432,11 +404,16 @@ func adminAntiCheatHandler(db *sql.DB) http.HandlerFunc {
 		ipCount, ipLast := queryStats([]string{"ip_cluster_activity"})
 		abuseCount, abuseLast := queryStats([]string{"purchase_burst", "purchase_regular_interval", "activity_regular_interval", "tick_reaction_burst", "ip_cluster_activity"})
 
+		ipThrottlingStatus := "disabled"
+		if flag, ok := getFeatureFlag(FlagIPThrottling); ok {
+			ipThrottlingStatus = featureFlagStatus(flag)
+		}
+
 		toggles := []AdminToggleStatus{
 			{
 				Key:             "ip_enforcement",
 				Label:           "Enable IP enforcement",
-				Status:          map[bool]string{true: "enabled", false: "disabled"}[featureFlags.IPThrottling],
+				Status:          ipThrottlingStatus,
 				LastTriggeredAt: ipLast,
 				EventCount:      ipCount,
 			},
@@ -479,6 +456,7 @@ func adminAntiCheatHandler(db *sql.DB) http.HandlerFunc {
 				"trade":      "not-configured",
 				"faucet":     "not-configured",
 			},
+			FeatureFlags: listFeatureFlags(),
 		})
 	}
 }
@@ -489,7 +467,7 @@ func adminPlayerSearchHandler(db *sql.DB) http.HandlerFunc {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
-		if _, ok := requireAdmin(db, w, r); !ok {
+		if _, ok := requirePermission(db, w, r, PermViewPlayers); !ok {
 			return
 		}
 
@@ -571,7 +549,7 @@ func adminAuditLogHandler(db *sql.DB) http.HandlerFunc {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
-		if _, ok := requireAdmin(db, w, r); !ok {
+		if _, ok := requirePermission(db, w, r, PermViewAuditLog); !ok {
 			return
 		}
 
@@ -695,7 +673,7 @@ func adminKeySetHandler(db *sql.DB) http.HandlerFunc {
 		err = tx.QueryRowContext(ctx, `
 			SELECT account_id
 			FROM accounts
-			WHERE role = 'admin' OR role = 'frozen:admin'
+			WHERE role = 'admin'
 			LIMIT 1
 			FOR UPDATE
 		`).Scan(&adminMarker)
@@ -728,6 +706,9 @@ func adminKeySetHandler(db *sql.DB) http.HandlerFunc {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
+		if rejectAPIToken(w, account) {
+			return
+		}
 
 		adminKey, err := generateAdminKey()
 		if err != nil {
@@ -800,11 +781,13 @@ func adminKeySetHandler(db *sql.DB) http.HandlerFunc {
 type AdminRoleRequest struct {
 	Username string `json:"username"`
 	Role     string `json:"role"`
+	Reason   string `json:"reason,omitempty"`
 }
 
 type AdminRoleResponse struct {
-	OK    bool   `json:"ok"`
-	Error string `json:"error,omitempty"`
+	OK            bool                `json:"ok"`
+	Error         string              `json:"error,omitempty"`
+	PendingAction *PendingAdminAction `json:"pendingAction,omitempty"`
 }
 
 func adminRoleHandler(db *sql.DB) http.HandlerFunc {
@@ -813,7 +796,7 @@ func adminRoleHandler(db *sql.DB) http.HandlerFunc {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
-		adminAccount, ok := requireAdmin(db, w, r)
+		adminAccount, ok := requirePermission(db, w, r, PermManageRoles)
 		if !ok {
 			return
 		}
@@ -826,39 +809,62 @@ func adminRoleHandler(db *sql.DB) http.HandlerFunc {
 			json.NewEncoder(w).Encode(AdminRoleResponse{OK: false, Error: "INVALID_REQUEST"})
 			return
 		}
-		if err := setAccountRoleByUsername(db, req.Username, req.Role); err != nil {
+		username := strings.ToLower(strings.TrimSpace(req.Username))
+		var exists bool
+		if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM accounts WHERE username = $1)`, username).Scan(&exists); err != nil {
 			json.NewEncoder(w).Encode(AdminRoleResponse{OK: false, Error: "INTERNAL_ERROR"})
 			return
 		}
-		if normalizeRole(req.Role) == "admin" {
-			var existing sql.NullString
-			if err := db.QueryRow(`
-				SELECT admin_key_hash FROM accounts WHERE username = $1
-			`, strings.ToLower(strings.TrimSpace(req.Username))).Scan(&existing); err == nil {
-				if !existing.Valid || existing.String == "" {
-					generated, err := generateAdminKey()
-					if err == nil {
-						_ = setAdminKeyByUsername(db, req.Username, generated)
-					}
+		if !exists {
+			json.NewEncoder(w).Encode(AdminRoleResponse{OK: false, Error: "NOT_FOUND"})
+			return
+		}
+		pending, errCode := submitAdminAction(db, adminAccount.AccountID, PendingActionRoleChange, map[string]interface{}{
+			"username": username,
+			"role":     normalizeRole(req.Role),
+		}, strings.TrimSpace(req.Reason))
+		if errCode != "" {
+			json.NewEncoder(w).Encode(AdminRoleResponse{OK: false, Error: errCode})
+			return
+		}
+		json.NewEncoder(w).Encode(AdminRoleResponse{OK: true, PendingAction: pending})
+	}
+}
+
+func executeRoleChange(db *sql.DB, action PendingAdminAction) string {
+	username := pendingPayloadString(action.Payload, "username")
+	role := normalizeRole(pendingPayloadString(action.Payload, "role"))
+	if err := setAccountRoleByUsername(db, username, role); err != nil {
+		return "INTERNAL_ERROR"
+	}
+	if role == "admin" {
+		var existing sql.NullString
+		if err := db.QueryRow(`
+			SELECT admin_key_hash FROM accounts WHERE username = $1
+		`, username).Scan(&existing); err == nil {
+			if !existing.Valid || existing.String == "" {
+				generated, err := generateAdminKey()
+				if err == nil {
+					_ = setAdminKeyByUsername(db, username, generated)
 				}
 			}
 		}
-		emitNotification(db, NotificationInput{
-			RecipientRole: NotificationRoleAdmin,
-			Category:      NotificationCategoryAdmin,
-			Type:          "role_updated",
-			Priority:      NotificationPriorityNormal,
-			Message:       "Role updated for @" + strings.ToLower(strings.TrimSpace(req.Username)) + ": " + normalizeRole(req.Role),
-			Payload: map[string]interface{}{
-				"username": strings.ToLower(strings.TrimSpace(req.Username)),
-				"role":     normalizeRole(req.Role),
-			},
-		})
-		_ = logAdminAction(db, adminAccount.AccountID, "role_update", "account", strings.ToLower(strings.TrimSpace(req.Username)), "", map[string]interface{}{
-			"role": normalizeRole(req.Role),
-		})
-		json.NewEncoder(w).Encode(AdminRoleResponse{OK: true})
 	}
+	emitNotification(db, NotificationInput{
+		RecipientRole: NotificationRoleAdmin,
+		Category:      NotificationCategoryAdmin,
+		Type:          "role_updated",
+		Priority:      NotificationPriorityNormal,
+		Message:       "Role updated for @" + username + ": " + role,
+		Payload: map[string]interface{}{
+			"username": username,
+			"role":     role,
+		},
+	})
+	_ = logAdminAction(db, action.RequestedBy, "role_update", "account", username, action.Reason, pendingActionAuditDetails(action, map[string]interface{}{
+		"role": role,
+	}))
+	return ""
 }
 
 type ModeratorProfileRequest struct {
@@ -878,19 +884,26 @@ type ModeratorProfileResponse struct {
 	Username    string `json:"username,omitempty"`
 	DisplayName string `json:"displayName,omitempty"`
 	Email       string `json:"email,omitempty"`
-	Bio         string `json:"bio,omitempty"`
-	Pronouns    string `json:"pronouns,omitempty"`
-	Location    string `json:"location,omitempty"`
-	Website     string `json:"website,omitempty"`
-	AvatarURL   string `json:"avatarUrl,omitempty"`
-	Role        string `json:"role,omitempty"`
-	Frozen      bool   `json:"frozen,omitempty"`
-	PlayerID    string `json:"playerId,omitempty"`
+	// PendingEmail is an address a moderator set that is waiting for the
+	// owner to confirm it.
+	PendingEmail string `json:"pendingEmail,omitempty"`
+	Bio          string `json:"bio,omitempty"`
+	Pronouns     string `json:"pronouns,omitempty"`
+	Location     string `json:"location,omitempty"`
+	Website      string `json:"website,omitempty"`
+	AvatarURL    string `json:"avatarUrl,omitempty"`
+	Role         string `json:"role,omitempty"`
+	Frozen       bool   `json:"frozen,omitempty"`
+	PlayerID     string `json:"playerId,omitempty"`
 }
 
 func moderatorProfileHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		viewer, ok := requireModerator(db, w, r)
+		permission := PermViewPlayers
+		if r.Method == http.MethodPost {
+			permission = PermEditProfiles
+		}
+		viewer, ok := requirePermission(db, w, r, permission)
 		if !ok {
 			return
 		}
@@ -909,12 +922,13 @@ func moderatorProfileHandler(db *sql.DB) http.HandlerFunc {
 			var website sql.NullString
 			var avatarURL sql.NullString
 			var role string
+			var frozen bool
 			var playerID string
 			err := db.QueryRow(`
-				SELECT display_name, email, bio, pronouns, location, website, avatar_url, role, player_id
+				SELECT display_name, email, bio, pronouns, location, website, avatar_url, role, frozen_at IS NOT NULL, player_id
 				FROM accounts
 				WHERE username = $1
-			`, strings.ToLower(username)).Scan(&displayName, &email, &bio, &pronouns, &location, &website, &avatarURL, &role, &playerID)
+			`, strings.ToLower(username)).Scan(&displayName, &email, &bio, &pronouns, &location, &website, &avatarURL, &role, &frozen, &playerID)
 			if err == sql.ErrNoRows {
 				json.NewEncoder(w).Encode(ModeratorProfileResponse{OK: false, Error: "NOT_FOUND"})
 				return
@@ -923,7 +937,7 @@ func moderatorProfileHandler(db *sql.DB) http.HandlerFunc {
 				json.NewEncoder(w).Encode(ModeratorProfileResponse{OK: false, Error: "INTERNAL_ERROR"})
 				return
 			}
-			if viewer.Role == "moderator" && baseRoleFromRaw(role) == "admin" {
+			if viewer.Role != "admin" && normalizeRole(role) == "admin" {
 				w.WriteHeader(http.StatusForbidden)
 				json.NewEncoder(w).Encode(ModeratorProfileResponse{OK: false, Error: "FORBIDDEN"})
 				return
@@ -932,8 +946,8 @@ func moderatorProfileHandler(db *sql.DB) http.HandlerFunc {
 				OK:          true,
 				Username:    strings.ToLower(username),
 				DisplayName: displayName,
-				Role:        baseRoleFromRaw(role),
-				Frozen:      isFrozenRole(role),
+				Role:        normalizeRole(role),
+				Frozen:      frozen,
 				PlayerID:    playerID,
 			}
 			if email.Valid {
@@ -963,11 +977,12 @@ func moderatorProfileHandler(db *sql.DB) http.HandlerFunc {
 				return
 			}
 			var role string
-			if err := db.QueryRow(`SELECT role FROM accounts WHERE username = $1`, strings.ToLower(req.Username)).Scan(&role); err != nil {
+			var accountID string
+			if err := db.QueryRow(`SELECT role, account_id FROM accounts WHERE username = $1`, strings.ToLower(req.Username)).Scan(&role, &accountID); err != nil {
 				json.NewEncoder(w).Encode(ModeratorProfileResponse{OK: false, Error: "NOT_FOUND"})
 				return
 			}
-			if viewer.Role == "moderator" && baseRoleFromRaw(role) == "admin" {
+			if viewer.Role != "admin" && normalizeRole(role) == "admin" {
 				w.WriteHeader(http.StatusForbidden)
 				json.NewEncoder(w).Encode(ModeratorProfileResponse{OK: false, Error: "FORBIDDEN"})
 				return
@@ -987,10 +1002,17 @@ func moderatorProfileHandler(db *sql.DB) http.HandlerFunc {
 				args = append(args, displayName)
 				argIndex++
 			}
+			// A new address goes through the same confirmation as a
+			// player's own change, so it is held as pending until the link
+			// sent to it is used.
+			email := ""
 			if req.Email != "" {
-				updates = append(updates, "email = $"+strconv.Itoa(argIndex))
-				args = append(args, strings.TrimSpace(req.Email))
-				argIndex++
+				normalized, err := normalizeEmail(req.Email)
+				if err != nil || normalized == "" {
+					json.NewEncoder(w).Encode(ModeratorProfileResponse{OK: false, Error: "INVALID_EMAIL"})
+					return
+				}
+				email = normalized
 			}
 			if req.Bio != "" {
 				updates = append(updates, "bio = $"+strconv.Itoa(argIndex))
@@ -1018,18 +1040,50 @@ func moderatorProfileHandler(db *sql.DB) http.HandlerFunc {
 				argIndex++
 			}
 
-			if len(updates) == 0 {
+			if len(updates) == 0 && email == "" {
 				json.NewEncoder(w).Encode(ModeratorProfileResponse{OK: false, Error: "NO_UPDATES"})
 				return
 			}
-			args = append(args, username)
-			query := "UPDATE accounts SET " + strings.Join(updates, ", ") + " WHERE username = $" + strconv.Itoa(argIndex)
-			_, err := db.Exec(query, args...)
-			if err != nil {
-				json.NewEncoder(w).Encode(ModeratorProfileResponse{OK: false, Error: "INTERNAL_ERROR"})
-				return
+			if email != "" {
+				inUse, err := emailInUse(db, accountID, email)
+				if err != nil {
+					json.NewEncoder(w).Encode(ModeratorProfileResponse{OK: false, Error: "INTERNAL_ERROR"})
+					return
+				}
+				if inUse {
+					json.NewEncoder(w).Encode(ModeratorProfileResponse{OK: false, Error: "EMAIL_IN_USE"})
+					return
+				}
+			}
+			if len(updates) > 0 {
+				args = append(args, username)
+				query := "UPDATE accounts SET " + strings.Join(updates, ", ") + " WHERE username = $" + strconv.Itoa(argIndex)
+				if _, err := db.Exec(query, args...); err != nil {
+					json.NewEncoder(w).Encode(ModeratorProfileResponse{OK: false, Error: "INTERNAL_ERROR"})
+					return
+				}
 			}
-			json.NewEncoder(w).Encode(ModeratorProfileResponse{OK: true, Username: username})
+			resp := ModeratorProfileResponse{OK: true, Username: username}
+			if email != "" {
+				status, err := updateAccountEmail(db, accountID, email, appBaseURL(r))
+				if err != nil {
+					code := "INTERNAL_ERROR"
+					if err.Error() == "EMAIL_IN_USE" {
+						code = err.Error()
+					}
+					json.NewEncoder(w).Encode(ModeratorProfileResponse{OK: false, Error: code})
+					return
+				}
+				resp.Email = status.Email
+				resp.PendingEmail = status.PendingEmail
+				if status.PendingEmail == email {
+					_ = logAdminAction(db, viewer.AccountID, "moderator_email_change", "account", accountID, "", map[string]interface{}{
+						"username":     username,
+						"pendingEmail": email,
+					})
+				}
+			}
+			json.NewEncoder(w).Encode(resp)
 			return
 		default:
 			w.WriteHeader(http.StatusMethodNotAllowed)
@@ -1044,7 +1098,7 @@ func adminNotificationsHandler(db *sql.DB) http.HandlerFunc {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
-		adminAccount, ok := requireAdmin(db, w, r)
+		adminAccount, ok := requirePermission(db, w, r, PermSendNotifications)
 		if !ok {
 			return
 		}
@@ -1140,7 +1194,7 @@ func adminPlayerControlsHandler(db *sql.DB) http.HandlerFunc {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
-		adminAccount, ok := requireAdmin(db, w, r)
+		adminAccount, ok := requirePermission(db, w, r, PermManagePlayers)
 		if !ok {
 			return
 		}
@@ -1267,27 +1321,168 @@ func adminPlayerControlsHandler(db *sql.DB) http.HandlerFunc {
 
 func adminSettingsHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
+		if r.Method != http.MethodGet && r.Method != http.MethodPut && r.Method != http.MethodPatch {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
-		if _, ok := requireAdmin(db, w, r); !ok {
+		permission := PermViewSettings
+		if r.Method != http.MethodGet {
+			permission = PermEditSettings
+		}
+		admin, ok := requirePermission(db, w, r, permission)
+		if !ok {
 			return
 		}
 		switch r.Method {
 		case http.MethodGet:
-			json.NewEncoder(w).Encode(AdminGlobalSettingsResponse{OK: true, Settings: GetGlobalSettings()})
+			version, err := currentSettingsVersion(db)
+			if err != nil {
+				json.NewEncoder(w).Encode(AdminGlobalSettingsResponse{OK: false, Error: "INTERNAL_ERROR"})
+				return
+			}
+			json.NewEncoder(w).Encode(AdminGlobalSettingsResponse{
+				OK:       true,
+				Settings: GetGlobalSettings(),
+				Version:  version,
+				Schema:   settingsSchemaList(),
+				Phase:    string(CurrentPhase()),
+			})
 			return
-		default:
+		}
+
+		var req AdminGlobalSettingsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Settings) == 0 {
+			json.NewEncoder(w).Encode(AdminGlobalSettingsResponse{OK: false, Error: "INVALID_REQUEST"})
+			return
+		}
+		reason := strings.TrimSpace(req.Reason)
+		if reason == "" {
+			json.NewEncoder(w).Encode(AdminGlobalSettingsResponse{OK: false, Error: "REASON_REQUIRED"})
+			return
+		}
+		updates := map[string]string{}
+		for key, raw := range req.Settings {
+			var value interface{}
+			if err := json.Unmarshal(raw, &value); err != nil {
+				json.NewEncoder(w).Encode(AdminGlobalSettingsResponse{OK: false, Error: "INVALID_SETTING_TYPE", ErrorKey: key})
+				return
+			}
+			switch typed := value.(type) {
+			case string:
+				updates[key] = typed
+			case bool:
+				updates[key] = strconv.FormatBool(typed)
+			case float64:
+				if typed != float64(int64(typed)) {
+					json.NewEncoder(w).Encode(AdminGlobalSettingsResponse{OK: false, Error: "INVALID_SETTING_TYPE", ErrorKey: key})
+					return
+				}
+				updates[key] = strconv.FormatInt(int64(typed), 10)
+			default:
+				json.NewEncoder(w).Encode(AdminGlobalSettingsResponse{OK: false, Error: "INVALID_SETTING_TYPE", ErrorKey: key})
+				return
+			}
+		}
+		if r.Method == http.MethodPut {
+			for key := range settingsSchema {
+				if _, ok := updates[key]; !ok {
+					json.NewEncoder(w).Encode(AdminGlobalSettingsResponse{OK: false, Error: "MISSING_SETTING", ErrorKey: key})
+					return
+				}
+			}
+		}
+
+		settings, version, err := UpdateGlobalSettings(db, updates, admin.AccountID, reason)
+		if err != nil {
+			writeSettingsError(w, err)
+			return
+		}
+		details := map[string]interface{}{"version": version, "changes": updates}
+		_ = logAdminAction(db, admin.AccountID, "settings_update", "settings", strconv.FormatInt(version, 10), reason, details)
+		json.NewEncoder(w).Encode(AdminGlobalSettingsResponse{OK: true, Settings: settings, Version: version})
+	}
+}
+
+func adminSettingsHistoryHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if _, ok := requirePermission(db, w, r, PermViewSettings); !ok {
+			return
+		}
+		limit := parsePositiveInt(r.URL.Query().Get("limit"), 100)
+		if limit > 500 {
+			limit = 500
+		}
+		rows, err := db.Query(`
+			SELECT version, key, COALESCE(old_value, ''), new_value, COALESCE(changed_by, ''), COALESCE(reason, ''), COALESCE(rollback_of, 0), created_at
+			FROM global_settings_history
+			ORDER BY version DESC, id DESC
+			LIMIT $1
+		`, limit)
+		if err != nil {
+			json.NewEncoder(w).Encode(AdminGlobalSettingsResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		defer rows.Close()
+		history := []GlobalSettingsChange{}
+		for rows.Next() {
+			var change GlobalSettingsChange
+			var createdAt time.Time
+			if err := rows.Scan(&change.Version, &change.Key, &change.OldValue, &change.NewValue, &change.ChangedBy, &change.Reason, &change.RollbackOf, &createdAt); err != nil {
+				continue
+			}
+			change.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+			history = append(history, change)
+		}
+		json.NewEncoder(w).Encode(AdminGlobalSettingsResponse{OK: true, History: history})
+	}
+}
+
+func adminSettingsRollbackHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
+		admin, ok := requirePermission(db, w, r, PermEditSettings)
+		if !ok {
+			return
+		}
+		var req AdminSettingsRollbackRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Version <= 0 {
+			json.NewEncoder(w).Encode(AdminGlobalSettingsResponse{OK: false, Error: "INVALID_REQUEST"})
+			return
+		}
+		reason := strings.TrimSpace(req.Reason)
+		if reason == "" {
+			json.NewEncoder(w).Encode(AdminGlobalSettingsResponse{OK: false, Error: "REASON_REQUIRED"})
+			return
+		}
+		settings, version, err := RollbackGlobalSettings(db, req.Version, admin.AccountID, reason)
+		if err != nil {
+			writeSettingsError(w, err)
+			return
+		}
+		details := map[string]interface{}{"version": version, "rollbackOf": req.Version}
+		_ = logAdminAction(db, admin.AccountID, "settings_rollback", "settings", strconv.FormatInt(version, 10), reason, details)
+		json.NewEncoder(w).Encode(AdminGlobalSettingsResponse{OK: true, Settings: settings, Version: version})
 	}
 }
 
+func writeSettingsError(w http.ResponseWriter, err error) {
+	if settingErr, ok := err.(*SettingError); ok {
+		json.NewEncoder(w).Encode(AdminGlobalSettingsResponse{OK: false, Error: settingErr.Code, ErrorKey: settingErr.Key})
+		return
+	}
+	json.NewEncoder(w).Encode(AdminGlobalSettingsResponse{OK: false, Error: "INTERNAL_ERROR"})
+}
+
 func adminStarPurchaseLogHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if _, ok := requireAdmin(db, w, r); !ok {
+		if _, ok := requirePermission(db, w, r, PermViewEconomy); !ok {
 			return
 		}
 		if r.Method != http.MethodGet {
@@ -1488,7 +1683,7 @@ func adminBotListHandler(db *sql.DB) http.HandlerFunc {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
-		if _, ok := requireAdmin(db, w, r); !ok {
+		if _, ok := requirePermission(db, w, r, PermViewPlayers); !ok {
 			return
 		}
 
@@ -1528,7 +1723,7 @@ func adminBotCreateHandler(db *sql.DB) http.HandlerFunc {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
-		adminAccount, ok := requireAdmin(db, w, r)
+		adminAccount, ok := requirePermission(db, w, r, PermManageBots)
 		if !ok {
 			return
 		}
@@ -1596,7 +1791,7 @@ func adminBotDeleteHandler(db *sql.DB) http.HandlerFunc {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
-		adminAccount, ok := requireAdmin(db, w, r)
+		adminAccount, ok := requirePermission(db, w, r, PermManageBots)
 		if !ok {
 			return
 		}
@@ -1636,69 +1831,90 @@ func adminBotDeleteHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		tx, err := db.Begin()
-		if err != nil {
-			json.NewEncoder(w).Encode(AdminBotDeleteResponse{OK: false, Error: "INTERNAL_ERROR"})
+		pending, errCode := submitAdminAction(db, adminAccount.AccountID, PendingActionBotDelete, map[string]interface{}{
+			"playerId": resolvedPlayerID,
+			"username": username,
+		}, strings.TrimSpace(req.Reason))
+		if errCode != "" {
+			json.NewEncoder(w).Encode(AdminBotDeleteResponse{OK: false, Error: errCode})
 			return
 		}
-		if accountID.Valid {
-			if _, err := tx.Exec(`DELETE FROM refresh_tokens WHERE account_id = $1`, accountID.String); err != nil {
-				tx.Rollback()
-				json.NewEncoder(w).Encode(AdminBotDeleteResponse{OK: false, Error: "INTERNAL_ERROR"})
-				return
-			}
-			if _, err := tx.Exec(`DELETE FROM sessions WHERE account_id = $1`, accountID.String); err != nil {
-				tx.Rollback()
-				json.NewEncoder(w).Encode(AdminBotDeleteResponse{OK: false, Error: "INTERNAL_ERROR"})
-				return
-			}
-			if _, err := tx.Exec(`DELETE FROM notification_reads WHERE account_id = $1`, accountID.String); err != nil {
-				tx.Rollback()
-				json.NewEncoder(w).Encode(AdminBotDeleteResponse{OK: false, Error: "INTERNAL_ERROR"})
-				return
-			}
-			if _, err := tx.Exec(`DELETE FROM accounts WHERE account_id = $1`, accountID.String); err != nil {
-				tx.Rollback()
-				json.NewEncoder(w).Encode(AdminBotDeleteResponse{OK: false, Error: "INTERNAL_ERROR"})
-				return
+		json.NewEncoder(w).Encode(AdminBotDeleteResponse{OK: true, PlayerID: resolvedPlayerID, PendingAction: pending})
+	}
+}
+
+func executeBotDelete(db *sql.DB, action PendingAdminAction) string {
+	playerID := pendingPayloadString(action.Payload, "playerId")
+	var accountID sql.NullString
+	var isBot bool
+	err := db.QueryRow(`
+		SELECT a.account_id, p.is_bot
+		FROM players p
+		LEFT JOIN accounts a ON a.player_id = p.player_id
+		WHERE p.player_id = $1
+	`, playerID).Scan(&accountID, &isBot)
+	if err == sql.ErrNoRows {
+		return "NOT_FOUND"
+	}
+	if err != nil {
+		return "INTERNAL_ERROR"
+	}
+	if !isBot {
+		return "NOT_BOT"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "INTERNAL_ERROR"
+	}
+	if err := deletePlayerData(tx, accountID.String, playerID); err != nil {
+		tx.Rollback()
+		return "INTERNAL_ERROR"
+	}
+	if err := tx.Commit(); err != nil {
+		return "INTERNAL_ERROR"
+	}
+	_ = logAdminAction(db, action.RequestedBy, "bot_delete", "player", playerID, action.Reason, pendingActionAuditDetails(action, map[string]interface{}{
+		"accountId": accountID.String,
+		"username":  pendingPayloadString(action.Payload, "username"),
+	}))
+	return ""
+}
+
+// deletePlayerData removes a player, its per-player rows and, when accountID
+// is set, the account with its sessions and grants.
+func deletePlayerData(tx *sql.Tx, accountID string, playerID string) error {
+	if accountID != "" {
+		for _, query := range []string{
+			`DELETE FROM refresh_tokens WHERE account_id = $1`,
+			`DELETE FROM sessions WHERE account_id = $1`,
+			`DELETE FROM notification_reads WHERE account_id = $1`,
+			`DELETE FROM account_permissions WHERE account_id = $1`,
+			`DELETE FROM account_recovery_codes WHERE account_id = $1`,
+			`DELETE FROM account_devices WHERE account_id = $1`,
+			`DELETE FROM email_verifications WHERE account_id = $1`,
+			`DELETE FROM api_tokens WHERE account_id = $1`,
+			`DELETE FROM account_login_failures WHERE account_id = $1`,
+			`DELETE FROM account_login_ranges WHERE account_id = $1`,
+			`DELETE FROM accounts WHERE account_id = $1`,
+		} {
+			if _, err := tx.Exec(query, accountID); err != nil {
+				return err
 			}
 		}
-		if _, err := tx.Exec(`DELETE FROM player_boosts WHERE player_id = $1`, resolvedPlayerID); err != nil {
-			tx.Rollback()
-			json.NewEncoder(w).Encode(AdminBotDeleteResponse{OK: false, Error: "INTERNAL_ERROR"})
-			return
-		}
-		if _, err := tx.Exec(`DELETE FROM player_star_variants WHERE player_id = $1`, resolvedPlayerID); err != nil {
-			tx.Rollback()
-			json.NewEncoder(w).Encode(AdminBotDeleteResponse{OK: false, Error: "INTERNAL_ERROR"})
-			return
-		}
-		if _, err := tx.Exec(`DELETE FROM player_faucet_claims WHERE player_id = $1`, resolvedPlayerID); err != nil {
-			tx.Rollback()
-			json.NewEncoder(w).Encode(AdminBotDeleteResponse{OK: false, Error: "INTERNAL_ERROR"})
-			return
-		}
-		if _, err := tx.Exec(`DELETE FROM player_ip_associations WHERE player_id = $1`, resolvedPlayerID); err != nil {
-			tx.Rollback()
-			json.NewEncoder(w).Encode(AdminBotDeleteResponse{OK: false, Error: "INTERNAL_ERROR"})
-			return
-		}
-		if _, err := tx.Exec(`DELETE FROM players WHERE player_id = $1`, resolvedPlayerID); err != nil {
-			tx.Rollback()
-			json.NewEncoder(w).Encode(AdminBotDeleteResponse{OK: false, Error: "INTERNAL_ERROR"})
-			return
-		}
-		if err := tx.Commit(); err != nil {
-			json.NewEncoder(w).Encode(AdminBotDeleteResponse{OK: false, Error: "INTERNAL_ERROR"})
-			return
+	}
+	for _, query := range []string{
+		`DELETE FROM player_boosts WHERE player_id = $1`,
+		`DELETE FROM player_star_variants WHERE player_id = $1`,
+		`DELETE FROM player_faucet_claims WHERE player_id = $1`,
+		`DELETE FROM player_ip_associations WHERE player_id = $1`,
+		`DELETE FROM players WHERE player_id = $1`,
+	} {
+		if _, err := tx.Exec(query, playerID); err != nil {
+			return err
 		}
-
-		json.NewEncoder(w).Encode(AdminBotDeleteResponse{OK: true, PlayerID: resolvedPlayerID})
-		_ = logAdminAction(db, adminAccount.AccountID, "bot_delete", "player", resolvedPlayerID, "", map[string]interface{}{
-			"accountId": accountID.String,
-			"username":  username,
-		})
 	}
+	return nil
 }
 
 func adminProfileActionHandler(db *sql.DB) http.HandlerFunc {
@@ -1707,46 +1923,50 @@ func adminProfileActionHandler(db *sql.DB) http.HandlerFunc {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
-		adminAccount, ok := requireAdmin(db, w, r)
-		if !ok {
-			return
-		}
 		var req AdminProfileActionRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Username) == "" {
 			json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: false, Error: "INVALID_REQUEST"})
 			return
 		}
-		username := strings.ToLower(strings.TrimSpace(req.Username))
-		if username == strings.ToLower(adminAccount.Username) {
-			json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: false, Error: "CANNOT_TARGET_SELF"})
-			return
-		}
 		action := strings.ToLower(strings.TrimSpace(req.Action))
 		if action != "freeze" && action != "unfreeze" && action != "delete" {
 			json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: false, Error: "INVALID_ACTION"})
 			return
 		}
+		permission := PermFreezeAccounts
+		if action == "delete" {
+			permission = PermDeleteAccounts
+		}
+		adminAccount, ok := requirePermission(db, w, r, permission)
+		if !ok {
+			return
+		}
+		username := strings.ToLower(strings.TrimSpace(req.Username))
+		if username == strings.ToLower(adminAccount.Username) {
+			json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: false, Error: "CANNOT_TARGET_SELF"})
+			return
+		}
 
 		var accountID string
 		var playerID string
 		var role string
+		var frozen bool
 		if err := db.QueryRow(`
-			SELECT account_id, player_id, role
+			SELECT account_id, player_id, role, frozen_at IS NOT NULL
 			FROM accounts
 			WHERE username = $1
-		`, username).Scan(&accountID, &playerID, &role); err != nil {
+		`, username).Scan(&accountID, &playerID, &role, &frozen); err != nil {
 			json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: false, Error: "NOT_FOUND"})
 			return
 		}
 
 		switch action {
 		case "freeze":
-			if isFrozenRole(role) {
+			if frozen {
 				json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: false, Error: "ALREADY_FROZEN"})
 				return
 			}
-			frozenRole := "frozen:" + baseRoleFromRaw(role)
-			if _, err := db.Exec(`UPDATE accounts SET role = $2 WHERE account_id = $1`, accountID, frozenRole); err != nil {
+			if _, err := db.Exec(`UPDATE accounts SET frozen_at = NOW(), frozen_by = $2 WHERE account_id = $1`, accountID, adminAccount.AccountID); err != nil {
 				json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: false, Error: "INTERNAL_ERROR"})
 				return
 			}
@@ -1764,19 +1984,18 @@ func adminProfileActionHandler(db *sql.DB) http.HandlerFunc {
 				},
 			})
 			_ = logAdminAction(db, adminAccount.AccountID, "profile_freeze", "account", accountID, "", map[string]interface{}{
-				"username":     username,
-				"playerId":     playerID,
-				"previousRole": role,
+				"username": username,
+				"playerId": playerID,
+				"role":     normalizeRole(role),
 			})
-			json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: true, Username: username, Role: baseRoleFromRaw(frozenRole), Frozen: true})
+			json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: true, Username: username, Role: normalizeRole(role), Frozen: true})
 			return
 		case "unfreeze":
-			if !isFrozenRole(role) {
+			if !frozen {
 				json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: false, Error: "NOT_FROZEN"})
 				return
 			}
-			baseRole := baseRoleFromRaw(role)
-			if _, err := db.Exec(`UPDATE accounts SET role = $2 WHERE account_id = $1`, accountID, baseRole); err != nil {
+			if _, err := db.Exec(`UPDATE accounts SET frozen_at = NULL, frozen_by = NULL WHERE account_id = $1`, accountID); err != nil {
 				json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: false, Error: "INTERNAL_ERROR"})
 				return
 			}
@@ -1792,89 +2011,74 @@ func adminProfileActionHandler(db *sql.DB) http.HandlerFunc {
 				},
 			})
 			_ = logAdminAction(db, adminAccount.AccountID, "profile_unfreeze", "account", accountID, "", map[string]interface{}{
-				"username":     username,
-				"playerId":     playerID,
-				"previousRole": role,
+				"username": username,
+				"playerId": playerID,
+				"role":     normalizeRole(role),
 			})
-			json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: true, Username: username, Role: baseRole, Frozen: false})
+			json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: true, Username: username, Role: normalizeRole(role), Frozen: false})
 			return
 		case "delete":
-			tx, err := db.Begin()
-			if err != nil {
-				json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: false, Error: "INTERNAL_ERROR"})
-				return
-			}
-			if _, err := tx.Exec(`DELETE FROM refresh_tokens WHERE account_id = $1`, accountID); err != nil {
-				tx.Rollback()
-				json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: false, Error: "INTERNAL_ERROR"})
-				return
-			}
-			if _, err := tx.Exec(`DELETE FROM sessions WHERE account_id = $1`, accountID); err != nil {
-				tx.Rollback()
-				json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: false, Error: "INTERNAL_ERROR"})
-				return
-			}
-			if _, err := tx.Exec(`DELETE FROM notification_reads WHERE account_id = $1`, accountID); err != nil {
-				tx.Rollback()
-				json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: false, Error: "INTERNAL_ERROR"})
-				return
-			}
-			if _, err := tx.Exec(`DELETE FROM accounts WHERE account_id = $1`, accountID); err != nil {
-				tx.Rollback()
-				json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: false, Error: "INTERNAL_ERROR"})
-				return
-			}
-			if _, err := tx.Exec(`DELETE FROM player_boosts WHERE player_id = $1`, playerID); err != nil {
-				tx.Rollback()
-				json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: false, Error: "INTERNAL_ERROR"})
-				return
-			}
-			if _, err := tx.Exec(`DELETE FROM player_star_variants WHERE player_id = $1`, playerID); err != nil {
-				tx.Rollback()
-				json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: false, Error: "INTERNAL_ERROR"})
-				return
-			}
-			if _, err := tx.Exec(`DELETE FROM player_faucet_claims WHERE player_id = $1`, playerID); err != nil {
-				tx.Rollback()
-				json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: false, Error: "INTERNAL_ERROR"})
-				return
-			}
-			if _, err := tx.Exec(`DELETE FROM player_ip_associations WHERE player_id = $1`, playerID); err != nil {
-				tx.Rollback()
-				json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: false, Error: "INTERNAL_ERROR"})
-				return
-			}
-			if _, err := tx.Exec(`DELETE FROM players WHERE player_id = $1`, playerID); err != nil {
-				tx.Rollback()
-				json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: false, Error: "INTERNAL_ERROR"})
+			pending, errCode := submitAdminAction(db, adminAccount.AccountID, PendingActionAccountDelete, map[string]interface{}{
+				"accountId": accountID,
+				"username":  username,
+			}, strings.TrimSpace(req.Reason))
+			if errCode != "" {
+				json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: false, Error: errCode})
 				return
 			}
-			if err := tx.Commit(); err != nil {
-				json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: false, Error: "INTERNAL_ERROR"})
-				return
-			}
-			emitNotification(db, NotificationInput{
-				RecipientRole: NotificationRoleAdmin,
-				Category:      NotificationCategoryAdmin,
-				Type:          "profile_deleted",
-				Priority:      NotificationPriorityHigh,
-				Message:       "Profile deleted: @" + username,
-				Payload: map[string]interface{}{
-					"username": username,
-					"action":   "delete",
-				},
-			})
-			_ = logAdminAction(db, adminAccount.AccountID, "profile_delete", "account", accountID, "", map[string]interface{}{
-				"username":     username,
-				"playerId":     playerID,
-				"previousRole": role,
-			})
-			json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: true, Username: username})
+			json.NewEncoder(w).Encode(AdminProfileActionResponse{OK: true, Username: username, PendingAction: pending})
 			return
 		}
 	}
 }
 
+func executeAccountDelete(db *sql.DB, action PendingAdminAction) string {
+	accountID := pendingPayloadString(action.Payload, "accountId")
+	var username string
+	var playerID string
+	var role string
+	err := db.QueryRow(`
+		SELECT username, player_id, role
+		FROM accounts
+		WHERE account_id = $1
+	`, accountID).Scan(&username, &playerID, &role)
+	if err == sql.ErrNoRows {
+		return "NOT_FOUND"
+	}
+	if err != nil {
+		return "INTERNAL_ERROR"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "INTERNAL_ERROR"
+	}
+	if err := purgeAccount(tx, accountID, playerID); err != nil {
+		tx.Rollback()
+		return "INTERNAL_ERROR"
+	}
+	if err := tx.Commit(); err != nil {
+		return "INTERNAL_ERROR"
+	}
+	emitNotification(db, NotificationInput{
+		RecipientRole: NotificationRoleAdmin,
+		Category:      NotificationCategoryAdmin,
+		Type:          "profile_deleted",
+		Priority:      NotificationPriorityHigh,
+		Message:       "Profile deleted: @" + username,
+		Payload: map[string]interface{}{
+			"username": username,
+			"action":   "delete",
+		},
+	})
+	_ = logAdminAction(db, action.RequestedBy, "profile_delete", "account", accountID, action.Reason, pendingActionAuditDetails(action, map[string]interface{}{
+		"username":     username,
+		"playerId":     playerID,
+		"previousRole": role,
+	}))
+	return ""
+}
+
 func isHumanSessionActive(db *sql.DB, accountID string, lastActive time.Time) (bool, error) {
 	windowSeconds := 600
 	if raw := strings.TrimSpace(os.Getenv("BOT_TOGGLE_ACTIVE_WINDOW_SECONDS")); raw != "" {
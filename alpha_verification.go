@@ -11,7 +11,7 @@ func emitServerTelemetry(db *sql.DB, accountID *string, playerID string, eventTy
 	if db == nil || eventType == "" {
 		return
 	}
-	if !featureFlags.Telemetry {
+	if !currentFeatureFlags().Telemetry {
 		log.Println("telemetry disabled:", eventType, payload)
 		return
 	}
@@ -138,11 +138,11 @@ func verifyDailyPlayability(db *sql.DB, playerID string, accountID *string) {
 	coinsInCirculation := economy.CoinsInCirculation()
 	secondsRemaining := seasonSecondsRemaining(now)
 	currentPrice := ComputeStarPrice(coinsInCirculation, secondsRemaining)
-	canBuyStar := featureFlags.SinksEnabled && coins >= int64(currentPrice)
+	canBuyStar := currentFeatureFlags().SinksEnabled && coins >= int64(currentPrice)
 
 	canClaimDaily := false
 	canClaimActivity := false
-	if featureFlags.FaucetsEnabled && remainingCap > 0 {
+	if currentFeatureFlags().FaucetsEnabled && remainingCap > 0 {
 		params := economy.Calibration()
 		activityWindow := ActiveActivityWindow()
 		isActive := now.Sub(lastActive) <= activityWindow
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Personal API tokens let bots and community tools call the API without a
+// password login. A token is sent as "Authorization: Bearer tmc_pat_..." and
+// carries a fixed set of scopes. Handlers opt in with requireScopedSession;
+// every other authenticated endpoint (requireSession, requirePermission,
+// session and token management) refuses API tokens outright.
+const (
+	ScopeReadLeaderboard = "read:leaderboard"
+	ScopeReadPlayer      = "read:player"
+	ScopeTradeStars      = "trade:stars"
+
+	apiTokenPrefix        = "tmc_pat_"
+	apiTokenDefaultTTL    = 90 * 24 * time.Hour
+	apiTokenMaxTTLDays    = 365
+	apiTokenMaxPerAccount = 20
+	apiTokenTouchInterval = time.Minute
+)
+
+type APIScopeDefinition struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+}
+
+var apiScopeCatalog = []APIScopeDefinition{
+	{ScopeReadLeaderboard, "Read leaderboards, including your own position"},
+	{ScopeReadPlayer, "Read your player state and profile"},
+	{ScopeTradeStars, "Quote and buy stars with your coins"},
+}
+
+// APITokenGrant is set on an Account that authenticated with an API token.
+type APITokenGrant struct {
+	TokenID string
+	Scopes  []string
+}
+
+func (g *APITokenGrant) HasScope(scope string) bool {
+	for _, s := range g.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type APIToken struct {
+	TokenID    string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	LastUsedIP string     `json:"lastUsedIp,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+
+type APITokenCreateRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expiresInDays,omitempty"`
+}
+
+type APITokenRevokeRequest struct {
+	ID string `json:"id"`
+}
+
+type APITokensResponse struct {
+	OK     bool                 `json:"ok"`
+	Error  string               `json:"error,omitempty"`
+	Tokens []APIToken           `json:"tokens,omitempty"`
+	Scopes []APIScopeDefinition `json:"scopes,omitempty"`
+	Token  *APIToken            `json:"token,omitempty"`
+	// Secret is the bearer value. It is only returned by create.
+	Secret string `json:"secret,omitempty"`
+}
+
+func isAPIToken(token string) bool {
+	return strings.HasPrefix(token, apiTokenPrefix)
+}
+
+func normalizeAPIScopes(scopes []string) ([]string, error) {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if scope == "" || seen[scope] {
+			continue
+		}
+		known := false
+		for _, def := range apiScopeCatalog {
+			if def.Key == scope {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, errors.New("INVALID_SCOPE")
+		}
+		seen[scope] = true
+		normalized = append(normalized, scope)
+	}
+	if len(normalized) == 0 {
+		return nil, errors.New("INVALID_SCOPE")
+	}
+	return normalized, nil
+}
+
+func createAPIToken(db *sql.DB, accountID string, name string, scopes []string, ttl time.Duration) (*APIToken, string, error) {
+	var active int
+	if err := db.QueryRow(`
+		SELECT COUNT(*)
+		FROM api_tokens
+		WHERE account_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+	`, accountID).Scan(&active); err != nil {
+		return nil, "", err
+	}
+	if active >= apiTokenMaxPerAccount {
+		return nil, "", errors.New("TOO_MANY_TOKENS")
+	}
+
+	tokenID, err := randomToken(9)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	secret = apiTokenPrefix + secret
+	token := &APIToken{
+		TokenID:   "t_" + tokenID,
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: time.Now().UTC().Add(ttl),
+	}
+	_, err = db.Exec(`
+		INSERT INTO api_tokens (token_id, account_id, name, token_hash, scopes, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, token.TokenID, accountID, name, hashToken(secret), pq.Array(scopes), token.CreatedAt, token.ExpiresAt)
+	if err != nil {
+		return nil, "", err
+	}
+	return token, secret, nil
+}
+
+func listAPITokens(db *sql.DB, accountID string) ([]APIToken, error) {
+	rows, err := db.Query(`
+		SELECT token_id, name, scopes, created_at, expires_at, last_used_at, COALESCE(last_used_ip, ''), revoked_at
+		FROM api_tokens
+		WHERE account_id = $1
+		ORDER BY created_at DESC
+	`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		var token APIToken
+		var lastUsed, revoked sql.NullTime
+		if err := rows.Scan(&token.TokenID, &token.Name, pq.Array(&token.Scopes), &token.CreatedAt, &token.ExpiresAt, &lastUsed, &token.LastUsedIP, &revoked); err != nil {
+			return nil, err
+		}
+		if lastUsed.Valid {
+			token.LastUsedAt = &lastUsed.Time
+		}
+		if revoked.Valid {
+			token.RevokedAt = &revoked.Time
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func revokeAPIToken(db *sql.DB, accountID string, tokenID string) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE api_tokens
+		SET revoked_at = NOW()
+		WHERE token_id = $1 AND account_id = $2 AND revoked_at IS NULL
+	`, tokenID, accountID)
+	if err != nil {
+		return false, err
+	}
+	affected, _ := res.RowsAffected()
+	return affected > 0, nil
+}
+
+// authenticateAPIToken resolves a bearer API token to its account and grant.
+func authenticateAPIToken(db *sql.DB, secret string, ip string) (*Account, error) {
+	var tokenID, accountID string
+	var scopes []string
+	var expiresAt time.Time
+	var revokedAt, lastUsedAt sql.NullTime
+	err := db.QueryRow(`
+		SELECT token_id, account_id, scopes, expires_at, revoked_at, last_used_at
+		FROM api_tokens
+		WHERE token_hash = $1
+	`, hashToken(secret)).Scan(&tokenID, &accountID, pq.Array(&scopes), &expiresAt, &revokedAt, &lastUsedAt)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("INVALID_TOKEN")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		return nil, errors.New("TOKEN_REVOKED")
+	}
+	if time.Now().UTC().After(expiresAt) {
+		return nil, errors.New("TOKEN_EXPIRED")
+	}
+	account, err := loadAccountByID(db, accountID)
+	if err != nil {
+		return nil, err
+	}
+	account.APIToken = &APITokenGrant{TokenID: tokenID, Scopes: scopes}
+	if !lastUsedAt.Valid || time.Since(lastUsedAt.Time) > apiTokenTouchInterval {
+		if _, err := db.Exec(`
+			UPDATE api_tokens
+			SET last_used_at = NOW(), last_used_ip = $2
+			WHERE token_id = $1
+		`, tokenID, ip); err != nil {
+			log.Println("api token: touch failed:", err)
+		}
+	}
+	return account, nil
+}
+
+// requireScopedSession is requireSession for endpoints that API tokens may
+// call. Cookie and access-token sessions pass as usual; an API token must
+// carry scope.
+func requireScopedSession(db *sql.DB, w http.ResponseWriter, r *http.Request, scope string) (*Account, bool) {
+	account, _, err := getSessionAccount(db, r)
+	if err != nil || account == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil, false
+	}
+	if account.APIToken != nil && !account.APIToken.HasScope(scope) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "INSUFFICIENT_SCOPE"})
+		return nil, false
+	}
+	return account, true
+}
+
+// optionalScopedSession resolves the caller on endpoints that also serve
+// anonymous visitors. An API token without scope is treated as anonymous, so
+// it never unlocks personalized data it was not granted.
+func optionalScopedSession(db *sql.DB, r *http.Request, scope string) *Account {
+	account, _, err := getSessionAccount(db, r)
+	if err != nil || account == nil {
+		return nil
+	}
+	if account.APIToken != nil && !account.APIToken.HasScope(scope) {
+		return nil
+	}
+	return account
+}
+
+// rejectAPIToken answers 403 for API token callers on endpoints that only a
+// signed-in user may use.
+func rejectAPIToken(w http.ResponseWriter, account *Account) bool {
+	if account == nil || account.APIToken == nil {
+		return false
+	}
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "API_TOKEN_NOT_ALLOWED"})
+	return true
+}
+
+func apiTokensHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		account, ok := requireSession(db, w, r)
+		if !ok {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			tokens, err := listAPITokens(db, account.AccountID)
+			if err != nil {
+				json.NewEncoder(w).Encode(APITokensResponse{OK: false, Error: "INTERNAL_ERROR"})
+				return
+			}
+			json.NewEncoder(w).Encode(APITokensResponse{OK: true, Tokens: tokens, Scopes: apiScopeCatalog})
+		case http.MethodPost:
+			var req APITokenCreateRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				json.NewEncoder(w).Encode(APITokensResponse{OK: false, Error: "INVALID_REQUEST"})
+				return
+			}
+			name := strings.TrimSpace(req.Name)
+			if name == "" || len(name) > 64 {
+				json.NewEncoder(w).Encode(APITokensResponse{OK: false, Error: "INVALID_NAME"})
+				return
+			}
+			scopes, err := normalizeAPIScopes(req.Scopes)
+			if err != nil {
+				json.NewEncoder(w).Encode(APITokensResponse{OK: false, Error: err.Error()})
+				return
+			}
+			ttl := apiTokenDefaultTTL
+			if req.ExpiresInDays != 0 {
+				if req.ExpiresInDays < 1 || req.ExpiresInDays > apiTokenMaxTTLDays {
+					json.NewEncoder(w).Encode(APITokensResponse{OK: false, Error: "INVALID_EXPIRY"})
+					return
+				}
+				ttl = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+			}
+			token, secret, err := createAPIToken(db, account.AccountID, name, scopes, ttl)
+			if err != nil {
+				if err.Error() == "TOO_MANY_TOKENS" {
+					json.NewEncoder(w).Encode(APITokensResponse{OK: false, Error: err.Error()})
+					return
+				}
+				log.Println("api token: create failed:", err)
+				json.NewEncoder(w).Encode(APITokensResponse{OK: false, Error: "INTERNAL_ERROR"})
+				return
+			}
+			json.NewEncoder(w).Encode(APITokensResponse{OK: true, Token: token, Secret: secret})
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func revokeAPITokenHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		account, ok := requireSession(db, w, r)
+		if !ok {
+			return
+		}
+		var req APITokenRevokeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.ID) == "" {
+			json.NewEncoder(w).Encode(APITokensResponse{OK: false, Error: "INVALID_REQUEST"})
+			return
+		}
+		found, err := revokeAPIToken(db, account.AccountID, strings.TrimSpace(req.ID))
+		if err != nil {
+			json.NewEncoder(w).Encode(APITokensResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if !found {
+			json.NewEncoder(w).Encode(APITokensResponse{OK: false, Error: "NOT_FOUND"})
+			return
+		}
+		json.NewEncoder(w).Encode(APITokensResponse{OK: true})
+	}
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Destructive and economy-affecting admin actions go through a two-person
+// queue. The requesting admin files the action; a different admin holding the
+// same permission must approve it before it expires, and only then does it
+// run. Every step is written to admin_audit_log.
+const (
+	PendingActionAccountDelete    = "account_delete"
+	PendingActionBotDelete        = "bot_delete"
+	PendingActionRoleChange       = "role_change"
+	PendingActionEmissionOverride = "emission_override"
+	PendingActionTokenKeyRetire   = "token_key_retire"
+
+	PendingStatusPending   = "pending"
+	PendingStatusExecuting = "executing"
+	PendingStatusExecuted  = "executed"
+	PendingStatusFailed    = "failed"
+	PendingStatusRejected  = "rejected"
+	PendingStatusCancelled = "cancelled"
+	PendingStatusExpired   = "expired"
+
+	pendingActionExpiryInterval = 30 * time.Second
+	// An approved action still marked executing after this long was cut off
+	// mid-run (a crash or restart) and is marked failed for an admin to check.
+	pendingActionExecutionTimeout = 10 * time.Minute
+)
+
+type PendingAdminAction struct {
+	ID             int64                  `json:"id"`
+	ActionType     string                 `json:"actionType"`
+	Payload        map[string]interface{} `json:"payload"`
+	Reason         string                 `json:"reason,omitempty"`
+	RequestedBy    string                 `json:"requestedBy"`
+	Status         string                 `json:"status"`
+	CreatedAt      time.Time              `json:"createdAt"`
+	ExpiresAt      time.Time              `json:"expiresAt"`
+	DecidedBy      string                 `json:"decidedBy,omitempty"`
+	DecidedAt      *time.Time             `json:"decidedAt,omitempty"`
+	DecisionReason string                 `json:"decisionReason,omitempty"`
+	ResultError    string                 `json:"resultError,omitempty"`
+}
+
+type pendingActionSpec struct {
+	Permission string
+	Label      string
+	Execute    func(db *sql.DB, action PendingAdminAction) string
+}
+
+var pendingActionSpecs = map[string]pendingActionSpec{
+	PendingActionAccountDelete:    {Permission: PermDeleteAccounts, Label: "Delete account", Execute: executeAccountDelete},
+	PendingActionBotDelete:        {Permission: PermManageBots, Label: "Delete bot", Execute: executeBotDelete},
+	PendingActionRoleChange:       {Permission: PermManageRoles, Label: "Change role", Execute: executeRoleChange},
+	PendingActionEmissionOverride: {Permission: PermManageEconomy, Label: "Override emission", Execute: executeEmissionOverride},
+	PendingActionTokenKeyRetire:   {Permission: PermManageTokenKeys, Label: "Retire token signing key", Execute: executeTokenKeyRetire},
+}
+
+// adminApprovalRequired lets single-admin development setups run queued
+// actions straight away with ADMIN_APPROVAL_REQUIRED=false.
+func adminApprovalRequired() bool {
+	raw := strings.ToLower(strings.TrimSpace(os.Getenv("ADMIN_APPROVAL_REQUIRED")))
+	return raw != "false" && raw != "0" && raw != "no"
+}
+
+func adminApprovalWindow() time.Duration {
+	minutes := parseEnvInt("ADMIN_APPROVAL_WINDOW_MINUTES", 60)
+	if minutes <= 0 {
+		minutes = 60
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+func pendingPayloadString(payload map[string]interface{}, key string) string {
+	value, _ := payload[key].(string)
+	return value
+}
+
+func pendingPayloadFloat(payload map[string]interface{}, key string) float64 {
+	value, _ := payload[key].(float64)
+	return value
+}
+
+// pendingActionAuditDetails tags the audit entry of an executed action with
+// the queue entry and the approving admin.
+func pendingActionAuditDetails(action PendingAdminAction, details map[string]interface{}) map[string]interface{} {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	if action.ID != 0 {
+		details["pendingActionId"] = action.ID
+		details["approvedBy"] = action.DecidedBy
+	}
+	return details
+}
+
+// submitAdminAction queues an action for approval, or runs it at once when
+// approval is switched off. A nil action with an empty code means it ran.
+func submitAdminAction(db *sql.DB, requestedBy string, actionType string, payload map[string]interface{}, reason string) (*PendingAdminAction, string) {
+	spec, ok := pendingActionSpecs[actionType]
+	if !ok {
+		return nil, "INVALID_ACTION"
+	}
+	if !adminApprovalRequired() {
+		return nil, spec.Execute(db, PendingAdminAction{
+			ActionType:  actionType,
+			Payload:     payload,
+			Reason:      reason,
+			RequestedBy: requestedBy,
+		})
+	}
+	if reason == "" {
+		return nil, "REASON_REQUIRED"
+	}
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return nil, "INTERNAL_ERROR"
+	}
+
+	now := time.Now().UTC()
+	action := PendingAdminAction{
+		ActionType:  actionType,
+		Payload:     payload,
+		Reason:      reason,
+		RequestedBy: requestedBy,
+		Status:      PendingStatusPending,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(adminApprovalWindow()),
+	}
+	if err := db.QueryRow(`
+		INSERT INTO admin_pending_actions (action_type, payload, reason, requested_by, status, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, actionType, string(encoded), reason, requestedBy, PendingStatusPending, now, action.ExpiresAt).Scan(&action.ID); err != nil {
+		return nil, "INTERNAL_ERROR"
+	}
+
+	_ = logAdminAction(db, requestedBy, "pending_action_request", "pending_action", strconv.FormatInt(action.ID, 10), reason, map[string]interface{}{
+		"actionType": actionType,
+		"payload":    payload,
+		"expiresAt":  action.ExpiresAt.Format(time.RFC3339),
+	})
+	emitNotification(db, NotificationInput{
+		RecipientRole: NotificationRoleAdmin,
+		Category:      NotificationCategoryAdmin,
+		Type:          "approval_requested",
+		Priority:      NotificationPriorityHigh,
+		Message:       spec.Label + " is waiting for a second admin's approval. Reason: " + reason,
+		Link:          "#/admin",
+		Payload: map[string]interface{}{
+			"pendingActionId": action.ID,
+			"actionType":      actionType,
+			"requestedBy":     requestedBy,
+		},
+	})
+	return &action, ""
+}
+
+const pendingActionColumns = `
+	id, action_type, payload, COALESCE(reason, ''), requested_by, status, created_at, expires_at,
+	COALESCE(decided_by, ''), decided_at, COALESCE(decision_reason, ''), COALESCE(result_error, '')
+`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPendingAdminAction(row rowScanner) (PendingAdminAction, error) {
+	var action PendingAdminAction
+	var payload []byte
+	var decidedAt sql.NullTime
+	if err := row.Scan(&action.ID, &action.ActionType, &payload, &action.Reason, &action.RequestedBy, &action.Status, &action.CreatedAt, &action.ExpiresAt,
+		&action.DecidedBy, &decidedAt, &action.DecisionReason, &action.ResultError); err != nil {
+		return action, err
+	}
+	action.Payload = map[string]interface{}{}
+	_ = json.Unmarshal(payload, &action.Payload)
+	if decidedAt.Valid {
+		value := decidedAt.Time.UTC()
+		action.DecidedAt = &value
+	}
+	return action, nil
+}
+
+func loadPendingAdminAction(db *sql.DB, id int64) (PendingAdminAction, error) {
+	return scanPendingAdminAction(db.QueryRow(`SELECT `+pendingActionColumns+` FROM admin_pending_actions WHERE id = $1`, id))
+}
+
+func listPendingAdminActions(db *sql.DB, status string, limit int) ([]PendingAdminAction, error) {
+	query := `SELECT ` + pendingActionColumns + ` FROM admin_pending_actions`
+	args := []interface{}{}
+	if status != "" {
+		query += ` WHERE status = $1`
+		args = append(args, status)
+	}
+	query += ` ORDER BY created_at DESC LIMIT ` + strconv.Itoa(limit)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	actions := []PendingAdminAction{}
+	for rows.Next() {
+		action, err := scanPendingAdminAction(rows)
+		if err != nil {
+			continue
+		}
+		actions = append(actions, action)
+	}
+	return actions, rows.Err()
+}
+
+// decidePendingAdminAction moves a pending entry to status. The status check
+// in the WHERE clause makes sure two admins cannot both decide it.
+func decidePendingAdminAction(db *sql.DB, id int64, status string, decidedBy string, reason string) (bool, error) {
+	result, err := db.Exec(`
+		UPDATE admin_pending_actions
+		SET status = $2, decided_by = $3, decided_at = NOW(), decision_reason = NULLIF($4, '')
+		WHERE id = $1 AND status = 'pending' AND expires_at > NOW()
+	`, id, status, decidedBy, reason)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+func expirePendingAdminActions(db *sql.DB) {
+	rows, err := db.Query(`
+		UPDATE admin_pending_actions
+		SET status = 'expired', decided_at = NOW()
+		WHERE status = 'pending' AND expires_at <= NOW()
+		RETURNING id, action_type, requested_by
+	`)
+	if err != nil {
+		log.Println("pending admin action expiry failed:", err)
+		return
+	}
+	type expiredAction struct {
+		ID          int64
+		ActionType  string
+		RequestedBy string
+	}
+	expired := []expiredAction{}
+	for rows.Next() {
+		var item expiredAction
+		if err := rows.Scan(&item.ID, &item.ActionType, &item.RequestedBy); err == nil {
+			expired = append(expired, item)
+		}
+	}
+	rows.Close()
+
+	for _, item := range expired {
+		_ = logAdminAction(db, item.RequestedBy, "pending_action_expire", "pending_action", strconv.FormatInt(item.ID, 10), "", map[string]interface{}{
+			"actionType": item.ActionType,
+		})
+	}
+
+	rows, err = db.Query(`
+		UPDATE admin_pending_actions
+		SET status = 'failed', result_error = 'EXECUTION_INTERRUPTED'
+		WHERE status = 'executing' AND decided_at <= NOW() - ($1 * INTERVAL '1 second')
+		RETURNING id, action_type, COALESCE(decided_by, '')
+	`, int64(pendingActionExecutionTimeout/time.Second))
+	if err != nil {
+		log.Println("pending admin action interrupt check failed:", err)
+		return
+	}
+	interrupted := []expiredAction{}
+	for rows.Next() {
+		var item expiredAction
+		if err := rows.Scan(&item.ID, &item.ActionType, &item.RequestedBy); err == nil {
+			interrupted = append(interrupted, item)
+		}
+	}
+	rows.Close()
+
+	for _, item := range interrupted {
+		_ = logAdminAction(db, item.RequestedBy, "pending_action_failed", "pending_action", strconv.FormatInt(item.ID, 10), "", map[string]interface{}{
+			"actionType": item.ActionType,
+			"error":      "EXECUTION_INTERRUPTED",
+		})
+	}
+}
+
+// finishPendingAdminAction records the outcome of an action claimed as
+// executing.
+func finishPendingAdminAction(db *sql.DB, id int64, errCode string) error {
+	status := PendingStatusExecuted
+	if errCode != "" {
+		status = PendingStatusFailed
+	}
+	_, err := db.Exec(`
+		UPDATE admin_pending_actions
+		SET status = $2, result_error = NULLIF($3, '')
+		WHERE id = $1 AND status = 'executing'
+	`, id, status, errCode)
+	return err
+}
+
+func startPendingActionExpiry(db *sql.DB) {
+	go func() {
+		ticker := time.NewTicker(pendingActionExpiryInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if isLeaderInstance() {
+				expirePendingAdminActions(db)
+			}
+		}
+	}()
+}
+
+type AdminApprovalRequest struct {
+	ID       int64  `json:"id"`
+	Decision string `json:"decision"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type AdminApprovalsResponse struct {
+	OK      bool                 `json:"ok"`
+	Error   string               `json:"error,omitempty"`
+	Actions []PendingAdminAction `json:"actions,omitempty"`
+	Action  *PendingAdminAction  `json:"action,omitempty"`
+}
+
+func adminApprovalsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		admin, ok := requirePermission(db, w, r, PermApproveActions)
+		if !ok {
+			return
+		}
+		if r.Method == http.MethodGet {
+			status := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("status")))
+			if status == "" {
+				status = PendingStatusPending
+			}
+			if status == "all" {
+				status = ""
+			}
+			limit := parsePositiveInt(r.URL.Query().Get("limit"), 50)
+			if limit > 200 {
+				limit = 200
+			}
+			actions, err := listPendingAdminActions(db, status, limit)
+			if err != nil {
+				json.NewEncoder(w).Encode(AdminApprovalsResponse{OK: false, Error: "INTERNAL_ERROR"})
+				return
+			}
+			json.NewEncoder(w).Encode(AdminApprovalsResponse{OK: true, Actions: actions})
+			return
+		}
+
+		var req AdminApprovalRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID <= 0 {
+			json.NewEncoder(w).Encode(AdminApprovalsResponse{OK: false, Error: "INVALID_REQUEST"})
+			return
+		}
+		decision := strings.ToLower(strings.TrimSpace(req.Decision))
+		reason := strings.TrimSpace(req.Reason)
+		action, err := loadPendingAdminAction(db, req.ID)
+		if err == sql.ErrNoRows {
+			json.NewEncoder(w).Encode(AdminApprovalsResponse{OK: false, Error: "NOT_FOUND"})
+			return
+		}
+		if err != nil {
+			json.NewEncoder(w).Encode(AdminApprovalsResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if action.Status != PendingStatusPending {
+			json.NewEncoder(w).Encode(AdminApprovalsResponse{OK: false, Error: "NOT_PENDING"})
+			return
+		}
+		if !time.Now().Before(action.ExpiresAt) {
+			json.NewEncoder(w).Encode(AdminApprovalsResponse{OK: false, Error: "EXPIRED"})
+			return
+		}
+		spec, ok := pendingActionSpecs[action.ActionType]
+		if !ok {
+			json.NewEncoder(w).Encode(AdminApprovalsResponse{OK: false, Error: "INVALID_ACTION"})
+			return
+		}
+
+		var status string
+		switch decision {
+		case "approve":
+			if action.RequestedBy == admin.AccountID {
+				json.NewEncoder(w).Encode(AdminApprovalsResponse{OK: false, Error: "SELF_APPROVAL_FORBIDDEN"})
+				return
+			}
+			if !accountHasPermission(db, admin, spec.Permission) {
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(AdminApprovalsResponse{OK: false, Error: "FORBIDDEN"})
+				return
+			}
+			status = PendingStatusExecuting
+		case "reject":
+			if reason == "" {
+				json.NewEncoder(w).Encode(AdminApprovalsResponse{OK: false, Error: "REASON_REQUIRED"})
+				return
+			}
+			status = PendingStatusRejected
+		case "cancel":
+			if action.RequestedBy != admin.AccountID {
+				json.NewEncoder(w).Encode(AdminApprovalsResponse{OK: false, Error: "NOT_REQUESTER"})
+				return
+			}
+			status = PendingStatusCancelled
+		default:
+			json.NewEncoder(w).Encode(AdminApprovalsResponse{OK: false, Error: "INVALID_DECISION"})
+			return
+		}
+
+		claimed, err := decidePendingAdminAction(db, action.ID, status, admin.AccountID, reason)
+		if err != nil {
+			json.NewEncoder(w).Encode(AdminApprovalsResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if !claimed {
+			json.NewEncoder(w).Encode(AdminApprovalsResponse{OK: false, Error: "NOT_PENDING"})
+			return
+		}
+		action.Status = status
+		action.DecidedBy = admin.AccountID
+
+		scopeID := strconv.FormatInt(action.ID, 10)
+		_ = logAdminAction(db, admin.AccountID, "pending_action_"+decision, "pending_action", scopeID, reason, map[string]interface{}{
+			"actionType":  action.ActionType,
+			"requestedBy": action.RequestedBy,
+		})
+
+		// The entry is claimed as executing before the action runs and only
+		// marked executed or failed once it returns, so a crash in between
+		// never leaves an entry that claims to have run. The requester must
+		// still hold the permission they filed the action under.
+		if decision == "approve" {
+			errCode := ""
+			requester, err := loadAccountByID(db, action.RequestedBy)
+			if err != nil || !accountHasPermission(db, requester, spec.Permission) {
+				errCode = "REQUESTER_NOT_AUTHORIZED"
+			} else {
+				errCode = spec.Execute(db, action)
+			}
+			if err := finishPendingAdminAction(db, action.ID, errCode); err != nil {
+				log.Println("pending admin action: recording outcome failed:", err)
+			}
+			action.Status = PendingStatusExecuted
+			if errCode != "" {
+				_ = logAdminAction(db, admin.AccountID, "pending_action_failed", "pending_action", scopeID, "", map[string]interface{}{
+					"actionType": action.ActionType,
+					"error":      errCode,
+				})
+				action.Status = PendingStatusFailed
+				action.ResultError = errCode
+			}
+		}
+
+		updated, err := loadPendingAdminAction(db, action.ID)
+		if err == nil {
+			action = updated
+		}
+		json.NewEncoder(w).Encode(AdminApprovalsResponse{OK: action.Status != PendingStatusFailed, Error: action.ResultError, Action: &action})
+	}
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/subtle"
@@ -18,9 +17,10 @@ import (
 )
 
 const (
-	sessionTTL      = 7 * 24 * time.Hour
-	accessTokenTTL  = 30 * time.Minute
-	refreshTokenTTL = 60 * 24 * time.Hour
+	sessionTTL       = 7 * 24 * time.Hour
+	accessTokenTTL   = 30 * time.Minute
+	refreshTokenTTL  = 60 * 24 * time.Hour
+	passwordResetTTL = 1 * time.Hour
 )
 
 type Account struct {
@@ -37,6 +37,11 @@ type Account struct {
 	AdminKeyHash       string
 	Role               string
 	MustChangePassword bool
+	TwoFactorEnabled   bool
+	EmailVerified      bool
+	// APIToken is set when the request authenticated with a personal API
+	// token rather than a login.
+	APIToken *APITokenGrant
 }
 
 func createAccount(db *sql.DB, username string, password string, displayName string, email string) (*Account, error) {
@@ -44,9 +49,6 @@ func createAccount(db *sql.DB, username string, password string, displayName str
 	if len(username) < 3 || len(username) > 32 {
 		return nil, errors.New("INVALID_USERNAME")
 	}
-	if len(password) < 8 || len(password) > 128 {
-		return nil, errors.New("INVALID_PASSWORD")
-	}
 	normalizedEmail, err := normalizeEmail(email)
 	if err != nil {
 		return nil, err
@@ -54,6 +56,9 @@ func createAccount(db *sql.DB, username string, password string, displayName str
 	if displayName == "" {
 		displayName = username
 	}
+	if err := checkPasswordPolicy(password, username, displayName); err != nil {
+		return nil, err
+	}
 
 	hash, err := hashPassword(password)
 	if err != nil {
@@ -105,6 +110,7 @@ func authenticate(db *sql.DB, username string, password string) (*Account, error
 	var adminKey sql.NullString
 	var role string
 	var mustChangePassword bool
+	var frozen bool
 	var email sql.NullString
 	var bio sql.NullString
 	var pronouns sql.NullString
@@ -113,16 +119,16 @@ func authenticate(db *sql.DB, username string, password string) (*Account, error
 	var avatarURL sql.NullString
 	if err := db.QueryRow(`
 		SELECT account_id, username, display_name, player_id, password_hash, admin_key_hash, role, must_change_password, email,
-			bio, pronouns, location, website, avatar_url
+			bio, pronouns, location, website, avatar_url, frozen_at IS NOT NULL, totp_enabled_at IS NOT NULL
 		FROM accounts
 		WHERE username = $1
-	`, username).Scan(&account.AccountID, &account.Username, &account.DisplayName, &account.PlayerID, &hash, &adminKey, &role, &mustChangePassword, &email, &bio, &pronouns, &location, &website, &avatarURL); err != nil {
+	`, username).Scan(&account.AccountID, &account.Username, &account.DisplayName, &account.PlayerID, &hash, &adminKey, &role, &mustChangePassword, &email, &bio, &pronouns, &location, &website, &avatarURL, &frozen, &account.TwoFactorEnabled); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errors.New("INVALID_CREDENTIALS")
 		}
 		return nil, err
 	}
-	if isFrozenRole(role) {
+	if frozen {
 		return nil, errors.New("ACCOUNT_FROZEN")
 	}
 	if email.Valid {
@@ -162,17 +168,18 @@ func authenticate(db *sql.DB, username string, password string) (*Account, error
 	return &account, nil
 }
 
-func createSession(db *sql.DB, accountID string) (string, time.Time, error) {
+func createSession(db *sql.DB, accountID string, userAgent string, ip string) (string, time.Time, error) {
 	sessionID, err := randomToken(24)
 	if err != nil {
 		return "", time.Time{}, err
 	}
 
-	expiresAt := time.Now().UTC().Add(sessionTTL)
+	now := time.Now().UTC()
+	expiresAt := now.Add(sessionTTL)
 	_, err = db.Exec(`
-		INSERT INTO sessions (session_id, account_id, expires_at)
-		VALUES ($1, $2, $3)
-	`, sessionID, accountID, expiresAt)
+		INSERT INTO sessions (session_id, account_id, expires_at, created_at, last_seen_at, user_agent, ip, public_id)
+		VALUES ($1, $2, $3, $4, $4, $5, $6, $7)
+	`, sessionID, accountID, expiresAt, now, userAgent, ip, sessionPublicID(sessionID))
 	if err != nil {
 		return "", time.Time{}, err
 	}
@@ -187,16 +194,30 @@ func clearSession(db *sql.DB, sessionID string) {
 	`, sessionID)
 }
 
+// getSessionAccount resolves the caller from a bearer token or the session
+// cookie. The session ID is the cookie session, or for an access token the
+// session it was issued for; it is empty for API tokens.
 func getSessionAccount(db *sql.DB, r *http.Request) (*Account, string, error) {
 	if auth := r.Header.Get("Authorization"); strings.HasPrefix(strings.ToLower(auth), "bearer ") {
 		token := strings.TrimSpace(auth[len("bearer "):])
+		if isAPIToken(token) {
+			account, err := authenticateAPIToken(db, token, getClientIP(r))
+			return account, "", err
+		}
 		if token != "" {
-			accountID, err := verifyAccessToken(token)
+			accountID, sessionRef, err := verifyAccessToken(token)
+			if err != nil {
+				return nil, "", err
+			}
+			sessionID, err := accessTokenSession(db, accountID, sessionRef)
+			if err == sql.ErrNoRows {
+				return nil, "", errors.New("SESSION_REVOKED")
+			}
 			if err != nil {
 				return nil, "", err
 			}
 			account, err := loadAccountByID(db, accountID)
-			return account, "", err
+			return account, sessionID, err
 		}
 	}
 
@@ -207,9 +228,11 @@ func getSessionAccount(db *sql.DB, r *http.Request) (*Account, string, error) {
 
 	var account Account
 	var expiresAt time.Time
+	var lastSeenAt time.Time
 	var adminKey sql.NullString
 	var role string
 	var mustChangePassword bool
+	var frozen bool
 	var email sql.NullString
 	var bio sql.NullString
 	var pronouns sql.NullString
@@ -218,14 +241,15 @@ func getSessionAccount(db *sql.DB, r *http.Request) (*Account, string, error) {
 	var avatarURL sql.NullString
 	if err := db.QueryRow(`
 		SELECT a.account_id, a.username, a.display_name, a.player_id, a.admin_key_hash, a.role, a.must_change_password, a.email,
-			a.bio, a.pronouns, a.location, a.website, a.avatar_url, s.expires_at
+			a.bio, a.pronouns, a.location, a.website, a.avatar_url, a.frozen_at IS NOT NULL, a.totp_enabled_at IS NOT NULL, s.expires_at,
+			COALESCE(s.last_seen_at, s.expires_at - INTERVAL '7 days')
 		FROM sessions s
 		JOIN accounts a ON a.account_id = s.account_id
 		WHERE s.session_id = $1
-	`, cookie.Value).Scan(&account.AccountID, &account.Username, &account.DisplayName, &account.PlayerID, &adminKey, &role, &mustChangePassword, &email, &bio, &pronouns, &location, &website, &avatarURL, &expiresAt); err != nil {
+	`, cookie.Value).Scan(&account.AccountID, &account.Username, &account.DisplayName, &account.PlayerID, &adminKey, &role, &mustChangePassword, &email, &bio, &pronouns, &location, &website, &avatarURL, &frozen, &account.TwoFactorEnabled, &expiresAt, &lastSeenAt); err != nil {
 		return nil, "", err
 	}
-	if isFrozenRole(role) {
+	if frozen {
 		return nil, "", errors.New("ACCOUNT_FROZEN")
 	}
 	if email.Valid {
@@ -256,6 +280,9 @@ func getSessionAccount(db *sql.DB, r *http.Request) (*Account, string, error) {
 		clearSession(db, cookie.Value)
 		return nil, "", errors.New("SESSION_EXPIRED")
 	}
+	if time.Since(lastSeenAt) > sessionTouchInterval {
+		touchSession(db, cookie.Value, getClientIP(r))
+	}
 
 	return &account, cookie.Value, nil
 }
@@ -265,6 +292,7 @@ func loadAccountByID(db *sql.DB, accountID string) (*Account, error) {
 	var adminKey sql.NullString
 	var role string
 	var mustChangePassword bool
+	var frozen bool
 	var email sql.NullString
 	var bio sql.NullString
 	var pronouns sql.NullString
@@ -273,13 +301,13 @@ func loadAccountByID(db *sql.DB, accountID string) (*Account, error) {
 	var avatarURL sql.NullString
 	if err := db.QueryRow(`
 		SELECT account_id, username, display_name, player_id, admin_key_hash, role, must_change_password, email,
-			bio, pronouns, location, website, avatar_url
+			bio, pronouns, location, website, avatar_url, frozen_at IS NOT NULL, totp_enabled_at IS NOT NULL
 		FROM accounts
 		WHERE account_id = $1
-	`, accountID).Scan(&account.AccountID, &account.Username, &account.DisplayName, &account.PlayerID, &adminKey, &role, &mustChangePassword, &email, &bio, &pronouns, &location, &website, &avatarURL); err != nil {
+	`, accountID).Scan(&account.AccountID, &account.Username, &account.DisplayName, &account.PlayerID, &adminKey, &role, &mustChangePassword, &email, &bio, &pronouns, &location, &website, &avatarURL, &frozen, &account.TwoFactorEnabled); err != nil {
 		return nil, err
 	}
-	if isFrozenRole(role) {
+	if frozen {
 		return nil, errors.New("ACCOUNT_FROZEN")
 	}
 	if email.Valid {
@@ -339,7 +367,10 @@ func accessTokenSecret() []byte {
 	return []byte(secret)
 }
 
-func issueAccessToken(accountID string, ttl time.Duration) (string, time.Time, error) {
+// issueAccessToken signs a short-lived bearer token for the device behind
+// sessionID. The token names the session by its public ID rather than the
+// session ID itself, which is a bearer secret of its own.
+func issueAccessToken(accountID string, sessionID string, ttl time.Duration) (string, time.Time, error) {
 	if ttl <= 0 {
 		ttl = accessTokenTTL
 	}
@@ -348,55 +379,63 @@ func issueAccessToken(accountID string, ttl time.Duration) (string, time.Time, e
 	if err != nil {
 		return "", time.Time{}, err
 	}
-	payload := accountID + "|" + strconv.FormatInt(expiresAt.Unix(), 10) + "|" + nonce
-	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
-
-	mac := hmac.New(sha256.New, accessTokenSecret())
-	mac.Write([]byte(encoded))
-	sig := hex.EncodeToString(mac.Sum(nil))
-
-	return encoded + "." + sig, expiresAt, nil
-}
-
-func verifyAccessToken(token string) (string, error) {
-	parts := strings.Split(token, ".")
-	if len(parts) != 2 {
-		return "", errors.New("INVALID_TOKEN")
-	}
-	encoded := parts[0]
-	sig := parts[1]
-
-	mac := hmac.New(sha256.New, accessTokenSecret())
-	mac.Write([]byte(encoded))
-	expected := hex.EncodeToString(mac.Sum(nil))
-	if subtle.ConstantTimeCompare([]byte(sig), []byte(expected)) != 1 {
-		return "", errors.New("INVALID_TOKEN")
+	payload := accountID + "|" + strconv.FormatInt(expiresAt.Unix(), 10) + "|" + nonce + "|" + sessionPublicID(sessionID)
+	token, err := signAccessToken(payload)
+	if err != nil {
+		return "", time.Time{}, err
 	}
+	return token, expiresAt, nil
+}
 
-	payloadBytes, err := base64.RawURLEncoding.DecodeString(encoded)
+// verifyAccessToken accepts tokens signed by any key that is not retired and
+// returns the account and the public ID of the session the token belongs to.
+// Tokens without a session reference predate session binding and are refused.
+func verifyAccessToken(token string) (string, string, error) {
+	payload, err := openAccessToken(token)
 	if err != nil {
-		return "", errors.New("INVALID_TOKEN")
+		return "", "", err
 	}
-	partsPayload := strings.Split(string(payloadBytes), "|")
-	if len(partsPayload) < 2 {
-		return "", errors.New("INVALID_TOKEN")
+	partsPayload := strings.Split(payload, "|")
+	if len(partsPayload) < 4 || partsPayload[3] == "" {
+		return "", "", errors.New("INVALID_TOKEN")
 	}
 	accountID := partsPayload[0]
 	exp, err := strconv.ParseInt(partsPayload[1], 10, 64)
 	if err != nil {
-		return "", errors.New("INVALID_TOKEN")
+		return "", "", errors.New("INVALID_TOKEN")
 	}
 	if time.Now().UTC().After(time.Unix(exp, 0)) {
-		return "", errors.New("TOKEN_EXPIRED")
+		return "", "", errors.New("TOKEN_EXPIRED")
 	}
-	return accountID, nil
+	return accountID, partsPayload[3], nil
+}
+
+// accessTokenSession returns the session an access token was issued for,
+// found by its public ID, while it is still signed in as a cookie session or
+// a refresh token chain. It returns sql.ErrNoRows once the session is gone,
+// so revoking or logging out a session ends its access tokens at once
+// instead of when they expire.
+func accessTokenSession(db *sql.DB, accountID string, sessionRef string) (string, error) {
+	var sessionID string
+	err := db.QueryRow(`
+		SELECT session_id FROM sessions
+		WHERE public_id = $2 AND account_id = $1 AND expires_at > NOW()
+		UNION ALL
+		SELECT session_id FROM refresh_tokens
+		WHERE session_public_id = $2 AND account_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		LIMIT 1
+	`, accountID, sessionRef).Scan(&sessionID)
+	return sessionID, err
 }
 
 type sqlExecer interface {
 	Exec(query string, args ...interface{}) (sql.Result, error)
 }
 
-func createRefreshToken(db sqlExecer, accountID string, purpose string, userAgent string, ip string) (string, time.Time, error) {
+// createRefreshToken issues a refresh token. sessionID ties it to the cookie
+// session created by the same login, and startedAt carries the time of that
+// login across rotations; a zero startedAt means now.
+func createRefreshToken(db sqlExecer, accountID string, sessionID string, purpose string, userAgent string, ip string, startedAt time.Time) (string, time.Time, error) {
 	if purpose == "" {
 		purpose = "auth"
 	}
@@ -407,6 +446,13 @@ func createRefreshToken(db sqlExecer, accountID string, purpose string, userAgen
 	hash := hashToken(raw)
 	issuedAt := time.Now().UTC()
 	expiresAt := issuedAt.Add(refreshTokenTTL)
+	if startedAt.IsZero() {
+		startedAt = issuedAt
+	}
+	publicID := ""
+	if sessionID != "" {
+		publicID = sessionPublicID(sessionID)
+	}
 	_, err = db.Exec(`
 		INSERT INTO refresh_tokens (
 			account_id,
@@ -415,10 +461,13 @@ func createRefreshToken(db sqlExecer, accountID string, purpose string, userAgen
 			expires_at,
 			user_agent,
 			ip,
-			purpose
+			purpose,
+			session_id,
+			session_public_id,
+			started_at
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-	`, accountID, hash, issuedAt, expiresAt, userAgent, ip, purpose)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, ''), $10)
+	`, accountID, hash, issuedAt, expiresAt, userAgent, ip, purpose, sessionID, publicID, startedAt)
 	if err != nil {
 		return "", time.Time{}, err
 	}
@@ -429,6 +478,8 @@ type refreshTokenRecord struct {
 	AccountID string
 	ExpiresAt time.Time
 	RevokedAt sql.NullTime
+	SessionID string
+	StartedAt time.Time
 }
 
 func rotateRefreshToken(db *sql.DB, rawToken string, userAgent string, ip string) (string, time.Time, string, time.Time, error) {
@@ -442,11 +493,11 @@ func rotateRefreshToken(db *sql.DB, rawToken string, userAgent string, ip string
 	defer tx.Rollback()
 
 	if err := tx.QueryRow(`
-		SELECT account_id, expires_at, revoked_at
+		SELECT account_id, expires_at, revoked_at, COALESCE(session_id, ''), COALESCE(started_at, issued_at)
 		FROM refresh_tokens
 		WHERE token_hash = $1
 		FOR UPDATE
-	`, hash).Scan(&record.AccountID, &record.ExpiresAt, &record.RevokedAt); err != nil {
+	`, hash).Scan(&record.AccountID, &record.ExpiresAt, &record.RevokedAt, &record.SessionID, &record.StartedAt); err != nil {
 		if err == sql.ErrNoRows {
 			return "", time.Time{}, "", time.Time{}, errors.New("INVALID_REFRESH_TOKEN")
 		}
@@ -468,12 +519,20 @@ func rotateRefreshToken(db *sql.DB, rawToken string, userAgent string, ip string
 		return "", time.Time{}, "", time.Time{}, err
 	}
 
-	newRefresh, newRefreshExpires, err := createRefreshToken(tx, record.AccountID, "auth", userAgent, ip)
+	// Refresh tokens from before sessions were linked have no session ID.
+	// Their chain gets one here so its access tokens can be bound to it.
+	if record.SessionID == "" {
+		record.SessionID, err = randomToken(32)
+		if err != nil {
+			return "", time.Time{}, "", time.Time{}, err
+		}
+	}
+	newRefresh, newRefreshExpires, err := createRefreshToken(tx, record.AccountID, record.SessionID, "auth", userAgent, ip, record.StartedAt)
 	if err != nil {
 		return "", time.Time{}, "", time.Time{}, err
 	}
 
-	accessToken, accessExpires, err := issueAccessToken(record.AccountID, accessTokenTTL)
+	accessToken, accessExpires, err := issueAccessToken(record.AccountID, record.SessionID, accessTokenTTL)
 	if err != nil {
 		return "", time.Time{}, "", time.Time{}, err
 	}
@@ -544,7 +603,7 @@ func createPasswordResetToken(db *sql.DB, accountID string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	expiresAt := time.Now().UTC().Add(1 * time.Hour)
+	expiresAt := time.Now().UTC().Add(passwordResetTTL)
 	_, err = db.Exec(`
 		INSERT INTO password_resets (
 			reset_id,
@@ -562,9 +621,6 @@ func createPasswordResetToken(db *sql.DB, accountID string) (string, error) {
 }
 
 func resetPasswordWithToken(db *sql.DB, token string, newPassword string) error {
-	if len(newPassword) < 8 || len(newPassword) > 128 {
-		return errors.New("INVALID_PASSWORD")
-	}
 	if token == "" {
 		return errors.New("INVALID_TOKEN")
 	}
@@ -574,14 +630,15 @@ func resetPasswordWithToken(db *sql.DB, token string, newPassword string) error
 	var usedAt sql.NullTime
 	var role string
 	var mustChangePassword bool
+	var username, displayName string
 	err := db.QueryRow(`
-		SELECT pr.account_id, pr.expires_at, pr.used_at, a.role, a.must_change_password
+		SELECT pr.account_id, pr.expires_at, pr.used_at, a.role, a.must_change_password, a.username, a.display_name
 		FROM password_resets pr
 		JOIN accounts a ON a.account_id = pr.account_id
 		WHERE pr.token_hash = $1
 		ORDER BY pr.created_at DESC
 		LIMIT 1
-	`, hash).Scan(&accountID, &expiresAt, &usedAt, &role, &mustChangePassword)
+	`, hash).Scan(&accountID, &expiresAt, &usedAt, &role, &mustChangePassword, &username, &displayName)
 	if err == sql.ErrNoRows {
 		return errors.New("INVALID_TOKEN")
 	}
@@ -597,6 +654,9 @@ func resetPasswordWithToken(db *sql.DB, token string, newPassword string) error
 	if time.Now().UTC().After(expiresAt) {
 		return errors.New("TOKEN_EXPIRED")
 	}
+	if err := checkPasswordPolicy(newPassword, username, displayName); err != nil {
+		return err
+	}
 	passwordHash, err := hashPassword(newPassword)
 	if err != nil {
 		return err
@@ -614,6 +674,9 @@ func resetPasswordWithToken(db *sql.DB, token string, newPassword string) error
 		SET used_at = NOW()
 		WHERE token_hash = $1
 	`, hash)
+	// Proving control of the mailbox is enough to end a lockout.
+	_, _ = unlockAccount(db, accountID, "password_reset", "")
+	clearLoginFailures(db, accountID)
 	return nil
 }
 
@@ -624,17 +687,19 @@ func lookupAccountForReset(db *sql.DB, identifier string) (*Account, error) {
 	}
 	var account Account
 	var email sql.NullString
+	var emailVerifiedAt sql.NullTime
 	row := db.QueryRow(`
-		SELECT account_id, username, display_name, player_id, email
+		SELECT account_id, username, display_name, player_id, email, email_verified_at
 		FROM accounts
 		WHERE username = $1 OR email = $1
 		LIMIT 1
 	`, identifier)
-	if err := row.Scan(&account.AccountID, &account.Username, &account.DisplayName, &account.PlayerID, &email); err != nil {
+	if err := row.Scan(&account.AccountID, &account.Username, &account.DisplayName, &account.PlayerID, &email, &emailVerifiedAt); err != nil {
 		return nil, err
 	}
 	if email.Valid {
 		account.Email = email.String
+		account.EmailVerified = emailVerifiedAt.Valid
 	}
 	return &account, nil
 }
@@ -649,7 +714,6 @@ func generateAdminKey() (string, error) {
 
 func normalizeRole(role string) string {
 	role = strings.ToLower(strings.TrimSpace(role))
-	role = strings.TrimPrefix(role, "frozen:")
 	switch role {
 	case "admin", "moderator":
 		return role
@@ -658,20 +722,6 @@ func normalizeRole(role string) string {
 	}
 }
 
-func isFrozenRole(role string) bool {
-	role = strings.ToLower(strings.TrimSpace(role))
-	return role == "frozen" || strings.HasPrefix(role, "frozen:")
-}
-
-func baseRoleFromRaw(role string) string {
-	role = strings.ToLower(strings.TrimSpace(role))
-	role = strings.TrimPrefix(role, "frozen:")
-	if role == "frozen" {
-		return "user"
-	}
-	return normalizeRole(role)
-}
-
 func AdminExists(ctx context.Context, db *sql.DB) bool {
 	if db == nil {
 		return true
@@ -681,7 +731,7 @@ func AdminExists(ctx context.Context, db *sql.DB) bool {
 		SELECT EXISTS (
 			SELECT 1
 			FROM accounts
-			WHERE role = 'admin' OR role = 'frozen:admin'
+			WHERE role = 'admin'
 			LIMIT 1
 		)
 	`).Scan(&exists); err != nil {
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Live events and economy mutations are fanned out across instances with
+// Postgres LISTEN/NOTIFY. The leader attaches its EconomyState to every
+// economy event so followers converge within a tick.
+const (
+	clusterNotifyChannel     = "tmc_live_events"
+	clusterOutboxSize        = 512
+	clusterMessageEconomyMut = "economy_mutation"
+)
+
+type clusterMessage struct {
+	Origin        string            `json:"origin"`
+	Type          string            `json:"type"`
+	PlayerID      string            `json:"playerId,omitempty"`
+	AccountID     string            `json:"accountId,omitempty"`
+	RecipientRole string            `json:"recipientRole,omitempty"`
+	Payload       json.RawMessage   `json:"payload,omitempty"`
+	Economy       *EconomySyncState `json:"economy,omitempty"`
+	Stars         int               `json:"stars,omitempty"`
+	Coins         int               `json:"coins,omitempty"`
+}
+
+type ClusterFanout struct {
+	instanceID string
+	outbox     chan []byte
+}
+
+// clusterFanout stays nil until startClusterFanout runs; all methods are
+// no-ops on a nil receiver so single-instance tools keep working.
+var clusterFanout *ClusterFanout
+
+func isLeaderInstance() bool {
+	return startupLockConn != nil
+}
+
+func startClusterFanout(db *sql.DB, dbURL string) error {
+	instanceID, err := randomToken(8)
+	if err != nil {
+		return err
+	}
+	fanout := &ClusterFanout{
+		instanceID: instanceID,
+		outbox:     make(chan []byte, clusterOutboxSize),
+	}
+
+	listener := pq.NewListener(dbURL, 2*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("cluster listener:", err)
+		}
+	})
+	if err := listener.Listen(clusterNotifyChannel); err != nil {
+		_ = listener.Close()
+		return err
+	}
+
+	go func() {
+		for payload := range fanout.outbox {
+			if _, err := db.Exec(`SELECT pg_notify($1, $2)`, clusterNotifyChannel, string(payload)); err != nil {
+				log.Println("cluster notify failed:", err)
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			select {
+			case notification := <-listener.Notify:
+				// A nil notification means the connection was re-established
+				// and messages may have been missed; the next leader sync heals it.
+				if notification == nil {
+					continue
+				}
+				fanout.receive(notification.Extra)
+			case <-time.After(90 * time.Second):
+				go listener.Ping()
+			}
+		}
+	}()
+
+	clusterFanout = fanout
+	log.Println("Cluster fan-out listening on", clusterNotifyChannel, "as", instanceID)
+	return nil
+}
+
+func (c *ClusterFanout) send(msg clusterMessage) {
+	if c == nil {
+		return
+	}
+	msg.Origin = c.instanceID
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	select {
+	case c.outbox <- payload:
+	default:
+		log.Println("cluster outbox full; dropping", msg.Type)
+	}
+}
+
+func (c *ClusterFanout) Forward(event HubEvent) {
+	if c == nil {
+		return
+	}
+	msg := clusterMessage{
+		Type:          event.Type,
+		PlayerID:      event.PlayerID,
+		AccountID:     event.AccountID,
+		RecipientRole: event.RecipientRole,
+	}
+	if event.Payload != nil {
+		encoded, err := json.Marshal(event.Payload)
+		if err != nil {
+			return
+		}
+		msg.Payload = encoded
+	}
+	if event.Type == HubEventEconomy && isLeaderInstance() {
+		state := economy.SyncState()
+		msg.Economy = &state
+	}
+	c.send(msg)
+}
+
+func (c *ClusterFanout) ForwardEconomyMutation(stars int, coins int) {
+	if c == nil || (stars == 0 && coins == 0) {
+		return
+	}
+	c.send(clusterMessage{Type: clusterMessageEconomyMut, Stars: stars, Coins: coins})
+}
+
+func (c *ClusterFanout) receive(raw string) {
+	var msg clusterMessage
+	if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+		log.Println("cluster message decode failed:", err)
+		return
+	}
+	if msg.Origin == c.instanceID {
+		return
+	}
+
+	if msg.Type == clusterMessageEconomyMut {
+		economy.ApplyRemoteMutation(msg.Stars, msg.Coins)
+		return
+	}
+	if msg.Economy != nil && !isLeaderInstance() {
+		economy.ApplySyncState(*msg.Economy)
+	}
+
+	event := HubEvent{
+		Type:          msg.Type,
+		PlayerID:      msg.PlayerID,
+		AccountID:     msg.AccountID,
+		RecipientRole: msg.RecipientRole,
+	}
+	switch msg.Type {
+	case HubEventEconomy:
+		var delta EconomyDelta
+		if err := json.Unmarshal(msg.Payload, &delta); err != nil {
+			return
+		}
+		if !isLeaderInstance() {
+			setNextEmissionTick(time.Now().UTC().Add(time.Duration(delta.NextEmissionInSeconds) * time.Second))
+		}
+		event.Payload = delta
+	case HubEventBalance:
+		var delta BalanceDelta
+		if err := json.Unmarshal(msg.Payload, &delta); err != nil {
+			return
+		}
+		event.Payload = delta
+	case HubEventNotification:
+		var delta NotificationDelta
+		if err := json.Unmarshal(msg.Payload, &delta); err != nil {
+			return
+		}
+		event.Payload = delta
+	case HubEventLeaderboard:
+		var delta LeaderboardDelta
+		if err := json.Unmarshal(msg.Payload, &delta); err != nil {
+			return
+		}
+		event.Payload = delta
+	case HubEventSeason:
+	default:
+		return
+	}
+	liveHub.Publish(event)
+}
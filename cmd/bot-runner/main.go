@@ -17,7 +17,8 @@ import (
 
 type BotConfig struct {
 	Username       string `json:"username"`
-	Password       string `json:"password"`
+	Password       string `json:"password,omitempty"`
+	APIToken       string `json:"apiToken,omitempty"`
 	Strategy       string `json:"strategy"`
 	Threshold      int    `json:"threshold,omitempty"`
 	MaxStarsPerDay int    `json:"maxStarsPerDay,omitempty"`
@@ -186,6 +187,12 @@ func loadBots() ([]BotConfig, error) {
 }
 
 func ensureAuth(client *http.Client, baseURL string, bot *BotState) error {
+	// A personal API token (scopes read:player and trade:stars) is used as
+	// is; there is nothing to log in or refresh.
+	if bot.Config.APIToken != "" {
+		bot.AccessToken = bot.Config.APIToken
+		return nil
+	}
 	if bot.AccessToken != "" && time.Until(bot.AccessExpiry) > 2*time.Minute {
 		return nil
 	}
@@ -112,6 +112,9 @@ func GrantCoinsWithCap(db *sql.DB, playerID string, amount int, now time.Time, s
 	if amount <= 0 {
 		return 0, 0, nil
 	}
+	if economyFaucetBlock() != "" {
+		return 0, 0, errSeasonFrozen
+	}
 
 	tx, err := db.BeginTx(context.Background(), nil)
 	if err != nil {
@@ -191,6 +194,7 @@ func GrantCoinsWithCap(db *sql.DB, playerID string, amount int, now time.Time, s
 	if err := tx.Commit(); err != nil {
 		return 0, remaining, err
 	}
+	publishPlayerBalanceFromDB(db, playerID)
 
 	return grant, remaining - grant, nil
 }
@@ -199,6 +203,9 @@ func GrantCoinsNoCap(db *sql.DB, playerID string, amount int, now time.Time, sou
 	if amount <= 0 {
 		return 0, nil
 	}
+	if economyFaucetBlock() != "" {
+		return 0, errSeasonFrozen
+	}
 
 	tx, err := db.BeginTx(context.Background(), nil)
 	if err != nil {
@@ -249,13 +256,14 @@ func GrantCoinsNoCap(db *sql.DB, playerID string, amount int, now time.Time, sou
 	if err := tx.Commit(); err != nil {
 		return 0, err
 	}
+	publishPlayerBalanceFromDB(db, playerID)
 
 	return amount, nil
 }
 
 func EnsurePlayableBalanceOnLogin(db *sql.DB, playerID string, accountID *string) {
 	now := time.Now().UTC()
-	if isSeasonEnded(now) {
+	if isSeasonEnded(now) || economyFaucetBlock() != "" || !featureFlagEnabledFor(FlagFaucets, playerID) {
 		return
 	}
 	cooldown := loginSafeguardCooldown
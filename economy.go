@@ -102,8 +102,9 @@ func (e *EconomyState) persist(seasonID string, db *sql.DB) {
 
 func (e *EconomyState) IncrementStars() {
 	e.mu.Lock()
-	defer e.mu.Unlock()
 	e.globalStarsPurchased++
+	e.mu.Unlock()
+	clusterFanout.ForwardEconomyMutation(1, 0)
 }
 
 func (e *EconomyState) Snapshot() (int, int, int) {
@@ -312,6 +313,108 @@ func ensureSchema(db *sql.DB) error {
 		return err
 	}
 
+	_, err = db.Exec(`
+		ALTER TABLE accounts
+		ADD COLUMN IF NOT EXISTS frozen_at TIMESTAMPTZ;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		ALTER TABLE accounts
+		ADD COLUMN IF NOT EXISTS frozen_by TEXT;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		ALTER TABLE accounts
+		ADD COLUMN IF NOT EXISTS totp_secret TEXT;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		ALTER TABLE accounts
+		ADD COLUMN IF NOT EXISTS totp_pending_secret TEXT;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		ALTER TABLE accounts
+		ADD COLUMN IF NOT EXISTS totp_enabled_at TIMESTAMPTZ;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		ALTER TABLE accounts
+		ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Addresses on file before verification existed are treated as verified,
+	// so those players can still reset their password. This only runs when
+	// the column is first added; later signups have to use the link.
+	_, err = db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1
+				FROM information_schema.columns
+				WHERE table_name = 'accounts'
+				  AND column_name = 'email_verified_at'
+			) THEN
+				ALTER TABLE accounts
+					ADD COLUMN email_verified_at TIMESTAMPTZ;
+				UPDATE accounts
+				SET email_verified_at = created_at
+				WHERE email IS NOT NULL AND email_verified_at IS NULL;
+			END IF;
+		END $$;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		ALTER TABLE accounts
+		ADD COLUMN IF NOT EXISTS pending_email TEXT;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		ALTER TABLE accounts
+		ADD COLUMN IF NOT EXISTS deletion_scheduled_for TIMESTAMPTZ;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Frozen accounts used to be marked with a "frozen:" role prefix.
+	_, err = db.Exec(`
+		UPDATE accounts
+		SET frozen_at = COALESCE(frozen_at, NOW()),
+			role = CASE
+				WHEN role IN ('frozen:admin', 'frozen:moderator') THEN substr(role, 8)
+				ELSE 'user'
+			END
+		WHERE role LIKE 'frozen%';
+	`)
+	if err != nil {
+		return err
+	}
+
 	// 2️⃣c sessions table
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS sessions (
@@ -332,6 +435,65 @@ func ensureSchema(db *sql.DB) error {
 		return err
 	}
 
+	_, err = db.Exec(`
+		ALTER TABLE sessions
+		ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		ALTER TABLE sessions
+		ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMPTZ;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		ALTER TABLE sessions
+		ADD COLUMN IF NOT EXISTS user_agent TEXT;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		ALTER TABLE sessions
+		ADD COLUMN IF NOT EXISTS ip TEXT;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// public_id is sessionPublicID(session_id): the non-secret name bearer
+	// access tokens and the device list use for a session.
+	_, err = db.Exec(`
+		ALTER TABLE sessions
+		ADD COLUMN IF NOT EXISTS public_id TEXT;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		UPDATE sessions
+		SET public_id = 's_' || substr(translate(encode(sha256(convert_to(session_id, 'UTF8')), 'base64'), '+/', '-_'), 1, 16)
+		WHERE public_id IS NULL;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_sessions_public_id
+		ON sessions (public_id);
+	`)
+	if err != nil {
+		return err
+	}
+
 	_, err = db.Exec(`
 		ALTER TABLE players
 		ADD COLUMN IF NOT EXISTS last_coin_grant_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
@@ -483,6 +645,55 @@ func ensureSchema(db *sql.DB) error {
 		return err
 	}
 
+	_, err = db.Exec(`
+		ALTER TABLE refresh_tokens
+		ADD COLUMN IF NOT EXISTS session_id TEXT;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		ALTER TABLE refresh_tokens
+		ADD COLUMN IF NOT EXISTS started_at TIMESTAMPTZ;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id
+		ON refresh_tokens (session_id);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		ALTER TABLE refresh_tokens
+		ADD COLUMN IF NOT EXISTS session_public_id TEXT;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		UPDATE refresh_tokens
+		SET session_public_id = 's_' || substr(translate(encode(sha256(convert_to(session_id, 'UTF8')), 'base64'), '+/', '-_'), 1, 16)
+		WHERE session_public_id IS NULL AND session_id IS NOT NULL;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_public_id
+		ON refresh_tokens (session_public_id);
+	`)
+	if err != nil {
+		return err
+	}
+
 	_, err = db.Exec(`
 		ALTER TABLE refresh_tokens
 			ADD COLUMN IF NOT EXISTS account_id TEXT;
@@ -739,6 +950,26 @@ func ensureSchema(db *sql.DB) error {
 		return err
 	}
 
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS global_settings_history (
+			id BIGSERIAL PRIMARY KEY,
+			version BIGINT NOT NULL,
+			key TEXT NOT NULL,
+			old_value TEXT,
+			new_value TEXT NOT NULL,
+			changed_by TEXT,
+			reason TEXT,
+			rollback_of BIGINT,
+			created_at TIMESTAMPTZ NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_global_settings_history_version
+		ON global_settings_history (version DESC);
+	`)
+	if err != nil {
+		return err
+	}
+
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS password_resets (
 			reset_id TEXT PRIMARY KEY,
@@ -897,6 +1128,15 @@ func ensureSchema(db *sql.DB) error {
 		return err
 	}
 
+	_, err = db.Exec(`
+		ALTER TABLE season_final_rankings
+		ADD COLUMN IF NOT EXISTS final_rank INT,
+		ADD COLUMN IF NOT EXISTS tier TEXT;
+	`)
+	if err != nil {
+		return err
+	}
+
 	// 🔟 player_telemetry table
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS player_telemetry (
@@ -1045,6 +1285,523 @@ func ensureSchema(db *sql.DB) error {
 		return err
 	}
 
+	// 1️⃣3️⃣ materialized leaderboard
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS leaderboard_ranks (
+			season_id TEXT NOT NULL,
+			player_id TEXT NOT NULL,
+			rank INT NOT NULL,
+			stars BIGINT NOT NULL,
+			coins_spent_lifetime BIGINT NOT NULL DEFAULT 0,
+			last_star_acquired_at TIMESTAMPTZ,
+			player_created_at TIMESTAMPTZ NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (season_id, player_id)
+		);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_leaderboard_ranks_rank
+		ON leaderboard_ranks (season_id, rank);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS leaderboard_rank_history (
+			id BIGSERIAL PRIMARY KEY,
+			season_id TEXT NOT NULL,
+			player_id TEXT NOT NULL,
+			rank INT NOT NULL,
+			previous_rank INT,
+			stars BIGINT NOT NULL,
+			recorded_at TIMESTAMPTZ NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_leaderboard_rank_history_player
+		ON leaderboard_rank_history (season_id, player_id, recorded_at DESC);
+	`)
+	if err != nil {
+		return err
+	}
+	// Every change to a ranking input bumps a player's leaderboard_version or
+	// the deletion count, so the refresher can skip rebuilds when neither moved.
+	_, err = db.Exec(`
+		ALTER TABLE players
+		ADD COLUMN IF NOT EXISTS leaderboard_version BIGINT NOT NULL DEFAULT 1;
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS leaderboard_input_state (
+			id INT PRIMARY KEY,
+			players_deleted BIGINT NOT NULL DEFAULT 0
+		);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		INSERT INTO leaderboard_input_state (id)
+		VALUES (1)
+		ON CONFLICT (id) DO NOTHING;
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE OR REPLACE FUNCTION bump_player_leaderboard_version() RETURNS trigger AS $$
+		BEGIN
+			NEW.leaderboard_version := OLD.leaderboard_version + 1;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE OR REPLACE FUNCTION bump_leaderboard_version_for_player() RETURNS trigger AS $$
+		BEGIN
+			IF TG_OP <> 'INSERT' THEN
+				UPDATE players SET leaderboard_version = leaderboard_version + 1 WHERE player_id = OLD.player_id;
+			END IF;
+			IF TG_OP <> 'DELETE' THEN
+				UPDATE players SET leaderboard_version = leaderboard_version + 1 WHERE player_id = NEW.player_id;
+			END IF;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE OR REPLACE FUNCTION count_leaderboard_player_deletes() RETURNS trigger AS $$
+		BEGIN
+			UPDATE leaderboard_input_state SET players_deleted = players_deleted + 1 WHERE id = 1;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'players_leaderboard_version') THEN
+				CREATE TRIGGER players_leaderboard_version
+					BEFORE UPDATE OF stars, is_bot ON players
+					FOR EACH ROW
+					WHEN (OLD.stars IS DISTINCT FROM NEW.stars OR OLD.is_bot IS DISTINCT FROM NEW.is_bot)
+					EXECUTE FUNCTION bump_player_leaderboard_version();
+			END IF;
+			IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'players_leaderboard_delete') THEN
+				CREATE TRIGGER players_leaderboard_delete
+					AFTER DELETE ON players
+					FOR EACH STATEMENT
+					EXECUTE FUNCTION count_leaderboard_player_deletes();
+			END IF;
+			IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'star_purchase_log_leaderboard_version') THEN
+				CREATE TRIGGER star_purchase_log_leaderboard_version
+					AFTER INSERT OR UPDATE OR DELETE ON star_purchase_log
+					FOR EACH ROW
+					EXECUTE FUNCTION bump_leaderboard_version_for_player();
+			END IF;
+			IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'accounts_leaderboard_version') THEN
+				CREATE TRIGGER accounts_leaderboard_version
+					AFTER UPDATE OF trust_status ON accounts
+					FOR EACH ROW
+					WHEN (OLD.trust_status IS DISTINCT FROM NEW.trust_status)
+					EXECUTE FUNCTION bump_leaderboard_version_for_player();
+			END IF;
+		END $$;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 1️⃣4️⃣ friendships
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS friendships (
+			requester_account_id TEXT NOT NULL,
+			addressee_account_id TEXT NOT NULL,
+			status TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL,
+			responded_at TIMESTAMPTZ,
+			PRIMARY KEY (requester_account_id, addressee_account_id)
+		);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_friendships_addressee
+		ON friendships (addressee_account_id, status);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 1️⃣5️⃣ teams
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS teams (
+			team_id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			tag TEXT NOT NULL UNIQUE,
+			description TEXT,
+			owner_account_id TEXT NOT NULL,
+			max_members INT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL
+		);
+
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_teams_name_lower
+		ON teams (LOWER(name));
+
+		CREATE TABLE IF NOT EXISTS team_members (
+			account_id TEXT PRIMARY KEY,
+			team_id TEXT NOT NULL,
+			role TEXT NOT NULL,
+			joined_at TIMESTAMPTZ NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_team_members_team
+		ON team_members (team_id);
+
+		CREATE TABLE IF NOT EXISTS team_join_requests (
+			team_id TEXT NOT NULL,
+			account_id TEXT NOT NULL,
+			message TEXT,
+			status TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL,
+			responded_at TIMESTAMPTZ,
+			responded_by TEXT,
+			PRIMARY KEY (team_id, account_id)
+		);
+
+		CREATE TABLE IF NOT EXISTS team_membership_log (
+			id BIGSERIAL PRIMARY KEY,
+			team_id TEXT NOT NULL,
+			account_id TEXT NOT NULL,
+			action TEXT NOT NULL,
+			actor_account_id TEXT,
+			details JSONB,
+			created_at TIMESTAMPTZ NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_team_membership_log_team
+		ON team_membership_log (team_id, created_at DESC);
+
+		CREATE INDEX IF NOT EXISTS idx_team_membership_log_account
+		ON team_membership_log (account_id, created_at DESC);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 1️⃣6️⃣ season_controls (admin safety switches)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS season_controls (
+			season_id TEXT PRIMARY KEY,
+			purchases_paused BOOLEAN NOT NULL DEFAULT FALSE,
+			purchases_paused_reason TEXT,
+			emission_multiplier DOUBLE PRECISION NOT NULL DEFAULT 1,
+			emission_multiplier_expires_at TIMESTAMPTZ,
+			emission_reason TEXT,
+			frozen BOOLEAN NOT NULL DEFAULT FALSE,
+			frozen_reason TEXT,
+			updated_by TEXT,
+			updated_at TIMESTAMPTZ NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 1️⃣7️⃣ feature_flags (runtime registry)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS feature_flags (
+			key TEXT PRIMARY KEY,
+			enabled BOOLEAN NOT NULL,
+			phases TEXT NOT NULL DEFAULT '',
+			rollout_percent INT NOT NULL DEFAULT 100,
+			description TEXT,
+			updated_by TEXT,
+			updated_at TIMESTAMPTZ NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 1️⃣8️⃣ permissions (catalog, role defaults and per-account grants)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS permissions (
+			permission TEXT PRIMARY KEY,
+			description TEXT,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS role_permissions (
+			role TEXT NOT NULL,
+			permission TEXT NOT NULL,
+			granted_by TEXT,
+			granted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (role, permission)
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS account_permissions (
+			account_id TEXT NOT NULL,
+			permission TEXT NOT NULL,
+			granted_by TEXT,
+			granted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (account_id, permission)
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 1️⃣9️⃣ admin_pending_actions (two-person approval queue)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS admin_pending_actions (
+			id BIGSERIAL PRIMARY KEY,
+			action_type TEXT NOT NULL,
+			payload JSONB NOT NULL,
+			reason TEXT,
+			requested_by TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			created_at TIMESTAMPTZ NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL,
+			decided_by TEXT,
+			decided_at TIMESTAMPTZ,
+			decision_reason TEXT,
+			result_error TEXT
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_admin_pending_actions_status
+		ON admin_pending_actions (status, expires_at);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 2️⃣0️⃣ account_recovery_codes (hashed 2FA recovery codes)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS account_recovery_codes (
+			account_id TEXT NOT NULL,
+			code_hash TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL,
+			used_at TIMESTAMPTZ,
+			PRIMARY KEY (account_id, code_hash)
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 2️⃣1️⃣ account_devices (known sign-in devices per account)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS account_devices (
+			account_id TEXT NOT NULL,
+			device_key TEXT NOT NULL,
+			user_agent TEXT,
+			first_seen_at TIMESTAMPTZ NOT NULL,
+			last_seen_at TIMESTAMPTZ NOT NULL,
+			last_ip TEXT,
+			PRIMARY KEY (account_id, device_key)
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 2️⃣2️⃣ email_verifications (single-use email confirmation tokens)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS email_verifications (
+			token_hash TEXT PRIMARY KEY,
+			account_id TEXT NOT NULL,
+			email TEXT NOT NULL,
+			purpose TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			expires_at TIMESTAMPTZ NOT NULL,
+			used_at TIMESTAMPTZ
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_email_verifications_account
+		ON email_verifications (account_id, created_at DESC);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 2️⃣3️⃣ mail_outbox (queued outgoing mail, drained by the leader)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS mail_outbox (
+			id BIGSERIAL PRIMARY KEY,
+			template TEXT NOT NULL,
+			recipient TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			text_body TEXT NOT NULL,
+			html_body TEXT,
+			dedup_key TEXT UNIQUE,
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INT NOT NULL DEFAULT 0,
+			last_error TEXT,
+			next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			sent_at TIMESTAMPTZ
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_mail_outbox_due
+		ON mail_outbox (status, next_attempt_at);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 2️⃣4️⃣ pow_redemptions (spent proof-of-work challenges)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS pow_redemptions (
+			challenge_hash TEXT PRIMARY KEY,
+			expires_at TIMESTAMPTZ NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 2️⃣5️⃣ api_tokens (scoped personal API tokens)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS api_tokens (
+			token_id TEXT PRIMARY KEY,
+			account_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			scopes TEXT[] NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL,
+			last_used_at TIMESTAMPTZ,
+			last_used_ip TEXT,
+			revoked_at TIMESTAMPTZ
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_api_tokens_account
+		ON api_tokens (account_id, created_at DESC);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 2️⃣6️⃣ account_deletions (self-service deletion requests and their outcome)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS account_deletions (
+			id BIGSERIAL PRIMARY KEY,
+			account_id TEXT NOT NULL,
+			player_id TEXT NOT NULL,
+			status TEXT NOT NULL,
+			requested_at TIMESTAMPTZ NOT NULL,
+			scheduled_for TIMESTAMPTZ NOT NULL,
+			cancelled_at TIMESTAMPTZ,
+			completed_at TIMESTAMPTZ
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_account_deletions_account
+		ON account_deletions (account_id, status);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 2️⃣7️⃣ account_login_failures (per-account failed logins and lockouts)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS account_login_failures (
+			account_id TEXT PRIMARY KEY,
+			failed_count INT NOT NULL DEFAULT 0,
+			lockout_level INT NOT NULL DEFAULT 0,
+			last_failed_at TIMESTAMPTZ,
+			locked_until TIMESTAMPTZ,
+			updated_at TIMESTAMPTZ NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 2️⃣8️⃣ account_login_ranges (networks each account has signed in from)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS account_login_ranges (
+			account_id TEXT NOT NULL,
+			ip_range TEXT NOT NULL,
+			first_seen_at TIMESTAMPTZ NOT NULL,
+			last_seen_at TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (account_id, ip_range)
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 2️⃣9️⃣ access_token_keys (generated signing keys and retired key IDs)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS access_token_keys (
+			kid TEXT PRIMARY KEY,
+			secret TEXT,
+			source TEXT NOT NULL,
+			status TEXT NOT NULL,
+			created_by TEXT,
+			created_at TIMESTAMPTZ NOT NULL,
+			activated_at TIMESTAMPTZ,
+			retired_at TIMESTAMPTZ
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -1165,9 +1922,12 @@ func (e *EconomyState) EmissionPerMinute() float64 {
 	return float64(e.dailyEmissionTarget) / (24 * 60)
 }
 
+// EffectiveDailyEmissionTarget includes any admin emission multiplier; a
+// frozen season emits nothing.
 func (e *EconomyState) EffectiveDailyEmissionTarget(secondsRemaining int64, coinsInCirculation int64) int {
 	params := economy.Calibration()
-	return EffectiveDailyEmissionTargetForParams(params, secondsRemaining, coinsInCirculation)
+	target := EffectiveDailyEmissionTargetForParams(params, secondsRemaining, coinsInCirculation)
+	return int(float64(target) * emissionControlMultiplier(time.Now().UTC()))
 }
 
 func (e *EconomyState) EffectiveEmissionPerMinute(secondsRemaining int64, coinsInCirculation int64) float64 {
@@ -1374,9 +2134,66 @@ func (e *EconomyState) TryDistributeCoins(amount int) bool {
 	}
 
 	e.coinsDistributed += amount
+	clusterFanout.ForwardEconomyMutation(0, amount)
 	return true
 }
 
+// EconomySyncState is the leader-owned portion of EconomyState that other
+// instances adopt after every tick so their pricing and emission checks match.
+type EconomySyncState struct {
+	GlobalCoinPool       int     `json:"globalCoinPool"`
+	CoinsDistributed     int     `json:"coinsDistributed"`
+	CoinsInWallets       int64   `json:"coinsInWallets"`
+	ActiveCoinsInWallets int64   `json:"activeCoinsInWallets"`
+	ActivePlayers        int     `json:"activePlayers"`
+	GlobalStarsPurchased int     `json:"globalStarsPurchased"`
+	DailyEmissionTarget  int     `json:"dailyEmissionTarget"`
+	EmissionRemainder    float64 `json:"emissionRemainder"`
+	MarketPressure       float64 `json:"marketPressure"`
+	PriceFloor           int     `json:"priceFloor"`
+}
+
+func (e *EconomyState) SyncState() EconomySyncState {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return EconomySyncState{
+		GlobalCoinPool:       e.globalCoinPool,
+		CoinsDistributed:     e.coinsDistributed,
+		CoinsInWallets:       e.coinsInWallets,
+		ActiveCoinsInWallets: e.activeCoinsInWallets,
+		ActivePlayers:        e.activePlayers,
+		GlobalStarsPurchased: e.globalStarsPurchased,
+		DailyEmissionTarget:  e.dailyEmissionTarget,
+		EmissionRemainder:    e.emissionRemainder,
+		MarketPressure:       e.marketPressure,
+		PriceFloor:           e.priceFloor,
+	}
+}
+
+func (e *EconomyState) ApplySyncState(state EconomySyncState) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.globalCoinPool = state.GlobalCoinPool
+	e.coinsDistributed = state.CoinsDistributed
+	e.coinsInWallets = state.CoinsInWallets
+	e.activeCoinsInWallets = state.ActiveCoinsInWallets
+	e.activePlayers = state.ActivePlayers
+	e.globalStarsPurchased = state.GlobalStarsPurchased
+	e.dailyEmissionTarget = state.DailyEmissionTarget
+	e.emissionRemainder = state.EmissionRemainder
+	e.marketPressure = state.MarketPressure
+	e.priceFloor = state.PriceFloor
+}
+
+// ApplyRemoteMutation folds a purchase or grant made on another instance into
+// the local counters until the next leader sync arrives.
+func (e *EconomyState) ApplyRemoteMutation(stars int, coinsDistributed int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.globalStarsPurchased += stars
+	e.coinsDistributed += coinsDistributed
+}
+
 // CanDrip returns true if at least 60 seconds have passed
 func CanDrip(last time.Time, now time.Time) bool {
 	return now.Sub(last) >= time.Minute
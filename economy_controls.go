@@ -0,0 +1,435 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Economy controls are admin safety switches scoped to a season: pausing
+// star purchases, a temporary emission multiplier that expires on its own,
+// and a full freeze where every faucet and sink rejects. State lives in
+// season_controls and is polled by every instance.
+const (
+	EconomyControlPausePurchases  = "pause_purchases"
+	EconomyControlResumePurchases = "resume_purchases"
+	EconomyControlSetEmission     = "set_emission_multiplier"
+	EconomyControlClearEmission   = "clear_emission_multiplier"
+	EconomyControlFreeze          = "freeze"
+	EconomyControlUnfreeze        = "unfreeze"
+
+	economyControlsRefreshInterval = 5 * time.Second
+	maxEmissionMultiplier          = 5.0
+	maxEmissionMultiplierDuration  = 7 * 24 * time.Hour
+)
+
+var errSeasonFrozen = errors.New("season frozen")
+
+type SeasonControls struct {
+	SeasonID                    string     `json:"seasonId"`
+	PurchasesPaused             bool       `json:"purchasesPaused"`
+	PurchasesPausedReason       string     `json:"purchasesPausedReason,omitempty"`
+	EmissionMultiplier          float64    `json:"emissionMultiplier"`
+	EmissionMultiplierExpiresAt *time.Time `json:"emissionMultiplierExpiresAt,omitempty"`
+	EmissionReason              string     `json:"emissionReason,omitempty"`
+	Frozen                      bool       `json:"frozen"`
+	FrozenReason                string     `json:"frozenReason,omitempty"`
+	UpdatedBy                   string     `json:"updatedBy,omitempty"`
+	UpdatedAt                   *time.Time `json:"updatedAt,omitempty"`
+}
+
+var (
+	seasonControlsMu     sync.RWMutex
+	cachedSeasonControls = map[string]SeasonControls{}
+)
+
+func defaultSeasonControls(seasonID string) SeasonControls {
+	return SeasonControls{SeasonID: seasonID, EmissionMultiplier: 1}
+}
+
+// activeEmissionMultiplier reports the multiplier only while it has not
+// expired; the leader also clears expired rows.
+func (c SeasonControls) activeEmissionMultiplier(now time.Time) float64 {
+	if c.EmissionMultiplierExpiresAt == nil || !now.Before(*c.EmissionMultiplierExpiresAt) {
+		return 1
+	}
+	return c.EmissionMultiplier
+}
+
+func getSeasonControls(seasonID string) SeasonControls {
+	seasonControlsMu.RLock()
+	defer seasonControlsMu.RUnlock()
+	if controls, ok := cachedSeasonControls[seasonID]; ok {
+		return controls
+	}
+	return defaultSeasonControls(seasonID)
+}
+
+func currentSeasonControls() SeasonControls {
+	return getSeasonControls(currentSeasonID())
+}
+
+// emissionControlMultiplier scales live emission. A frozen season emits
+// nothing into the pool.
+func emissionControlMultiplier(now time.Time) float64 {
+	controls := currentSeasonControls()
+	if controls.Frozen {
+		return 0
+	}
+	return controls.activeEmissionMultiplier(now)
+}
+
+// economyFaucetBlock returns the error code a faucet must reject with, or "".
+func economyFaucetBlock() string {
+	if currentSeasonControls().Frozen {
+		return "SEASON_FROZEN"
+	}
+	return ""
+}
+
+// economySinkBlock returns the error code a sink must reject with, or "".
+// Star purchases are additionally blocked while purchases are paused.
+func economySinkBlock(starPurchase bool) string {
+	controls := currentSeasonControls()
+	if controls.Frozen {
+		return "SEASON_FROZEN"
+	}
+	if starPurchase && controls.PurchasesPaused {
+		return "STAR_PURCHASES_PAUSED"
+	}
+	return ""
+}
+
+func loadSeasonControls(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT
+			season_id,
+			purchases_paused,
+			COALESCE(purchases_paused_reason, ''),
+			emission_multiplier,
+			emission_multiplier_expires_at,
+			COALESCE(emission_reason, ''),
+			frozen,
+			COALESCE(frozen_reason, ''),
+			COALESCE(updated_by, ''),
+			updated_at
+		FROM season_controls
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	loaded := map[string]SeasonControls{}
+	for rows.Next() {
+		var controls SeasonControls
+		var expiresAt sql.NullTime
+		var updatedAt time.Time
+		if err := rows.Scan(
+			&controls.SeasonID,
+			&controls.PurchasesPaused,
+			&controls.PurchasesPausedReason,
+			&controls.EmissionMultiplier,
+			&expiresAt,
+			&controls.EmissionReason,
+			&controls.Frozen,
+			&controls.FrozenReason,
+			&controls.UpdatedBy,
+			&updatedAt,
+		); err != nil {
+			continue
+		}
+		if expiresAt.Valid {
+			value := expiresAt.Time.UTC()
+			controls.EmissionMultiplierExpiresAt = &value
+		}
+		updated := updatedAt.UTC()
+		controls.UpdatedAt = &updated
+		loaded[controls.SeasonID] = controls
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	seasonControlsMu.Lock()
+	previous := cachedSeasonControls[currentSeasonID()]
+	cachedSeasonControls = loaded
+	seasonControlsMu.Unlock()
+
+	// Every instance pushes a fresh snapshot to its own clients once it
+	// observes a change to the current season's controls.
+	next := loaded[currentSeasonID()]
+	changed := (previous.UpdatedAt == nil) != (next.UpdatedAt == nil)
+	if previous.UpdatedAt != nil && next.UpdatedAt != nil && !previous.UpdatedAt.Equal(*next.UpdatedAt) {
+		changed = true
+	}
+	if changed {
+		liveHub.Publish(HubEvent{Type: HubEventSeason})
+	}
+	return nil
+}
+
+func startSeasonControlsRefresher(db *sql.DB) {
+	if err := loadSeasonControls(db); err != nil {
+		log.Println("season controls load failed:", err)
+	}
+	go func() {
+		ticker := time.NewTicker(economyControlsRefreshInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if isLeaderInstance() {
+				expireEmissionMultipliers(db, time.Now().UTC())
+			}
+			if err := loadSeasonControls(db); err != nil {
+				log.Println("season controls refresh failed:", err)
+			}
+		}
+	}()
+}
+
+func expireEmissionMultipliers(db *sql.DB, now time.Time) {
+	rows, err := db.Query(`
+		UPDATE season_controls
+		SET emission_multiplier = 1,
+			emission_multiplier_expires_at = NULL,
+			emission_reason = NULL,
+			updated_at = $1
+		WHERE emission_multiplier_expires_at IS NOT NULL
+			AND emission_multiplier_expires_at <= $1
+		RETURNING season_id
+	`, now)
+	if err != nil {
+		log.Println("emission multiplier expiry failed:", err)
+		return
+	}
+	expired := []string{}
+	for rows.Next() {
+		var seasonID string
+		if err := rows.Scan(&seasonID); err == nil {
+			expired = append(expired, seasonID)
+		}
+	}
+	rows.Close()
+
+	for _, seasonID := range expired {
+		emitNotification(db, NotificationInput{
+			RecipientRole: NotificationRoleAdmin,
+			SeasonID:      seasonID,
+			Category:      NotificationCategoryEconomy,
+			Type:          "emission_multiplier_expired",
+			Priority:      NotificationPriorityNormal,
+			Message:       "Temporary emission multiplier expired for " + seasonID + ".",
+			Link:          "#/admin",
+			Payload:       map[string]interface{}{"seasonId": seasonID},
+		})
+	}
+}
+
+type AdminEconomyControlRequest struct {
+	SeasonID        string  `json:"seasonId,omitempty"`
+	Action          string  `json:"action"`
+	Reason          string  `json:"reason"`
+	Multiplier      float64 `json:"multiplier,omitempty"`
+	DurationMinutes int     `json:"durationMinutes,omitempty"`
+}
+
+type AdminEconomyControlResponse struct {
+	OK            bool                `json:"ok"`
+	Error         string              `json:"error,omitempty"`
+	Controls      *SeasonControls     `json:"controls,omitempty"`
+	PendingAction *PendingAdminAction `json:"pendingAction,omitempty"`
+}
+
+func adminEconomyControlsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		permission := PermViewEconomy
+		if r.Method != http.MethodGet {
+			permission = PermManageEconomy
+		}
+		admin, ok := requirePermission(db, w, r, permission)
+		if !ok {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			seasonID := strings.TrimSpace(r.URL.Query().Get("seasonId"))
+			if seasonID == "" {
+				seasonID = currentSeasonID()
+			}
+			controls := getSeasonControls(seasonID)
+			json.NewEncoder(w).Encode(AdminEconomyControlResponse{OK: true, Controls: &controls})
+			return
+		case http.MethodPost:
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req AdminEconomyControlRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			json.NewEncoder(w).Encode(AdminEconomyControlResponse{OK: false, Error: "INVALID_REQUEST"})
+			return
+		}
+		reason := strings.TrimSpace(req.Reason)
+		if reason == "" {
+			json.NewEncoder(w).Encode(AdminEconomyControlResponse{OK: false, Error: "REASON_REQUIRED"})
+			return
+		}
+		if len(reason) > 500 {
+			json.NewEncoder(w).Encode(AdminEconomyControlResponse{OK: false, Error: "INVALID_REASON"})
+			return
+		}
+		seasonID := strings.TrimSpace(req.SeasonID)
+		if seasonID == "" {
+			seasonID = currentSeasonID()
+		}
+		req.SeasonID = seasonID
+		req.Reason = reason
+
+		// Emission overrides change what every player earns, so they wait for
+		// a second admin.
+		if req.Action == EconomyControlSetEmission {
+			if errCode := validateEmissionOverride(req.Multiplier, req.DurationMinutes); errCode != "" {
+				json.NewEncoder(w).Encode(AdminEconomyControlResponse{OK: false, Error: errCode})
+				return
+			}
+			pending, errCode := submitAdminAction(db, admin.AccountID, PendingActionEmissionOverride, map[string]interface{}{
+				"seasonId":        seasonID,
+				"multiplier":      req.Multiplier,
+				"durationMinutes": req.DurationMinutes,
+			}, reason)
+			if errCode != "" {
+				json.NewEncoder(w).Encode(AdminEconomyControlResponse{OK: false, Error: errCode})
+				return
+			}
+			controls := getSeasonControls(seasonID)
+			json.NewEncoder(w).Encode(AdminEconomyControlResponse{OK: true, Controls: &controls, PendingAction: pending})
+			return
+		}
+
+		if errCode := applyEconomyControl(db, admin.AccountID, req, nil); errCode != "" {
+			json.NewEncoder(w).Encode(AdminEconomyControlResponse{OK: false, Error: errCode})
+			return
+		}
+		controls := getSeasonControls(seasonID)
+		json.NewEncoder(w).Encode(AdminEconomyControlResponse{OK: true, Controls: &controls})
+	}
+}
+
+func validateEmissionOverride(multiplier float64, durationMinutes int) string {
+	if multiplier < 0 || multiplier > maxEmissionMultiplier {
+		return "INVALID_MULTIPLIER"
+	}
+	duration := time.Duration(durationMinutes) * time.Minute
+	if duration <= 0 || duration > maxEmissionMultiplierDuration {
+		return "INVALID_DURATION"
+	}
+	return ""
+}
+
+func executeEmissionOverride(db *sql.DB, action PendingAdminAction) string {
+	req := AdminEconomyControlRequest{
+		SeasonID:        pendingPayloadString(action.Payload, "seasonId"),
+		Action:          EconomyControlSetEmission,
+		Reason:          action.Reason,
+		Multiplier:      pendingPayloadFloat(action.Payload, "multiplier"),
+		DurationMinutes: int(pendingPayloadFloat(action.Payload, "durationMinutes")),
+	}
+	return applyEconomyControl(db, action.RequestedBy, req, pendingActionAuditDetails(action, nil))
+}
+
+// applyEconomyControl writes one control change for req.SeasonID, audits it
+// and tells admins. extraDetails is merged into the audit entry.
+func applyEconomyControl(db *sql.DB, actorAccountID string, req AdminEconomyControlRequest, extraDetails map[string]interface{}) string {
+	seasonID := req.SeasonID
+	reason := req.Reason
+	now := time.Now().UTC()
+
+	var update string
+	args := []interface{}{seasonID, actorAccountID, now}
+	details := map[string]interface{}{"seasonId": seasonID}
+	for key, value := range extraDetails {
+		details[key] = value
+	}
+	message := ""
+	priority := NotificationPriorityHigh
+	switch req.Action {
+	case EconomyControlPausePurchases:
+		update = "purchases_paused = TRUE, purchases_paused_reason = $4"
+		args = append(args, reason)
+		message = "Star purchases paused for " + seasonID + "."
+	case EconomyControlResumePurchases:
+		update = "purchases_paused = FALSE, purchases_paused_reason = NULL"
+		message = "Star purchases resumed for " + seasonID + "."
+		priority = NotificationPriorityNormal
+	case EconomyControlSetEmission:
+		if errCode := validateEmissionOverride(req.Multiplier, req.DurationMinutes); errCode != "" {
+			return errCode
+		}
+		expiresAt := now.Add(time.Duration(req.DurationMinutes) * time.Minute)
+		update = "emission_multiplier = $4, emission_multiplier_expires_at = $5, emission_reason = $6"
+		args = append(args, req.Multiplier, expiresAt, reason)
+		details["multiplier"] = req.Multiplier
+		details["expiresAt"] = expiresAt.Format(time.RFC3339)
+		message = "Emission multiplier set to " + strconv.FormatFloat(req.Multiplier, 'f', -1, 64) + "x until " + expiresAt.Format(time.RFC3339) + "."
+	case EconomyControlClearEmission:
+		update = "emission_multiplier = 1, emission_multiplier_expires_at = NULL, emission_reason = NULL"
+		message = "Emission multiplier cleared for " + seasonID + "."
+		priority = NotificationPriorityNormal
+	case EconomyControlFreeze:
+		update = "frozen = TRUE, frozen_reason = $4"
+		args = append(args, reason)
+		message = "Season " + seasonID + " frozen: all faucets and sinks are rejected."
+		priority = NotificationPriorityCritical
+	case EconomyControlUnfreeze:
+		update = "frozen = FALSE, frozen_reason = NULL"
+		message = "Season " + seasonID + " unfrozen."
+	default:
+		return "INVALID_ACTION"
+	}
+
+	if _, err := db.Exec(`
+		INSERT INTO season_controls (season_id, updated_by, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (season_id) DO NOTHING
+	`, seasonID, actorAccountID, now); err != nil {
+		return "INTERNAL_ERROR"
+	}
+	if _, err := db.Exec(`
+		UPDATE season_controls
+		SET `+update+`, updated_by = $2, updated_at = $3
+		WHERE season_id = $1
+	`, args...); err != nil {
+		return "INTERNAL_ERROR"
+	}
+	if err := loadSeasonControls(db); err != nil {
+		log.Println("season controls reload failed:", err)
+	}
+
+	if err := logAdminAction(db, actorAccountID, "economy_control_"+req.Action, "season", seasonID, reason, details); err != nil {
+		log.Println("economy control audit failed:", err)
+	}
+	emitNotification(db, NotificationInput{
+		RecipientRole: NotificationRoleAdmin,
+		SeasonID:      seasonID,
+		Category:      NotificationCategoryEconomy,
+		Type:          "economy_control",
+		Priority:      priority,
+		Message:       message + " Reason: " + reason,
+		Link:          "#/admin",
+		Payload: map[string]interface{}{
+			"action":         req.Action,
+			"seasonId":       seasonID,
+			"adminAccountId": actorAccountID,
+			"reason":         reason,
+		},
+	})
+	publishEconomyUpdate()
+	return ""
+}
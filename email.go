@@ -1,48 +1,251 @@
 package main
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
 	"net/smtp"
+	"net/textproto"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-func sendPasswordResetEmail(to string, token string, baseURL string) error {
-	host := os.Getenv("SMTP_HOST")
-	portStr := os.Getenv("SMTP_PORT")
-	user := os.Getenv("SMTP_USER")
-	pass := os.Getenv("SMTP_PASS")
-	from := os.Getenv("SMTP_FROM")
-	if host == "" || user == "" || pass == "" || from == "" {
-		return errors.New("EMAIL_NOT_CONFIGURED")
+// Mail goes through a Mailer so the transport can be swapped. MAIL_TRANSPORT
+// picks one at startup: "smtp" (the default), "file", which writes each
+// message as an .eml file under MAIL_DROP_DIR, or "memory", which keeps every
+// message in process for tests and local runs.
+//
+// Request handlers never call a Mailer directly; they queue mail with
+// enqueueMail and the outbox worker delivers it.
+type MailMessage struct {
+	To       string
+	Subject  string
+	TextBody string
+	HTMLBody string
+}
+
+type Mailer interface {
+	Send(msg MailMessage) error
+}
+
+type smtpConfig struct {
+	host string
+	port int
+	user string
+	pass string
+	from string
+}
+
+func smtpConfigFromEnv() (smtpConfig, error) {
+	cfg := smtpConfig{
+		host: os.Getenv("SMTP_HOST"),
+		user: os.Getenv("SMTP_USER"),
+		pass: os.Getenv("SMTP_PASS"),
+		from: os.Getenv("SMTP_FROM"),
+	}
+	if cfg.host == "" || cfg.user == "" || cfg.pass == "" || cfg.from == "" {
+		return cfg, errors.New("EMAIL_NOT_CONFIGURED")
 	}
+	portStr := os.Getenv("SMTP_PORT")
 	if portStr == "" {
 		portStr = "587"
 	}
 	port, err := strconv.Atoi(portStr)
 	if err != nil {
-		return errors.New("EMAIL_NOT_CONFIGURED")
+		return cfg, errors.New("EMAIL_NOT_CONFIGURED")
+	}
+	cfg.port = port
+	return cfg, nil
+}
+
+type smtpMailer struct{}
+
+func (smtpMailer) Send(msg MailMessage) error {
+	cfg, err := smtpConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	raw, err := buildMIMEMessage(cfg.from, msg)
+	if err != nil {
+		return err
 	}
+	addr := fmt.Sprintf("%s:%d", cfg.host, cfg.port)
+	auth := smtp.PlainAuth("", cfg.user, cfg.pass, cfg.host)
+	return smtp.SendMail(addr, auth, cfg.from, []string{msg.To}, raw)
+}
 
-	baseURL = strings.TrimRight(baseURL, "/")
-	resetLink := fmt.Sprintf("%s/#/reset?token=%s", baseURL, token)
+// fileMailer drops each message into dir as an .eml file that any mail client
+// can open.
+type fileMailer struct {
+	dir string
+}
+
+func (m fileMailer) Send(msg MailMessage) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+	raw, err := buildMIMEMessage(from, msg)
+	if err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+	return os.WriteFile(filepath.Join(m.dir, name), raw, 0o644)
+}
 
-	subject := "Too Many Coins password reset"
-	body := fmt.Sprintf("Use this link to reset your password:\n\n%s\n\nIf you did not request a reset, you can ignore this email.", resetLink)
+// MemoryMailer records messages instead of sending them.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []MailMessage
+}
 
-	msg := strings.Join([]string{
+func (m *MemoryMailer) Send(msg MailMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func (m *MemoryMailer) Outbox() []MailMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]MailMessage, len(m.messages))
+	copy(out, m.messages)
+	return out
+}
+
+// buildMIMEMessage renders msg as a plain-text message, or as
+// multipart/alternative when it has an HTML body.
+func buildMIMEMessage(from string, msg MailMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	headers := []string{
 		"From: " + from,
-		"To: " + to,
-		"Subject: " + subject,
+		"To: " + msg.To,
+		"Subject: " + msg.Subject,
+		"Date: " + time.Now().UTC().Format(time.RFC1123Z),
 		"MIME-Version: 1.0",
-		"Content-Type: text/plain; charset=utf-8",
-		"",
-		body,
-	}, "\r\n")
-
-	addr := fmt.Sprintf("%s:%d", host, port)
-	auth := smtp.PlainAuth("", user, pass, host)
-	return smtp.SendMail(addr, auth, from, []string{to}, []byte(msg))
+	}
+	if msg.HTMLBody == "" {
+		headers = append(headers, "Content-Type: text/plain; charset=utf-8", "", msg.TextBody)
+		buf.WriteString(strings.Join(headers, "\r\n"))
+		return buf.Bytes(), nil
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", msg.TextBody},
+		{"text/html; charset=utf-8", msg.HTMLBody},
+	} {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.contentType)
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		w, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	headers = append(headers, "Content-Type: multipart/alternative; boundary="+writer.Boundary(), "", "")
+	buf.WriteString(strings.Join(headers, "\r\n"))
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
+
+var (
+	mailerMu     sync.RWMutex
+	activeMailer Mailer = defaultMailer()
+)
+
+func defaultMailer() Mailer {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("MAIL_TRANSPORT"))) {
+	case "memory":
+		return &MemoryMailer{}
+	case "file":
+		dir := strings.TrimSpace(os.Getenv("MAIL_DROP_DIR"))
+		if dir == "" {
+			dir = "mail-drop"
+		}
+		return fileMailer{dir: dir}
+	default:
+		return smtpMailer{}
+	}
+}
+
+func currentMailer() Mailer {
+	mailerMu.RLock()
+	defer mailerMu.RUnlock()
+	return activeMailer
+}
+
+// setMailer replaces the transport, e.g. with a MemoryMailer in tests.
+func setMailer(m Mailer) {
+	mailerMu.Lock()
+	activeMailer = m
+	mailerMu.Unlock()
+}
+
+// mailTransportConfigured reports whether queued mail has somewhere to go.
+// Only SMTP needs settings; the file and memory transports always work.
+func mailTransportConfigured() bool {
+	if _, ok := currentMailer().(smtpMailer); ok {
+		_, err := smtpConfigFromEnv()
+		return err == nil
+	}
+	return true
+}
+
+func appBaseURL(r *http.Request) string {
+	baseURL := os.Getenv("APP_BASE_URL")
+	if baseURL == "" {
+		scheme := "https"
+		if r.Header.Get("X-Forwarded-Proto") != "" {
+			scheme = r.Header.Get("X-Forwarded-Proto")
+		} else if r.TLS == nil {
+			scheme = "http"
+		}
+		baseURL = scheme + "://" + r.Host
+	}
+	return strings.TrimRight(baseURL, "/")
+}
+
+// configuredBaseURL is the site URL for mail sent outside a request.
+func configuredBaseURL() string {
+	baseURL := strings.TrimRight(os.Getenv("APP_BASE_URL"), "/")
+	if baseURL == "" {
+		port := os.Getenv("PORT")
+		if port == "" {
+			port = "8080"
+		}
+		return "http://localhost:" + port
+	}
+	return baseURL
 }
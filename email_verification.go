@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EmailVerificationSignup = "signup"
+	EmailVerificationChange = "change"
+
+	emailVerificationTTL = 24 * time.Hour
+)
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type EmailVerificationResponse struct {
+	OK           bool   `json:"ok"`
+	Error        string `json:"error,omitempty"`
+	Email        string `json:"email,omitempty"`
+	PendingEmail string `json:"pendingEmail,omitempty"`
+	Verified     bool   `json:"verified"`
+}
+
+// EmailStatus is the verification state of an account's address. A changed
+// address stays in PendingEmail until the link sent to it is used; until
+// then Email keeps the old (possibly verified) address.
+type EmailStatus struct {
+	Email        string
+	Verified     bool
+	PendingEmail string
+}
+
+func loadEmailStatus(db *sql.DB, accountID string) (EmailStatus, error) {
+	var status EmailStatus
+	var email, pending sql.NullString
+	var verifiedAt sql.NullTime
+	err := db.QueryRow(`
+		SELECT email, email_verified_at, pending_email
+		FROM accounts
+		WHERE account_id = $1
+	`, accountID).Scan(&email, &verifiedAt, &pending)
+	if err != nil {
+		return status, err
+	}
+	status.Email = email.String
+	status.Verified = email.Valid && email.String != "" && verifiedAt.Valid
+	status.PendingEmail = pending.String
+	return status, nil
+}
+
+func createEmailVerificationToken(db *sql.DB, accountID string, email string, purpose string) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	_, err = db.Exec(`
+		INSERT INTO email_verifications (token_hash, account_id, email, purpose, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, NOW(), $5)
+	`, hashToken(token), accountID, email, purpose, time.Now().UTC().Add(emailVerificationTTL))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// startEmailVerification issues a token for email and queues the link to it.
+// It returns EMAIL_NOT_CONFIGURED when there is no mail transport.
+func startEmailVerification(db *sql.DB, accountID string, email string, purpose string, baseURL string) error {
+	if !mailTransportConfigured() {
+		return errors.New("EMAIL_NOT_CONFIGURED")
+	}
+	token, err := createEmailVerificationToken(db, accountID, email, purpose)
+	if err != nil {
+		return err
+	}
+	return sendVerificationEmail(db, email, token, baseURL)
+}
+
+// confirmEmailVerification consumes a token. A signup token marks the current
+// address verified; a change token promotes the pending address. Either is
+// rejected with EMAIL_CHANGED if the account has since moved to a different
+// address.
+func confirmEmailVerification(db *sql.DB, token string) (string, error) {
+	if token == "" {
+		return "", errors.New("INVALID_TOKEN")
+	}
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var accountID, email, purpose string
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	err = tx.QueryRow(`
+		SELECT account_id, email, purpose, expires_at, used_at
+		FROM email_verifications
+		WHERE token_hash = $1
+		FOR UPDATE
+	`, hashToken(token)).Scan(&accountID, &email, &purpose, &expiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		return "", errors.New("INVALID_TOKEN")
+	}
+	if err != nil {
+		return "", err
+	}
+	if usedAt.Valid {
+		return "", errors.New("TOKEN_USED")
+	}
+	if time.Now().UTC().After(expiresAt) {
+		return "", errors.New("TOKEN_EXPIRED")
+	}
+
+	var res sql.Result
+	switch purpose {
+	case EmailVerificationChange:
+		var taken bool
+		if err := tx.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM accounts WHERE account_id <> $1 AND email = $2)
+		`, accountID, email).Scan(&taken); err != nil {
+			return "", err
+		}
+		if taken {
+			return "", errors.New("EMAIL_IN_USE")
+		}
+		res, err = tx.Exec(`
+			UPDATE accounts
+			SET email = pending_email,
+				pending_email = NULL,
+				email_verified_at = NOW()
+			WHERE account_id = $1 AND pending_email = $2
+		`, accountID, email)
+	default:
+		res, err = tx.Exec(`
+			UPDATE accounts
+			SET email_verified_at = NOW()
+			WHERE account_id = $1 AND email = $2
+		`, accountID, email)
+	}
+	if err != nil {
+		return "", err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return "", errors.New("EMAIL_CHANGED")
+	}
+	if _, err := tx.Exec(`
+		UPDATE email_verifications
+		SET used_at = NOW()
+		WHERE token_hash = $1
+	`, hashToken(token)); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return email, nil
+}
+
+// emailInUse reports whether another account already has email as its
+// address or as a change waiting for confirmation.
+func emailInUse(db *sql.DB, accountID string, email string) (bool, error) {
+	var inUse bool
+	err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM accounts
+			WHERE account_id <> $1 AND (email = $2 OR pending_email = $2)
+		)
+	`, accountID, email).Scan(&inUse)
+	return inUse, err
+}
+
+// updateAccountEmail applies a profile email edit. Clearing the address takes
+// effect at once; a new address is held as pending and a confirmation link is
+// sent to it. Re-entering the current address cancels any pending change. An
+// address another account uses or is confirming is refused with EMAIL_IN_USE
+// before any link is sent.
+func updateAccountEmail(db *sql.DB, accountID string, newEmail string, baseURL string) (EmailStatus, error) {
+	current, err := loadEmailStatus(db, accountID)
+	if err != nil {
+		return current, err
+	}
+	switch {
+	case newEmail == "":
+		_, err = db.Exec(`
+			UPDATE accounts
+			SET email = NULL, email_verified_at = NULL, pending_email = NULL
+			WHERE account_id = $1
+		`, accountID)
+		return EmailStatus{}, err
+	case newEmail == current.Email:
+		if current.PendingEmail != "" {
+			if _, err := db.Exec(`UPDATE accounts SET pending_email = NULL WHERE account_id = $1`, accountID); err != nil {
+				return current, err
+			}
+			current.PendingEmail = ""
+		}
+		return current, nil
+	case newEmail == current.PendingEmail:
+		return current, nil
+	}
+
+	inUse, err := emailInUse(db, accountID, newEmail)
+	if err != nil {
+		return current, err
+	}
+	if inUse {
+		return current, errors.New("EMAIL_IN_USE")
+	}
+	if _, err := db.Exec(`UPDATE accounts SET pending_email = $2 WHERE account_id = $1`, accountID, newEmail); err != nil {
+		return current, err
+	}
+	current.PendingEmail = newEmail
+	if err := startEmailVerification(db, accountID, newEmail, EmailVerificationChange, baseURL); err != nil {
+		log.Println("profile: email verification error:", err)
+	}
+	return current, nil
+}
+
+func verifyEmailHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var req VerifyEmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Token) == "" {
+			json.NewEncoder(w).Encode(EmailVerificationResponse{OK: false, Error: "INVALID_REQUEST"})
+			return
+		}
+		email, err := confirmEmailVerification(db, strings.TrimSpace(req.Token))
+		if err != nil {
+			switch err.Error() {
+			case "INVALID_TOKEN", "TOKEN_USED", "TOKEN_EXPIRED", "EMAIL_CHANGED", "EMAIL_IN_USE":
+				json.NewEncoder(w).Encode(EmailVerificationResponse{OK: false, Error: err.Error()})
+			default:
+				log.Println("verify email: error:", err)
+				json.NewEncoder(w).Encode(EmailVerificationResponse{OK: false, Error: "INTERNAL_ERROR"})
+			}
+			return
+		}
+		json.NewEncoder(w).Encode(EmailVerificationResponse{OK: true, Email: email, Verified: true})
+	}
+}
+
+// resendVerificationHandler re-sends the link for a pending change, or for
+// the current address if it has never been verified.
+func resendVerificationHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		account, ok := requireSession(db, w, r)
+		if !ok {
+			return
+		}
+		limit, window := authRateLimitConfig("verify_email")
+		allowed, retryAfter, err := checkAuthRateLimit(db, getClientIP(r), "verify_email", limit, window)
+		if err != nil {
+			json.NewEncoder(w).Encode(EmailVerificationResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(EmailVerificationResponse{OK: false, Error: "RATE_LIMIT"})
+			return
+		}
+
+		status, err := loadEmailStatus(db, account.AccountID)
+		if err != nil {
+			json.NewEncoder(w).Encode(EmailVerificationResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		target, purpose := status.PendingEmail, EmailVerificationChange
+		if target == "" {
+			if status.Email == "" {
+				json.NewEncoder(w).Encode(EmailVerificationResponse{OK: false, Error: "EMAIL_NOT_SET"})
+				return
+			}
+			if status.Verified {
+				json.NewEncoder(w).Encode(EmailVerificationResponse{OK: false, Error: "EMAIL_ALREADY_VERIFIED", Email: status.Email, Verified: true})
+				return
+			}
+			target, purpose = status.Email, EmailVerificationSignup
+		}
+		if err := startEmailVerification(db, account.AccountID, target, purpose, appBaseURL(r)); err != nil {
+			switch err.Error() {
+			case "EMAIL_NOT_CONFIGURED":
+				json.NewEncoder(w).Encode(EmailVerificationResponse{OK: false, Error: err.Error()})
+			default:
+				log.Println("resend verification: error:", err)
+				json.NewEncoder(w).Encode(EmailVerificationResponse{OK: false, Error: "INTERNAL_ERROR"})
+			}
+			return
+		}
+		json.NewEncoder(w).Encode(EmailVerificationResponse{
+			OK:           true,
+			Email:        status.Email,
+			PendingEmail: status.PendingEmail,
+			Verified:     status.Verified,
+		})
+	}
+}
@@ -5,26 +5,51 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 )
 
 type liveSeasonSnapshot struct {
-	SeasonID                string   `json:"seasonId"`
-	Status                  string   `json:"status"`
-	SeasonStatus            string   `json:"season_status"`
-	SeasonStartTime         string   `json:"seasonStartTime"`
-	SeasonEndTime           string   `json:"seasonEndTime"`
-	DayIndex                int      `json:"dayIndex"`
-	TotalDays               int      `json:"totalDays"`
-	SecondsRemaining        int64    `json:"secondsRemaining"`
-	CoinsInCirculation      *int64   `json:"coinsInCirculation,omitempty"`
-	CoinEmissionPerMinute   *float64 `json:"coinEmissionPerMinute,omitempty"`
-	CurrentStarPrice        *int     `json:"currentStarPrice,omitempty"`
-	NextEmissionInSeconds   *int64   `json:"nextEmissionInSeconds,omitempty"`
-	MarketPressure          *float64 `json:"marketPressure,omitempty"`
-	FinalStarPrice          *int     `json:"finalStarPrice,omitempty"`
-	FinalCoinsInCirculation *int64   `json:"finalCoinsInCirculation,omitempty"`
-	EndedAt                 *string  `json:"endedAt,omitempty"`
+	SeasonID                string              `json:"seasonId"`
+	Status                  string              `json:"status"`
+	SeasonStatus            string              `json:"season_status"`
+	SeasonStartTime         string              `json:"seasonStartTime"`
+	SeasonEndTime           string              `json:"seasonEndTime"`
+	DayIndex                int                 `json:"dayIndex"`
+	TotalDays               int                 `json:"totalDays"`
+	SecondsRemaining        int64               `json:"secondsRemaining"`
+	CoinsInCirculation      *int64              `json:"coinsInCirculation,omitempty"`
+	CoinEmissionPerMinute   *float64            `json:"coinEmissionPerMinute,omitempty"`
+	CurrentStarPrice        *int                `json:"currentStarPrice,omitempty"`
+	NextEmissionInSeconds   *int64              `json:"nextEmissionInSeconds,omitempty"`
+	MarketPressure          *float64            `json:"marketPressure,omitempty"`
+	FinalStarPrice          *int                `json:"finalStarPrice,omitempty"`
+	FinalCoinsInCirculation *int64              `json:"finalCoinsInCirculation,omitempty"`
+	EndedAt                 *string             `json:"endedAt,omitempty"`
+	Controls                *liveSeasonControls `json:"controls,omitempty"`
+}
+
+// liveSeasonControls is the public view of admin economy controls; reasons
+// stay in the admin audit log.
+type liveSeasonControls struct {
+	PurchasesPaused             bool    `json:"purchasesPaused"`
+	Frozen                      bool    `json:"frozen"`
+	EmissionMultiplier          float64 `json:"emissionMultiplier"`
+	EmissionMultiplierExpiresAt *string `json:"emissionMultiplierExpiresAt,omitempty"`
+}
+
+func buildLiveSeasonControls(now time.Time) *liveSeasonControls {
+	controls := currentSeasonControls()
+	live := &liveSeasonControls{
+		PurchasesPaused:    controls.PurchasesPaused,
+		Frozen:             controls.Frozen,
+		EmissionMultiplier: controls.activeEmissionMultiplier(now),
+	}
+	if live.EmissionMultiplier != 1 && controls.EmissionMultiplierExpiresAt != nil {
+		expires := controls.EmissionMultiplierExpiresAt.Format(time.RFC3339)
+		live.EmissionMultiplierExpiresAt = &expires
+	}
+	return live
 }
 
 type liveSnapshot struct {
@@ -35,7 +60,7 @@ type liveSnapshot struct {
 	PlayerStars   int64              `json:"playerStars,omitempty"`
 }
 
-func buildLiveSnapshot(db *sql.DB, r *http.Request) liveSnapshot {
+func buildLiveSnapshotForAccount(db *sql.DB, account *Account) liveSnapshot {
 	now := time.Now().UTC()
 	ended := isSeasonEnded(now)
 	remaining := seasonSecondsRemaining(now)
@@ -128,10 +153,11 @@ func buildLiveSnapshot(db *sql.DB, r *http.Request) liveSnapshot {
 			FinalStarPrice:          finalPrice,
 			FinalCoinsInCirculation: finalCoins,
 			EndedAt:                 endedAt,
+			Controls:                buildLiveSeasonControls(now),
 		},
 	}
 
-	if account, _, err := getSessionAccount(db, r); err == nil && account != nil {
+	if account != nil {
 		snapshot.Authenticated = true
 		if snapshot.Season.CurrentStarPrice != nil {
 			price := computePlayerStarPrice(db, account.PlayerID, coins, remaining)
@@ -146,6 +172,37 @@ func buildLiveSnapshot(db *sql.DB, r *http.Request) liveSnapshot {
 	return snapshot
 }
 
+func writeSSEEvent(w http.ResponseWriter, flusher http.Flusher, id string, event string, payload interface{}) bool {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return true
+	}
+	if id != "" {
+		if _, err := w.Write([]byte("id: " + id + "\n")); err != nil {
+			return false
+		}
+	}
+	if _, err := w.Write([]byte("event: " + event + "\n")); err != nil {
+		return false
+	}
+	if _, err := w.Write([]byte("data: ")); err != nil {
+		return false
+	}
+	if _, err := w.Write(data); err != nil {
+		return false
+	}
+	if _, err := w.Write([]byte("\n\n")); err != nil {
+		return false
+	}
+	flusher.Flush()
+	return true
+}
+
+// eventsHandler sends a full snapshot on connect and then forwards pushed
+// deltas from the live hub: economy (price, pressure, emission), balance for
+// the signed-in player, and a fresh snapshot when the season changes state.
+// Every frame carries the hub event ID; a reconnect within the replay buffer
+// receives only the missed deltas, otherwise it starts from a new snapshot.
 func eventsHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		flusher, ok := w.(http.Flusher)
@@ -159,41 +216,118 @@ func eventsHandler(db *sql.DB) http.HandlerFunc {
 		w.Header().Set("Connection", "keep-alive")
 		w.Header().Set("X-Accel-Buffering", "no")
 
-		sendSnapshot := func() bool {
-			payload, err := json.Marshal(buildLiveSnapshot(db, r))
-			if err != nil {
-				return false
-			}
-			if _, err := w.Write([]byte("event: snapshot\n")); err != nil {
-				return false
-			}
-			if _, err := w.Write([]byte("data: ")); err != nil {
+		account := optionalScopedSession(db, r, ScopeReadPlayer)
+		playerID := ""
+		if account != nil {
+			playerID = account.PlayerID
+		}
+
+		// EventSource resends the last seen id as Last-Event-ID on reconnect;
+		// ?lastEventId= covers clients that open a fresh EventSource.
+		lastEventID := strings.TrimSpace(r.Header.Get("Last-Event-ID"))
+		if lastEventID == "" {
+			lastEventID = strings.TrimSpace(r.URL.Query().Get("lastEventId"))
+		}
+
+		sub, replay, resumed := liveHub.SubscribeFrom(lastEventID, func(event HubEvent) bool {
+			switch event.Type {
+			case HubEventEconomy, HubEventSeason:
+				return true
+			case HubEventBalance:
+				return playerID != "" && event.PlayerID == playerID
+			case HubEventLeaderboard:
+				return playerID != ""
+			default:
 				return false
 			}
-			if _, err := w.Write(payload); err != nil {
-				return false
+		})
+		defer liveHub.Unsubscribe(sub)
+
+		// lastRank is the rank last reported to this stream; a leaderboard
+		// refresh only produces a rank_changed frame when it differs.
+		lastRank := 0
+		if playerID != "" {
+			lastRank, _ = playerStarRank(db, playerID)
+		}
+
+		var adjustment playerPriceAdjustment
+		refreshAdjustment := func() {
+			if playerID != "" {
+				adjustment = loadPlayerPriceAdjustment(db, playerID)
 			}
-			if _, err := w.Write([]byte("\n\n")); err != nil {
-				return false
+		}
+		sendSnapshot := func(id string) bool {
+			refreshAdjustment()
+			return writeSSEEvent(w, flusher, id, "snapshot", buildLiveSnapshotForAccount(db, account))
+		}
+		sendEvent := func(event HubEvent) bool {
+			id := event.ID
+			switch event.Type {
+			case HubEventEconomy:
+				delta, ok := event.Payload.(EconomyDelta)
+				if !ok {
+					return true
+				}
+				if playerID != "" {
+					delta.CurrentStarPrice = adjustment.Apply(delta.CurrentStarPrice)
+				}
+				return writeSSEEvent(w, flusher, id, "economy", delta)
+			case HubEventBalance:
+				// Player actions can change dampening or abuse enforcement,
+				// so refresh the cached price modifiers alongside the balance.
+				refreshAdjustment()
+				return writeSSEEvent(w, flusher, id, "balance", event.Payload)
+			case HubEventLeaderboard:
+				delta, ok := event.Payload.(LeaderboardDelta)
+				if !ok {
+					return true
+				}
+				rank, stars, ok := playerRankStanding(db, event, delta.SeasonID, playerID)
+				if !ok || rank == lastRank {
+					return true
+				}
+				change := RankChangedDelta{SeasonID: delta.SeasonID, Rank: rank, PreviousRank: lastRank, Stars: stars}
+				lastRank = rank
+				return writeSSEEvent(w, flusher, id, "rank_changed", change)
+			case HubEventSeason:
+				return sendSnapshot(event.ID)
 			}
-			flusher.Flush()
 			return true
 		}
 
-		if !sendSnapshot() {
+		if resumed {
+			refreshAdjustment()
+			for _, event := range replay {
+				if !sendEvent(event) {
+					return
+				}
+			}
+			flusher.Flush()
+		} else if !sendSnapshot(liveHub.LastID()) {
 			return
 		}
 
-		ticker := time.NewTicker(2 * time.Second)
-		defer ticker.Stop()
+		heartbeat := time.NewTicker(25 * time.Second)
+		defer heartbeat.Stop()
 
 		ctx := r.Context()
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case <-ticker.C:
-				if !sendSnapshot() {
+			case <-heartbeat.C:
+				if _, err := w.Write([]byte(": ping\n\n")); err != nil {
+					return
+				}
+				flusher.Flush()
+			case event := <-sub.Events():
+				if sub.TakeLagged() {
+					if !sendSnapshot(liveHub.LastID()) {
+						return
+					}
+					continue
+				}
+				if !sendEvent(event) {
 					return
 				}
 			}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Leaderboard exports stream straight from the result set to the response so
+// a full season never has to fit in memory. Columns flagged private are only
+// written by the admin export.
+const (
+	exportFormatCSV    = "csv"
+	exportFormatNDJSON = "ndjson"
+
+	exportSourceLive  = "live"
+	exportSourceFinal = "final"
+
+	exportFlushEvery = 200
+)
+
+type exportColumnKind int
+
+const (
+	exportString exportColumnKind = iota
+	exportInt
+	exportBool
+)
+
+type exportColumn struct {
+	Name    string
+	Expr    string
+	Kind    exportColumnKind
+	Private bool
+}
+
+var liveExportColumns = []exportColumn{
+	{Name: "rank", Expr: "lr.rank", Kind: exportInt},
+	{Name: "playerId", Expr: "lr.player_id", Kind: exportString},
+	{Name: "displayName", Expr: "COALESCE(a.display_name, a.username, lr.player_id)", Kind: exportString},
+	{Name: "stars", Expr: "lr.stars", Kind: exportInt},
+	{Name: "coinsSpentLifetime", Expr: "lr.coins_spent_lifetime", Kind: exportInt},
+	{Name: "lastStarAcquiredAt", Expr: "to_char(lr.last_star_acquired_at AT TIME ZONE 'UTC', 'YYYY-MM-DD\"T\"HH24:MI:SS\"Z\"')", Kind: exportString},
+	{Name: "isBot", Expr: "p.is_bot", Kind: exportBool},
+	{Name: "accountId", Expr: "a.account_id", Kind: exportString, Private: true},
+	{Name: "username", Expr: "a.username", Kind: exportString, Private: true},
+	{Name: "email", Expr: "a.email", Kind: exportString, Private: true},
+	{Name: "coins", Expr: "p.coins", Kind: exportInt, Private: true},
+	{Name: "botProfile", Expr: "p.bot_profile", Kind: exportString, Private: true},
+}
+
+var finalExportColumns = []exportColumn{
+	{Name: "rank", Expr: "f.final_rank", Kind: exportInt},
+	{Name: "playerId", Expr: "f.player_id", Kind: exportString},
+	{Name: "displayName", Expr: "COALESCE(a.display_name, a.username, f.player_id)", Kind: exportString},
+	{Name: "stars", Expr: "f.stars", Kind: exportInt},
+	{Name: "tier", Expr: "f.tier", Kind: exportString},
+	{Name: "capturedAt", Expr: "to_char(f.captured_at AT TIME ZONE 'UTC', 'YYYY-MM-DD\"T\"HH24:MI:SS\"Z\"')", Kind: exportString},
+	{Name: "accountId", Expr: "a.account_id", Kind: exportString, Private: true},
+	{Name: "username", Expr: "a.username", Kind: exportString, Private: true},
+	{Name: "email", Expr: "a.email", Kind: exportString, Private: true},
+	{Name: "coins", Expr: "f.coins", Kind: exportInt, Private: true},
+}
+
+type leaderboardExportRequest struct {
+	Format   string
+	Source   string
+	SeasonID string
+}
+
+func parseLeaderboardExportRequest(r *http.Request) (leaderboardExportRequest, string) {
+	query := r.URL.Query()
+	req := leaderboardExportRequest{
+		Format:   strings.ToLower(strings.TrimSpace(query.Get("format"))),
+		Source:   strings.ToLower(strings.TrimSpace(query.Get("source"))),
+		SeasonID: strings.TrimSpace(query.Get("seasonId")),
+	}
+	if req.Format == "" {
+		req.Format = exportFormatCSV
+	}
+	if req.Format != exportFormatCSV && req.Format != exportFormatNDJSON {
+		return req, "INVALID_FORMAT"
+	}
+	if req.Source == "" {
+		req.Source = exportSourceLive
+	}
+	if req.Source != exportSourceLive && req.Source != exportSourceFinal {
+		return req, "INVALID_SOURCE"
+	}
+	if req.SeasonID == "" {
+		req.SeasonID = currentSeasonID()
+	}
+	return req, ""
+}
+
+func leaderboardExportHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		req, errCode := parseLeaderboardExportRequest(r)
+		if errCode != "" {
+			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: errCode})
+			return
+		}
+		streamLeaderboardExport(db, w, req, false)
+	}
+}
+
+func adminLeaderboardExportHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		admin, ok := requirePermission(db, w, r, PermExportData)
+		if !ok {
+			return
+		}
+		req, errCode := parseLeaderboardExportRequest(r)
+		if errCode != "" {
+			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: errCode})
+			return
+		}
+		// Admin exports include emails, so every download is audited.
+		_ = logAdminAction(db, admin.AccountID, "leaderboard_export", "season", req.SeasonID, "", map[string]interface{}{
+			"format": req.Format,
+			"source": req.Source,
+		})
+		streamLeaderboardExport(db, w, req, true)
+	}
+}
+
+func streamLeaderboardExport(db *sql.DB, w http.ResponseWriter, req leaderboardExportRequest, includePrivate bool) {
+	columns := liveExportColumns
+	from := `
+		FROM leaderboard_ranks lr
+		JOIN players p ON p.player_id = lr.player_id
+		LEFT JOIN accounts a ON a.player_id = lr.player_id
+		WHERE lr.season_id = $1
+		ORDER BY lr.rank ASC
+	`
+	if req.Source == exportSourceFinal {
+		columns = finalExportColumns
+		from = `
+			FROM season_final_rankings f
+			LEFT JOIN accounts a ON a.player_id = f.player_id
+			WHERE f.season_id = $1
+			ORDER BY f.final_rank ASC NULLS LAST, f.stars DESC, f.player_id ASC
+		`
+		var finalized bool
+		if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM season_final_rankings WHERE season_id = $1)`, req.SeasonID).Scan(&finalized); err != nil {
+			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if !finalized {
+			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "SEASON_NOT_FINALIZED"})
+			return
+		}
+	}
+
+	selected := []exportColumn{}
+	exprs := []string{}
+	for _, column := range columns {
+		if column.Private && !includePrivate {
+			continue
+		}
+		selected = append(selected, column)
+		exprs = append(exprs, column.Expr)
+	}
+
+	rows, err := db.Query("SELECT "+strings.Join(exprs, ", ")+from, req.SeasonID)
+	if err != nil {
+		json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "INTERNAL_ERROR"})
+		return
+	}
+	defer rows.Close()
+
+	filename := "leaderboard-" + req.Source + "-" + req.SeasonID + "-" + time.Now().UTC().Format("20060102T150405Z")
+	if req.Format == exportFormatCSV {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		filename += ".csv"
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		filename += ".ndjson"
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+	flusher, _ := w.(http.Flusher)
+
+	values := make([]sql.NullString, len(selected))
+	scanTargets := make([]interface{}, len(selected))
+	for i := range values {
+		scanTargets[i] = &values[i]
+	}
+
+	var csvWriter *csv.Writer
+	var line bytes.Buffer
+	if req.Format == exportFormatCSV {
+		csvWriter = csv.NewWriter(w)
+		header := make([]string, len(selected))
+		for i, column := range selected {
+			header[i] = column.Name
+		}
+		if err := csvWriter.Write(header); err != nil {
+			return
+		}
+	}
+
+	written := 0
+	record := make([]string, len(selected))
+	for rows.Next() {
+		if err := rows.Scan(scanTargets...); err != nil {
+			abortExport(err)
+		}
+		if csvWriter != nil {
+			for i, value := range values {
+				record[i] = exportCSVValue(selected[i].Kind, value.String)
+			}
+			if err := csvWriter.Write(record); err != nil {
+				return
+			}
+		} else {
+			line.Reset()
+			if err := writeNDJSONRow(&line, selected, values); err != nil {
+				abortExport(err)
+			}
+			if _, err := w.Write(line.Bytes()); err != nil {
+				return
+			}
+		}
+		written++
+		if written%exportFlushEvery == 0 {
+			if csvWriter != nil {
+				csvWriter.Flush()
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		abortExport(err)
+	}
+	if csvWriter != nil {
+		csvWriter.Flush()
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+// abortExport ends a streaming export that failed part way. The headers are
+// already sent, so the connection is dropped without finishing the body and
+// the client sees a failed download rather than a file that looks complete.
+func abortExport(err error) {
+	log.Println("leaderboard export aborted:", err)
+	panic(http.ErrAbortHandler)
+}
+
+// writeNDJSONRow writes one object with its keys in column order.
+func writeNDJSONRow(buf *bytes.Buffer, columns []exportColumn, values []sql.NullString) error {
+	buf.WriteByte('{')
+	for i, column := range columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(column.Name)
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(exportJSONValue(column.Kind, values[i]))
+		if err != nil {
+			return err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteString("}\n")
+	return nil
+}
+
+// exportCSVValue neutralizes text cells a spreadsheet would run as a
+// formula. Text columns include player-chosen display names; numeric columns
+// come from the database and are written as is.
+func exportCSVValue(kind exportColumnKind, value string) string {
+	if kind != exportString || value == "" {
+		return value
+	}
+	switch value[0] {
+	case '=', '+', '-', '@', '\t', '\r':
+		return "'" + value
+	}
+	return value
+}
+
+func exportJSONValue(kind exportColumnKind, value sql.NullString) interface{} {
+	if !value.Valid {
+		return nil
+	}
+	switch kind {
+	case exportInt:
+		if parsed, err := strconv.ParseInt(value.String, 10, 64); err == nil {
+			return parsed
+		}
+	case exportBool:
+		return value.String == "true" || value.String == "t"
+	}
+	return value.String
+}
@@ -1,6 +1,31 @@
 package main
 
-import "os"
+import (
+	"database/sql"
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Feature flags live in the feature_flags table and are polled by every
+// instance. The ENABLE_* environment variables only seed rows that do not
+// exist yet. A flag can be limited to some phases and rolled out to a stable
+// percentage of players.
+const (
+	FlagFaucets      = "faucets"
+	FlagSinks        = "sinks"
+	FlagTelemetry    = "telemetry"
+	FlagIPThrottling = "ip_throttling"
+
+	featureFlagRefreshInterval = 3 * time.Second
+)
 
 type FeatureFlags struct {
 	FaucetsEnabled bool
@@ -9,15 +34,46 @@ type FeatureFlags struct {
 	IPThrottling   bool
 }
 
-var featureFlags = loadFeatureFlags()
+type FeatureFlag struct {
+	Key            string     `json:"key"`
+	Description    string     `json:"description,omitempty"`
+	Enabled        bool       `json:"enabled"`
+	Phases         []string   `json:"phases"`
+	RolloutPercent int        `json:"rolloutPercent"`
+	UpdatedBy      string     `json:"updatedBy,omitempty"`
+	UpdatedAt      *time.Time `json:"updatedAt,omitempty"`
+}
 
-func loadFeatureFlags() FeatureFlags {
-	return FeatureFlags{
-		FaucetsEnabled: envFlag("ENABLE_FAUCETS", true),
-		SinksEnabled:   envFlag("ENABLE_SINKS", true),
-		Telemetry:      envFlag("ENABLE_TELEMETRY", true),
-		IPThrottling:   envFlag("ENABLE_IP_THROTTLING", true),
+type featureFlagSeed struct {
+	Key         string
+	EnvName     string
+	Description string
+}
+
+var featureFlagSeeds = []featureFlagSeed{
+	{Key: FlagFaucets, EnvName: "ENABLE_FAUCETS", Description: "Daily, activity, login and passive coin faucets"},
+	{Key: FlagSinks, EnvName: "ENABLE_SINKS", Description: "Star purchases, variants, boosts and coin burns"},
+	{Key: FlagTelemetry, EnvName: "ENABLE_TELEMETRY", Description: "Server and client telemetry capture"},
+	{Key: FlagIPThrottling, EnvName: "ENABLE_IP_THROTTLING", Description: "Shared-IP dampening of prices, rewards and purchase pacing"},
+}
+
+var (
+	featureFlagsMu      sync.RWMutex
+	featureFlagRegistry = defaultFeatureFlagRegistry()
+)
+
+func defaultFeatureFlagRegistry() map[string]FeatureFlag {
+	registry := map[string]FeatureFlag{}
+	for _, seed := range featureFlagSeeds {
+		registry[seed.Key] = FeatureFlag{
+			Key:            seed.Key,
+			Description:    seed.Description,
+			Enabled:        envFlag(seed.EnvName, true),
+			Phases:         []string{},
+			RolloutPercent: 100,
+		}
 	}
+	return registry
 }
 
 func envFlag(name string, fallback bool) bool {
@@ -27,3 +83,274 @@ func envFlag(name string, fallback bool) bool {
 	}
 	return val == "true" || val == "1" || val == "yes"
 }
+
+func (f FeatureFlag) activeInPhase(phase Phase) bool {
+	if !f.Enabled {
+		return false
+	}
+	if len(f.Phases) == 0 {
+		return true
+	}
+	for _, allowed := range f.Phases {
+		if allowed == string(phase) {
+			return true
+		}
+	}
+	return false
+}
+
+// featureFlagBucket places a subject in [0, 100) for a flag. Hashing the key
+// with the subject keeps rollouts of different flags independent.
+func featureFlagBucket(key string, subject string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key + ":" + subject))
+	return int(h.Sum32() % 100)
+}
+
+func getFeatureFlag(key string) (FeatureFlag, bool) {
+	featureFlagsMu.RLock()
+	defer featureFlagsMu.RUnlock()
+	flag, ok := featureFlagRegistry[key]
+	return flag, ok
+}
+
+// featureFlagEnabledFor evaluates a flag for one subject, normally a player
+// ID. Without a subject only a full rollout counts as enabled.
+func featureFlagEnabledFor(key string, subject string) bool {
+	flag, ok := getFeatureFlag(key)
+	if !ok || !flag.activeInPhase(CurrentPhase()) {
+		return false
+	}
+	if flag.RolloutPercent >= 100 {
+		return true
+	}
+	if subject == "" || flag.RolloutPercent <= 0 {
+		return false
+	}
+	return featureFlagBucket(key, subject) < flag.RolloutPercent
+}
+
+// featureFlagAvailable reports whether a flag is on for anyone at all. Entry
+// points check this before the caller is known and then narrow with
+// featureFlagEnabledFor.
+func featureFlagAvailable(key string) bool {
+	flag, ok := getFeatureFlag(key)
+	return ok && flag.activeInPhase(CurrentPhase()) && flag.RolloutPercent > 0
+}
+
+// currentFeatureFlags summarizes which flags are available for anyone.
+func currentFeatureFlags() FeatureFlags {
+	return FeatureFlags{
+		FaucetsEnabled: featureFlagAvailable(FlagFaucets),
+		SinksEnabled:   featureFlagAvailable(FlagSinks),
+		Telemetry:      featureFlagAvailable(FlagTelemetry),
+		IPThrottling:   featureFlagAvailable(FlagIPThrottling),
+	}
+}
+
+func listFeatureFlags() []FeatureFlag {
+	featureFlagsMu.RLock()
+	flags := make([]FeatureFlag, 0, len(featureFlagRegistry))
+	for _, flag := range featureFlagRegistry {
+		flags = append(flags, flag)
+	}
+	featureFlagsMu.RUnlock()
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Key < flags[j].Key })
+	return flags
+}
+
+func featureFlagStatus(flag FeatureFlag) string {
+	if !flag.Enabled || flag.RolloutPercent <= 0 {
+		return "disabled"
+	}
+	if !flag.activeInPhase(CurrentPhase()) {
+		return "disabled-in-phase"
+	}
+	if flag.RolloutPercent < 100 {
+		return "rollout-" + strconv.Itoa(flag.RolloutPercent) + "%"
+	}
+	return "enabled"
+}
+
+func seedFeatureFlags(db *sql.DB) error {
+	for _, seed := range featureFlagSeeds {
+		if _, err := db.Exec(`
+			INSERT INTO feature_flags (key, enabled, phases, rollout_percent, description, updated_at)
+			VALUES ($1, $2, '', 100, $3, NOW())
+			ON CONFLICT (key) DO NOTHING
+		`, seed.Key, envFlag(seed.EnvName, true), seed.Description); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadFeatureFlags(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT key, enabled, phases, rollout_percent, COALESCE(description, ''), COALESCE(updated_by, ''), updated_at
+		FROM feature_flags
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	registry := defaultFeatureFlagRegistry()
+	for rows.Next() {
+		var flag FeatureFlag
+		var phases string
+		var updatedAt time.Time
+		if err := rows.Scan(&flag.Key, &flag.Enabled, &phases, &flag.RolloutPercent, &flag.Description, &flag.UpdatedBy, &updatedAt); err != nil {
+			continue
+		}
+		flag.Phases = splitFeatureFlagPhases(phases)
+		updated := updatedAt.UTC()
+		flag.UpdatedAt = &updated
+		registry[flag.Key] = flag
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	featureFlagsMu.Lock()
+	featureFlagRegistry = registry
+	featureFlagsMu.Unlock()
+	return nil
+}
+
+func startFeatureFlagRefresher(db *sql.DB) {
+	if err := seedFeatureFlags(db); err != nil {
+		log.Println("feature flag seed failed:", err)
+	}
+	if err := loadFeatureFlags(db); err != nil {
+		log.Println("feature flag load failed:", err)
+	}
+	go func() {
+		ticker := time.NewTicker(featureFlagRefreshInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := loadFeatureFlags(db); err != nil {
+				log.Println("feature flag refresh failed:", err)
+			}
+		}
+	}()
+}
+
+func splitFeatureFlagPhases(raw string) []string {
+	phases := []string{}
+	for _, part := range strings.Split(raw, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			phases = append(phases, part)
+		}
+	}
+	return phases
+}
+
+type AdminFeatureFlagRequest struct {
+	Key            string    `json:"key"`
+	Enabled        *bool     `json:"enabled,omitempty"`
+	Phases         *[]string `json:"phases,omitempty"`
+	RolloutPercent *int      `json:"rolloutPercent,omitempty"`
+	Reason         string    `json:"reason"`
+}
+
+type AdminFeatureFlagsResponse struct {
+	OK    bool          `json:"ok"`
+	Error string        `json:"error,omitempty"`
+	Flags []FeatureFlag `json:"flags,omitempty"`
+	Flag  *FeatureFlag  `json:"flag,omitempty"`
+}
+
+func adminFeatureFlagsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		permission := PermViewSettings
+		if r.Method != http.MethodGet {
+			permission = PermManageFeatureFlags
+		}
+		admin, ok := requirePermission(db, w, r, permission)
+		if !ok {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(AdminFeatureFlagsResponse{OK: true, Flags: listFeatureFlags()})
+			return
+		case http.MethodPost, http.MethodPatch:
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req AdminFeatureFlagRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			json.NewEncoder(w).Encode(AdminFeatureFlagsResponse{OK: false, Error: "INVALID_REQUEST"})
+			return
+		}
+		reason := strings.TrimSpace(req.Reason)
+		if reason == "" {
+			json.NewEncoder(w).Encode(AdminFeatureFlagsResponse{OK: false, Error: "REASON_REQUIRED"})
+			return
+		}
+		before, ok := getFeatureFlag(strings.TrimSpace(req.Key))
+		if !ok {
+			json.NewEncoder(w).Encode(AdminFeatureFlagsResponse{OK: false, Error: "UNKNOWN_FLAG"})
+			return
+		}
+		after := before
+		if req.Enabled != nil {
+			after.Enabled = *req.Enabled
+		}
+		if req.RolloutPercent != nil {
+			if *req.RolloutPercent < 0 || *req.RolloutPercent > 100 {
+				json.NewEncoder(w).Encode(AdminFeatureFlagsResponse{OK: false, Error: "INVALID_ROLLOUT_PERCENT"})
+				return
+			}
+			after.RolloutPercent = *req.RolloutPercent
+		}
+		if req.Phases != nil {
+			phases := []string{}
+			for _, raw := range *req.Phases {
+				phase, ok := parsePhaseValue(raw)
+				if !ok {
+					json.NewEncoder(w).Encode(AdminFeatureFlagsResponse{OK: false, Error: "INVALID_PHASE"})
+					return
+				}
+				phases = append(phases, string(phase))
+			}
+			after.Phases = phases
+		}
+
+		if _, err := db.Exec(`
+			INSERT INTO feature_flags (key, enabled, phases, rollout_percent, description, updated_by, updated_at)
+			VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, NOW())
+			ON CONFLICT (key) DO UPDATE SET
+				enabled = EXCLUDED.enabled,
+				phases = EXCLUDED.phases,
+				rollout_percent = EXCLUDED.rollout_percent,
+				updated_by = EXCLUDED.updated_by,
+				updated_at = EXCLUDED.updated_at
+		`, after.Key, after.Enabled, strings.Join(after.Phases, ","), after.RolloutPercent, after.Description, admin.AccountID); err != nil {
+			json.NewEncoder(w).Encode(AdminFeatureFlagsResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if err := loadFeatureFlags(db); err != nil {
+			log.Println("feature flag reload failed:", err)
+		}
+
+		_ = logAdminAction(db, admin.AccountID, "feature_flag_update", "feature_flag", after.Key, reason, map[string]interface{}{
+			"before": map[string]interface{}{
+				"enabled":        before.Enabled,
+				"phases":         before.Phases,
+				"rolloutPercent": before.RolloutPercent,
+			},
+			"after": map[string]interface{}{
+				"enabled":        after.Enabled,
+				"phases":         after.Phases,
+				"rolloutPercent": after.RolloutPercent,
+			},
+		})
+
+		flag, _ := getFeatureFlag(after.Key)
+		json.NewEncoder(w).Encode(AdminFeatureFlagsResponse{OK: true, Flag: &flag})
+	}
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Friendships are directed requests that become mutual once accepted. A
+// declined request stays on record so it cannot be re-sent in a loop; the
+// requester may ask again only after the addressee removes it.
+const (
+	FriendStatusPending  = "pending"
+	FriendStatusAccepted = "accepted"
+	FriendStatusDeclined = "declined"
+
+	maxFriends                  = 200
+	friendPurchaseAlertCooldown = 10 * time.Minute
+)
+
+// friendPlayerIDsSQL selects the player IDs of accepted friends of the
+// account bound to accountParam.
+func friendPlayerIDsSQL(accountParam string) string {
+	return `
+		SELECT a.player_id
+		FROM friendships f
+		JOIN accounts a ON a.account_id = CASE
+			WHEN f.requester_account_id = ` + accountParam + ` THEN f.addressee_account_id
+			ELSE f.requester_account_id
+		END
+		WHERE f.status = '` + FriendStatusAccepted + `'
+			AND (f.requester_account_id = ` + accountParam + ` OR f.addressee_account_id = ` + accountParam + `)
+	`
+}
+
+func friendsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		account, ok := requireSession(db, w, r)
+		if !ok {
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT
+				f.requester_account_id = $1 AS outgoing,
+				f.status,
+				COALESCE(f.responded_at, f.created_at),
+				a.account_id,
+				a.player_id,
+				a.username,
+				COALESCE(a.display_name, a.username),
+				COALESCE(p.stars, 0)
+			FROM friendships f
+			JOIN accounts a ON a.account_id = CASE
+				WHEN f.requester_account_id = $1 THEN f.addressee_account_id
+				ELSE f.requester_account_id
+			END
+			LEFT JOIN players p ON p.player_id = a.player_id
+			WHERE (f.requester_account_id = $1 OR f.addressee_account_id = $1)
+				AND f.status IN ($2, $3)
+			ORDER BY COALESCE(f.responded_at, f.created_at) DESC
+		`, account.AccountID, FriendStatusAccepted, FriendStatusPending)
+		if err != nil {
+			json.NewEncoder(w).Encode(FriendsResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		defer rows.Close()
+
+		response := FriendsResponse{
+			OK:       true,
+			Friends:  []FriendEntry{},
+			Incoming: []FriendEntry{},
+			Outgoing: []FriendEntry{},
+		}
+		for rows.Next() {
+			var outgoing bool
+			var status string
+			var since time.Time
+			var entry FriendEntry
+			if err := rows.Scan(&outgoing, &status, &since, &entry.AccountID, &entry.PlayerID, &entry.Username, &entry.DisplayName, &entry.Stars); err != nil {
+				continue
+			}
+			entry.Since = since.UTC().Format(time.RFC3339)
+			switch {
+			case status == FriendStatusAccepted:
+				response.Friends = append(response.Friends, entry)
+			case outgoing:
+				response.Outgoing = append(response.Outgoing, entry)
+			default:
+				response.Incoming = append(response.Incoming, entry)
+			}
+		}
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// friendRequestHandler sends a friend request by username or account ID. A
+// request to someone who already asked you accepts theirs instead.
+func friendRequestHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		account, ok := requireSession(db, w, r)
+		if !ok {
+			return
+		}
+		var req FriendRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			json.NewEncoder(w).Encode(FriendsResponse{OK: false, Error: "INVALID_REQUEST"})
+			return
+		}
+
+		targetID, err := resolveFriendTarget(db, req)
+		if err == sql.ErrNoRows {
+			json.NewEncoder(w).Encode(FriendsResponse{OK: false, Error: "ACCOUNT_NOT_FOUND"})
+			return
+		}
+		if err != nil {
+			json.NewEncoder(w).Encode(FriendsResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if targetID == account.AccountID {
+			json.NewEncoder(w).Encode(FriendsResponse{OK: false, Error: "CANNOT_FRIEND_SELF"})
+			return
+		}
+
+		now := time.Now().UTC()
+		var reverseStatus string
+		err = db.QueryRow(`
+			SELECT status FROM friendships
+			WHERE requester_account_id = $1 AND addressee_account_id = $2
+		`, targetID, account.AccountID).Scan(&reverseStatus)
+		if err != nil && err != sql.ErrNoRows {
+			json.NewEncoder(w).Encode(FriendsResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if err == nil {
+			switch reverseStatus {
+			case FriendStatusAccepted:
+				json.NewEncoder(w).Encode(FriendsResponse{OK: false, Error: "ALREADY_FRIENDS"})
+				return
+			case FriendStatusPending:
+				if err := acceptFriendRequest(db, targetID, account, now); err != nil {
+					json.NewEncoder(w).Encode(FriendsResponse{OK: false, Error: friendErrorCode(err)})
+					return
+				}
+				json.NewEncoder(w).Encode(FriendsResponse{OK: true, Status: FriendStatusAccepted})
+				return
+			}
+		}
+
+		count, err := countFriends(db, account.AccountID)
+		if err != nil {
+			json.NewEncoder(w).Encode(FriendsResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if count >= maxFriends {
+			json.NewEncoder(w).Encode(FriendsResponse{OK: false, Error: "FRIEND_LIMIT_REACHED"})
+			return
+		}
+
+		result, err := db.Exec(`
+			INSERT INTO friendships (requester_account_id, addressee_account_id, status, created_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (requester_account_id, addressee_account_id) DO NOTHING
+		`, account.AccountID, targetID, FriendStatusPending, now)
+		if err != nil {
+			json.NewEncoder(w).Encode(FriendsResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			json.NewEncoder(w).Encode(FriendsResponse{OK: false, Error: "REQUEST_EXISTS"})
+			return
+		}
+
+		emitNotification(db, NotificationInput{
+			RecipientRole:      NotificationRolePlayer,
+			RecipientAccountID: targetID,
+			Category:           NotificationCategoryPlayerAction,
+			Type:               "friend_request",
+			Priority:           NotificationPriorityNormal,
+			Message:            account.DisplayName + " sent you a friend request.",
+			Link:               "#/friends",
+			Payload: map[string]interface{}{
+				"accountId": account.AccountID,
+				"username":  account.Username,
+			},
+			DedupKey:    "friend_request:" + account.AccountID + ":" + targetID,
+			DedupWindow: time.Hour,
+		})
+		json.NewEncoder(w).Encode(FriendsResponse{OK: true, Status: FriendStatusPending})
+	}
+}
+
+func friendRespondHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		account, ok := requireSession(db, w, r)
+		if !ok {
+			return
+		}
+		var req FriendRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.AccountID) == "" {
+			json.NewEncoder(w).Encode(FriendsResponse{OK: false, Error: "INVALID_REQUEST"})
+			return
+		}
+		requesterID := strings.TrimSpace(req.AccountID)
+		now := time.Now().UTC()
+
+		if req.Accept {
+			if err := acceptFriendRequest(db, requesterID, account, now); err != nil {
+				json.NewEncoder(w).Encode(FriendsResponse{OK: false, Error: friendErrorCode(err)})
+				return
+			}
+			json.NewEncoder(w).Encode(FriendsResponse{OK: true, Status: FriendStatusAccepted})
+			return
+		}
+
+		result, err := db.Exec(`
+			UPDATE friendships
+			SET status = $3, responded_at = $4
+			WHERE requester_account_id = $1 AND addressee_account_id = $2 AND status = $5
+		`, requesterID, account.AccountID, FriendStatusDeclined, now, FriendStatusPending)
+		if err != nil {
+			json.NewEncoder(w).Encode(FriendsResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			json.NewEncoder(w).Encode(FriendsResponse{OK: false, Error: "REQUEST_NOT_FOUND"})
+			return
+		}
+		json.NewEncoder(w).Encode(FriendsResponse{OK: true, Status: FriendStatusDeclined})
+	}
+}
+
+// friendRemoveHandler removes a friendship, cancels an outgoing request or
+// clears a declined incoming one.
+func friendRemoveHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		account, ok := requireSession(db, w, r)
+		if !ok {
+			return
+		}
+		var req FriendRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.AccountID) == "" {
+			json.NewEncoder(w).Encode(FriendsResponse{OK: false, Error: "INVALID_REQUEST"})
+			return
+		}
+		otherID := strings.TrimSpace(req.AccountID)
+
+		// A declined request is only removable by the person who declined it,
+		// otherwise the requester could clear it and ask again.
+		result, err := db.Exec(`
+			DELETE FROM friendships
+			WHERE (
+				(requester_account_id = $1 AND addressee_account_id = $2 AND status <> $3)
+				OR (requester_account_id = $2 AND addressee_account_id = $1)
+			)
+		`, account.AccountID, otherID, FriendStatusDeclined)
+		if err != nil {
+			json.NewEncoder(w).Encode(FriendsResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			json.NewEncoder(w).Encode(FriendsResponse{OK: false, Error: "NOT_FOUND"})
+			return
+		}
+		json.NewEncoder(w).Encode(FriendsResponse{OK: true})
+	}
+}
+
+type friendError string
+
+func (e friendError) Error() string { return string(e) }
+
+func friendErrorCode(err error) string {
+	if code, ok := err.(friendError); ok {
+		return string(code)
+	}
+	return "INTERNAL_ERROR"
+}
+
+func resolveFriendTarget(db *sql.DB, req FriendRequest) (string, error) {
+	var accountID string
+	if id := strings.TrimSpace(req.AccountID); id != "" {
+		err := db.QueryRow(`SELECT account_id FROM accounts WHERE account_id = $1`, id).Scan(&accountID)
+		return accountID, err
+	}
+	username := strings.TrimSpace(strings.ToLower(req.Username))
+	if username == "" {
+		return "", sql.ErrNoRows
+	}
+	err := db.QueryRow(`SELECT account_id FROM accounts WHERE username = $1`, username).Scan(&accountID)
+	return accountID, err
+}
+
+// countFriends counts accepted friendships plus requests the account has
+// sent. Incoming requests are left out so other players cannot fill the
+// account's cap by spamming requests at it.
+func countFriends(db *sql.DB, accountID string) (int, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM friendships
+		WHERE (
+			((requester_account_id = $1 OR addressee_account_id = $1) AND status = $2)
+			OR (requester_account_id = $1 AND status = $3)
+		)
+	`, accountID, FriendStatusAccepted, FriendStatusPending).Scan(&count)
+	return count, err
+}
+
+func acceptFriendRequest(db *sql.DB, requesterID string, account *Account, now time.Time) error {
+	count, err := countFriends(db, account.AccountID)
+	if err != nil {
+		return err
+	}
+	if count >= maxFriends {
+		return friendError("FRIEND_LIMIT_REACHED")
+	}
+	result, err := db.Exec(`
+		UPDATE friendships
+		SET status = $3, responded_at = $4
+		WHERE requester_account_id = $1 AND addressee_account_id = $2 AND status = $5
+	`, requesterID, account.AccountID, FriendStatusAccepted, now, FriendStatusPending)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return friendError("REQUEST_NOT_FOUND")
+	}
+	emitNotification(db, NotificationInput{
+		RecipientRole:      NotificationRolePlayer,
+		RecipientAccountID: requesterID,
+		Category:           NotificationCategoryPlayerAction,
+		Type:               "friend_accepted",
+		Priority:           NotificationPriorityNormal,
+		Message:            account.DisplayName + " accepted your friend request.",
+		Link:               "#/friends",
+		Payload: map[string]interface{}{
+			"accountId": account.AccountID,
+			"username":  account.Username,
+		},
+	})
+	return nil
+}
+
+// notifyFriendsOfPurchase tells opted-in friends that a friend bought stars.
+func notifyFriendsOfPurchase(db *sql.DB, buyer *Account, quantity int, starsAfter int64) {
+	go func() {
+		rows, err := db.Query(`
+			SELECT a.account_id
+			FROM accounts a
+			JOIN notification_settings s
+				ON s.account_id = a.account_id AND s.category = $2
+			WHERE s.enabled = true
+				AND a.player_id IN (`+friendPlayerIDsSQL("$1")+`)
+		`, buyer.AccountID, NotificationCategoryFriends)
+		if err != nil {
+			log.Println("friend purchase alerts: lookup failed:", err)
+			return
+		}
+		defer rows.Close()
+		message := buyer.DisplayName + " bought a star."
+		if quantity > 1 {
+			message = buyer.DisplayName + " bought " + strconv.Itoa(quantity) + " stars."
+		}
+		for rows.Next() {
+			var friendID string
+			if err := rows.Scan(&friendID); err != nil {
+				continue
+			}
+			emitNotification(db, NotificationInput{
+				RecipientRole:      NotificationRolePlayer,
+				RecipientAccountID: friendID,
+				SeasonID:           currentSeasonID(),
+				Category:           NotificationCategoryFriends,
+				Type:               "friend_star_purchase",
+				Priority:           NotificationPriorityNormal,
+				Message:            message,
+				Link:               "#/leaderboard",
+				Payload: map[string]interface{}{
+					"accountId": buyer.AccountID,
+					"quantity":  quantity,
+					"stars":     starsAfter,
+				},
+				DedupKey:    "friend_purchase:" + friendID + ":" + buyer.AccountID,
+				DedupWindow: friendPurchaseAlertCooldown,
+			})
+		}
+	}()
+}
+
+// notifyFriendsPassed alerts opted-in players whose friend moved ahead of them
+// in this refresh. Ranks are compared within the same change set, so only
+// passes caused by the friend's own climb are reported.
+func notifyFriendsPassed(db *sql.DB, seasonID string, changes []LeaderboardRankChange) {
+	byPlayer := map[string]LeaderboardRankChange{}
+	climbers := []string{}
+	for _, change := range changes {
+		byPlayer[change.PlayerID] = change
+		if change.PreviousRank == 0 || change.Rank < change.PreviousRank {
+			climbers = append(climbers, change.PlayerID)
+		}
+	}
+	if len(climbers) == 0 {
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT climber.player_id, climber.display_name, passed.account_id, passed.player_id
+		FROM accounts climber
+		JOIN friendships f
+			ON f.status = $3
+			AND (f.requester_account_id = climber.account_id OR f.addressee_account_id = climber.account_id)
+		JOIN accounts passed ON passed.account_id = CASE
+			WHEN f.requester_account_id = climber.account_id THEN f.addressee_account_id
+			ELSE f.requester_account_id
+		END
+		JOIN notification_settings s
+			ON s.account_id = passed.account_id AND s.category = $2
+		WHERE s.enabled = true
+			AND climber.player_id = ANY($1)
+	`, pq.Array(climbers), NotificationCategoryFriends, FriendStatusAccepted)
+	if err != nil {
+		log.Println("friend rank alerts: lookup failed:", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var climberPlayerID, climberName, passedAccountID, passedPlayerID string
+		if err := rows.Scan(&climberPlayerID, &climberName, &passedAccountID, &passedPlayerID); err != nil {
+			continue
+		}
+		climber := byPlayer[climberPlayerID]
+		passed, ok := byPlayer[passedPlayerID]
+		if !ok || passed.PreviousRank == 0 || passed.Rank <= climber.Rank {
+			continue
+		}
+		if climber.PreviousRank != 0 && climber.PreviousRank < passed.PreviousRank {
+			continue
+		}
+		emitNotification(db, NotificationInput{
+			RecipientRole:      NotificationRolePlayer,
+			RecipientAccountID: passedAccountID,
+			SeasonID:           seasonID,
+			Category:           NotificationCategoryFriends,
+			Type:               "friend_passed_you",
+			Priority:           NotificationPriorityNormal,
+			Message:            climberName + " passed you on the leaderboard. You are now rank #" + strconv.Itoa(passed.Rank) + ".",
+			Link:               "#/leaderboard",
+			Payload: map[string]interface{}{
+				"seasonId":       seasonID,
+				"friendPlayerId": climberPlayerID,
+				"friendRank":     climber.Rank,
+				"rank":           passed.Rank,
+			},
+			DedupKey:    "friend_passed:" + passedAccountID + ":" + climberPlayerID,
+			DedupWindow: rankPassedAlertCooldown,
+		})
+	}
+}
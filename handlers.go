@@ -96,12 +96,15 @@ func requireSession(db *sql.DB, w http.ResponseWriter, r *http.Request) (*Accoun
 		w.WriteHeader(http.StatusUnauthorized)
 		return nil, false
 	}
+	if rejectAPIToken(w, account) {
+		return nil, false
+	}
 	return account, true
 }
 
 func playerHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		account, ok := requireSession(db, w, r)
+		account, ok := requireScopedSession(db, w, r, ScopeReadPlayer)
 		if !ok {
 			return
 		}
@@ -211,7 +214,7 @@ func seasonsHandler(db *sql.DB) http.HandlerFunc {
 			next := nextEmissionSeconds(now)
 			nextEmission = &next
 			price := ComputeStarPrice(coins, remaining)
-			if account, _, err := getSessionAccount(db, r); err == nil && account != nil {
+			if account := optionalScopedSession(db, r, ScopeReadPlayer); account != nil {
 				price = computePlayerStarPrice(db, account.PlayerID, coins, remaining)
 			}
 			currentPrice = &price
@@ -275,12 +278,32 @@ func seasonsHandler(db *sql.DB) http.HandlerFunc {
 
 func computePlayerStarPrice(db *sql.DB, playerID string, coinsInCirculation int64, secondsRemaining int64) int {
 	basePrice := ComputeStarPrice(coinsInCirculation, secondsRemaining)
-	dampenedPrice, err := ComputeDampenedStarPrice(db, playerID, basePrice)
+	return loadPlayerPriceAdjustment(db, playerID).Apply(basePrice)
+}
+
+// playerPriceAdjustment holds the per-player multipliers layered on top of the
+// global star price, so live streams can personalize pushed prices without a
+// query per update.
+type playerPriceAdjustment struct {
+	Dampening   float64
+	Enforcement float64
+}
+
+func loadPlayerPriceAdjustment(db *sql.DB, playerID string) playerPriceAdjustment {
+	dampening, err := playerDampeningPriceMultiplier(db, playerID)
 	if err != nil {
-		return basePrice
+		return playerPriceAdjustment{Dampening: 1, Enforcement: 1}
 	}
 	enforcement := abuseEffectiveEnforcement(db, playerID, bulkStarMaxQty())
-	return int(float64(dampenedPrice)*enforcement.PriceMultiplier + 0.9999)
+	return playerPriceAdjustment{Dampening: dampening, Enforcement: enforcement.PriceMultiplier}
+}
+
+func (a playerPriceAdjustment) Apply(basePrice int) int {
+	price := basePrice
+	if a.Dampening != 1 {
+		price = int(float64(price)*a.Dampening + 0.9999)
+	}
+	return int(float64(price)*a.Enforcement + 0.9999)
 }
 
 func buyStarHandler(db *sql.DB) http.HandlerFunc {
@@ -294,15 +317,23 @@ func buyStarHandler(db *sql.DB) http.HandlerFunc {
 			json.NewEncoder(w).Encode(BuyStarResponse{OK: false, Error: "SEASON_ENDED"})
 			return
 		}
-		if !featureFlags.SinksEnabled {
+		if code := economySinkBlock(true); code != "" {
+			json.NewEncoder(w).Encode(BuyStarResponse{OK: false, Error: code})
+			return
+		}
+		if !currentFeatureFlags().SinksEnabled {
 			json.NewEncoder(w).Encode(BuyStarResponse{OK: false, Error: "FEATURE_DISABLED"})
 			return
 		}
 
-		account, ok := requireSession(db, w, r)
+		account, ok := requireScopedSession(db, w, r, ScopeTradeStars)
 		if !ok {
 			return
 		}
+		if !featureFlagEnabledFor(FlagSinks, account.PlayerID) {
+			json.NewEncoder(w).Encode(BuyStarResponse{OK: false, Error: "FEATURE_DISABLED"})
+			return
+		}
 		if remainingCooldown, err := accountCooldownRemaining(db, account.AccountID, time.Now().UTC()); err != nil {
 			json.NewEncoder(w).Encode(FaucetClaimResponse{OK: false, Error: "INTERNAL_ERROR"})
 			return
@@ -498,6 +529,9 @@ func buyStarHandler(db *sql.DB) http.HandlerFunc {
 		for i := 0; i < quantity; i++ {
 			economy.IncrementStars()
 		}
+		publishPlayerBalance(playerID, coinsAfter, starsAfter)
+		requestLeaderboardRefresh()
+		publishEconomyUpdate()
 		lastPrice := 0
 		if len(quote.Breakdown) > 0 {
 			lastPrice = quote.Breakdown[len(quote.Breakdown)-1].FinalPrice
@@ -524,6 +558,7 @@ func buyStarHandler(db *sql.DB) http.HandlerFunc {
 					"playerStars":     starsAfter,
 				},
 			})
+			notifyFriendsOfPurchase(db, account, quantity, starsAfter)
 			if quantity >= 3 {
 				priority := NotificationPriorityNormal
 				if quantity >= maxQty {
@@ -573,14 +608,18 @@ func buyStarQuoteHandler(db *sql.DB) http.HandlerFunc {
 			json.NewEncoder(w).Encode(BuyStarQuoteResponse{OK: false, Error: "SEASON_ENDED"})
 			return
 		}
-		if !featureFlags.SinksEnabled {
+		if !currentFeatureFlags().SinksEnabled {
 			json.NewEncoder(w).Encode(BuyStarQuoteResponse{OK: false, Error: "FEATURE_DISABLED"})
 			return
 		}
-		account, ok := requireSession(db, w, r)
+		account, ok := requireScopedSession(db, w, r, ScopeTradeStars)
 		if !ok {
 			return
 		}
+		if !featureFlagEnabledFor(FlagSinks, account.PlayerID) {
+			json.NewEncoder(w).Encode(BuyStarQuoteResponse{OK: false, Error: "FEATURE_DISABLED"})
+			return
+		}
 		if remaining, err := accountCooldownRemaining(db, account.AccountID, time.Now().UTC()); err != nil {
 			json.NewEncoder(w).Encode(BuyVariantStarResponse{OK: false, Error: "INTERNAL_ERROR"})
 			return
@@ -747,15 +786,23 @@ func buyVariantStarHandler(db *sql.DB) http.HandlerFunc {
 			json.NewEncoder(w).Encode(BuyVariantStarResponse{OK: false, Error: "SEASON_ENDED"})
 			return
 		}
-		if !featureFlags.SinksEnabled {
+		if code := economySinkBlock(true); code != "" {
+			json.NewEncoder(w).Encode(BuyVariantStarResponse{OK: false, Error: code})
+			return
+		}
+		if !currentFeatureFlags().SinksEnabled {
 			json.NewEncoder(w).Encode(BuyVariantStarResponse{OK: false, Error: "FEATURE_DISABLED"})
 			return
 		}
 
-		account, ok := requireSession(db, w, r)
+		account, ok := requireScopedSession(db, w, r, ScopeTradeStars)
 		if !ok {
 			return
 		}
+		if !featureFlagEnabledFor(FlagSinks, account.PlayerID) {
+			json.NewEncoder(w).Encode(BuyVariantStarResponse{OK: false, Error: "FEATURE_DISABLED"})
+			return
+		}
 		if remaining, err := accountCooldownRemaining(db, account.AccountID, time.Now().UTC()); err != nil {
 			json.NewEncoder(w).Encode(BuyBoostResponse{OK: false, Error: "INTERNAL_ERROR"})
 			return
@@ -883,7 +930,11 @@ func buyBoostHandler(db *sql.DB) http.HandlerFunc {
 			json.NewEncoder(w).Encode(BuyBoostResponse{OK: false, Error: "SEASON_ENDED"})
 			return
 		}
-		if !featureFlags.SinksEnabled {
+		if code := economySinkBlock(false); code != "" {
+			json.NewEncoder(w).Encode(BuyBoostResponse{OK: false, Error: code})
+			return
+		}
+		if !currentFeatureFlags().SinksEnabled {
 			json.NewEncoder(w).Encode(BuyBoostResponse{OK: false, Error: "FEATURE_DISABLED"})
 			return
 		}
@@ -892,6 +943,10 @@ func buyBoostHandler(db *sql.DB) http.HandlerFunc {
 		if !ok {
 			return
 		}
+		if !featureFlagEnabledFor(FlagSinks, account.PlayerID) {
+			json.NewEncoder(w).Encode(BuyBoostResponse{OK: false, Error: "FEATURE_DISABLED"})
+			return
+		}
 		if remaining, err := accountCooldownRemaining(db, account.AccountID, time.Now().UTC()); err != nil {
 			json.NewEncoder(w).Encode(BurnCoinsResponse{OK: false, Error: "INTERNAL_ERROR"})
 			return
@@ -979,7 +1034,11 @@ func burnCoinsHandler(db *sql.DB) http.HandlerFunc {
 			json.NewEncoder(w).Encode(BurnCoinsResponse{OK: false, Error: "SEASON_ENDED"})
 			return
 		}
-		if !featureFlags.SinksEnabled {
+		if code := economySinkBlock(false); code != "" {
+			json.NewEncoder(w).Encode(BurnCoinsResponse{OK: false, Error: code})
+			return
+		}
+		if !currentFeatureFlags().SinksEnabled {
 			json.NewEncoder(w).Encode(BurnCoinsResponse{OK: false, Error: "FEATURE_DISABLED"})
 			return
 		}
@@ -988,6 +1047,10 @@ func burnCoinsHandler(db *sql.DB) http.HandlerFunc {
 		if !ok {
 			return
 		}
+		if !featureFlagEnabledFor(FlagSinks, account.PlayerID) {
+			json.NewEncoder(w).Encode(BurnCoinsResponse{OK: false, Error: "FEATURE_DISABLED"})
+			return
+		}
 
 		var req BurnCoinsRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1024,16 +1087,18 @@ func burnCoinsHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		var coins int
+		var stars int64
 		var burned int
 		err = db.QueryRow(`
-			SELECT coins, burned_coins
+			SELECT coins, stars, burned_coins
 			FROM players
 			WHERE player_id = $1
-		`, playerID).Scan(&coins, &burned)
+		`, playerID).Scan(&coins, &stars, &burned)
 		if err != nil {
 			json.NewEncoder(w).Encode(BurnCoinsResponse{OK: false, Error: "INTERNAL_ERROR"})
 			return
 		}
+		publishPlayerBalance(playerID, int64(coins), stars)
 
 		json.NewEncoder(w).Encode(BurnCoinsResponse{
 			OK:          true,
@@ -1068,27 +1133,22 @@ func requestPasswordResetHandler(db *sql.DB) http.HandlerFunc {
 			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "EMAIL_NOT_SET"})
 			return
 		}
+		if !account.EmailVerified {
+			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "EMAIL_NOT_VERIFIED"})
+			return
+		}
+		if !mailTransportConfigured() {
+			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "EMAIL_NOT_CONFIGURED"})
+			return
+		}
 		token, err := createPasswordResetToken(db, account.AccountID)
 		if err != nil {
 			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "INTERNAL_ERROR"})
 			return
 		}
-		baseURL := os.Getenv("APP_BASE_URL")
-		if baseURL == "" {
-			scheme := "https"
-			if r.Header.Get("X-Forwarded-Proto") != "" {
-				scheme = r.Header.Get("X-Forwarded-Proto")
-			} else if r.TLS == nil {
-				scheme = "http"
-			}
-			baseURL = scheme + "://" + r.Host
-		}
-		if err := sendPasswordResetEmail(account.Email, token, baseURL); err != nil {
-			if err.Error() == "EMAIL_NOT_CONFIGURED" {
-				json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "EMAIL_NOT_CONFIGURED"})
-				return
-			}
-			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "EMAIL_SEND_FAILED"})
+		if err := sendPasswordResetEmail(db, account.Email, token, appBaseURL(r)); err != nil {
+			log.Println("request reset: enqueue failed:", err)
+			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "INTERNAL_ERROR"})
 			return
 		}
 		json.NewEncoder(w).Encode(SimpleResponse{OK: true})
@@ -1108,8 +1168,12 @@ func resetPasswordHandler(db *sql.DB) http.HandlerFunc {
 		}
 		err := resetPasswordWithToken(db, req.Token, req.NewPassword)
 		if err != nil {
+			if isPasswordPolicyError(err.Error()) {
+				json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: err.Error()})
+				return
+			}
 			switch err.Error() {
-			case "INVALID_PASSWORD", "INVALID_TOKEN", "TOKEN_USED", "TOKEN_EXPIRED":
+			case "INVALID_TOKEN", "TOKEN_USED", "TOKEN_EXPIRED":
 				json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: err.Error()})
 				return
 			default:
@@ -1139,10 +1203,6 @@ func bootstrapPasswordHandler(db *sql.DB) http.HandlerFunc {
 			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "INVALID_REQUEST"})
 			return
 		}
-		if len(newPassword) < 8 || len(newPassword) > 128 {
-			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "INVALID_PASSWORD"})
-			return
-		}
 
 		ctx := r.Context()
 		tx, err := db.BeginTx(ctx, nil)
@@ -1156,12 +1216,13 @@ func bootstrapPasswordHandler(db *sql.DB) http.HandlerFunc {
 		var role string
 		var mustChange bool
 		var passwordHash string
+		var displayName string
 		if err := tx.QueryRowContext(ctx, `
-			SELECT account_id, role, must_change_password, password_hash
+			SELECT account_id, role, must_change_password, password_hash, display_name
 			FROM accounts
 			WHERE username = $1
 			FOR UPDATE
-		`, username).Scan(&accountID, &role, &mustChange, &passwordHash); err != nil {
+		`, username).Scan(&accountID, &role, &mustChange, &passwordHash, &displayName); err != nil {
 			if err == sql.ErrNoRows {
 				w.WriteHeader(http.StatusUnauthorized)
 				return
@@ -1177,6 +1238,10 @@ func bootstrapPasswordHandler(db *sql.DB) http.HandlerFunc {
 			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "PASSWORD_REUSE"})
 			return
 		}
+		if err := checkPasswordPolicy(newPassword, username, displayName); err != nil {
+			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: err.Error()})
+			return
+		}
 
 		var gateID int64
 		if err := tx.QueryRowContext(ctx, `
@@ -1387,7 +1452,7 @@ func notificationsSettingsHandler(db *sql.DB) http.HandlerFunc {
 			}
 			items := []NotificationSettingItem{}
 			for _, category := range NotificationCategories() {
-				enabled := true
+				enabled := notificationCategoryDefaultEnabled(category)
 				pushEnabled := false
 				if value, ok := settings[category]; ok {
 					enabled = value
@@ -1457,12 +1522,38 @@ func notificationsStreamHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		role := notificationRoleForAccount(account)
-		ticker := time.NewTicker(3 * time.Second)
+		sub := liveHub.Subscribe(func(event HubEvent) bool {
+			return event.Type == HubEventNotification && notificationVisibleTo(event, account.AccountID, role)
+		})
+		defer liveHub.Unsubscribe(sub)
+
+		// Notifications are pushed through the hub; the slow resync only covers
+		// events dropped for a lagging stream or missed during a listener reconnect.
+		resync := time.NewTicker(30 * time.Second)
 		heartbeat := time.NewTicker(25 * time.Second)
-		defer ticker.Stop()
+		defer resync.Stop()
 		defer heartbeat.Stop()
 
+		sendPending := func() bool {
+			items, err := fetchNotifications(db, account.AccountID, role, lastID, 25, true)
+			if err != nil {
+				return true
+			}
+			for _, item := range items {
+				if !writeSSEEvent(w, flusher, strconv.FormatInt(item.ID, 10), "notification", item) {
+					return false
+				}
+				if item.ID > lastID {
+					lastID = item.ID
+				}
+			}
+			return true
+		}
+
 		flusher.Flush()
+		if !sendPending() {
+			return
+		}
 		for {
 			select {
 			case <-r.Context().Done():
@@ -1470,35 +1561,17 @@ func notificationsStreamHandler(db *sql.DB) http.HandlerFunc {
 			case <-heartbeat.C:
 				_, _ = w.Write([]byte(": ping\n\n"))
 				flusher.Flush()
-			case <-ticker.C:
-				items, err := fetchNotifications(db, account.AccountID, role, lastID, 25, true)
-				if err != nil {
+			case <-resync.C:
+				if !sendPending() {
+					return
+				}
+			case event := <-sub.Events():
+				sub.TakeLagged()
+				if delta, ok := event.Payload.(NotificationDelta); ok && delta.ID <= lastID {
 					continue
 				}
-				for _, item := range items {
-					payload, err := json.Marshal(item)
-					if err != nil {
-						continue
-					}
-					if _, err := w.Write([]byte("id: " + strconv.FormatInt(item.ID, 10) + "\n")); err != nil {
-						return
-					}
-					if _, err := w.Write([]byte("event: notification\n")); err != nil {
-						return
-					}
-					if _, err := w.Write([]byte("data: ")); err != nil {
-						return
-					}
-					if _, err := w.Write(payload); err != nil {
-						return
-					}
-					if _, err := w.Write([]byte("\n\n")); err != nil {
-						return
-					}
-					flusher.Flush()
-					if item.ID > lastID {
-						lastID = item.ID
-					}
+				if !sendPending() {
+					return
 				}
 			}
 		}
@@ -1553,6 +1626,14 @@ func signupHandler(db *sql.DB) http.HandlerFunc {
 			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "RATE_LIMIT"})
 			return
 		}
+		if code, err := requireProofOfWork(db, PowActionSignup, ip, req.PowChallenge, req.PowSolution); err != nil {
+			log.Println("signup: proof of work error:", err)
+			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		} else if code != "" {
+			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: code})
+			return
+		}
 		log.Printf("signup: whitelist gating removed; relying on throttles (ip=%s)", ip)
 		account, err := createAccount(db, req.Username, req.Password, req.DisplayName, req.Email)
 		if err != nil {
@@ -1582,21 +1663,27 @@ func signupHandler(db *sql.DB) http.HandlerFunc {
 			Message:            "Welcome to the season. Prices rise over time, but small goals still stack. Track the curve and set a first-star target—no outcome is guaranteed.",
 			Link:               "#/home",
 		})
-		sessionID, expiresAt, err := createSession(db, account.AccountID)
+		if account.Email != "" {
+			if err := startEmailVerification(db, account.AccountID, account.Email, EmailVerificationSignup, appBaseURL(r)); err != nil {
+				log.Println("signup: email verification error:", err)
+			}
+		}
+		sessionID, expiresAt, err := createSession(db, account.AccountID, r.UserAgent(), getClientIP(r))
 		if err != nil {
 			log.Println("signup: createSession error:", err)
 			json.NewEncoder(w).Encode(AuthResponse{OK: false, Error: "INTERNAL_ERROR"})
 			return
 		}
+		recordLoginDevice(db, account, r.UserAgent(), getClientIP(r))
 		writeSessionCookie(w, sessionID, expiresAt)
 
-		accessToken, accessExpires, err := issueAccessToken(account.AccountID, accessTokenTTL)
+		accessToken, accessExpires, err := issueAccessToken(account.AccountID, sessionID, accessTokenTTL)
 		if err != nil {
 			log.Println("signup: issueAccessToken error:", err)
 			json.NewEncoder(w).Encode(AuthResponse{OK: false, Error: "INTERNAL_ERROR"})
 			return
 		}
-		refreshToken, _, err := createRefreshToken(db, account.AccountID, "auth", r.UserAgent(), getClientIP(r))
+		refreshToken, _, err := createRefreshToken(db, account.AccountID, sessionID, "auth", r.UserAgent(), getClientIP(r), time.Time{})
 		if err != nil {
 			log.Println("signup: createRefreshToken error:", err)
 			json.NewEncoder(w).Encode(AuthResponse{OK: false, Error: "INTERNAL_ERROR"})
@@ -1644,6 +1731,35 @@ func loginHandler(db *sql.DB) http.HandlerFunc {
 			json.NewEncoder(w).Encode(AuthResponse{OK: false, Error: "RATE_LIMIT"})
 			return
 		}
+		if code, err := requireProofOfWork(db, PowActionLogin, ip, req.PowChallenge, req.PowSolution); err != nil {
+			log.Println("login: proof of work error:", err)
+			json.NewEncoder(w).Encode(AuthResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		} else if code != "" {
+			json.NewEncoder(w).Encode(AuthResponse{OK: false, Error: code})
+			return
+		}
+
+		target, err := lookupLoginTarget(db, req.Username)
+		if err != nil {
+			log.Println("login: account lookup error:", err)
+			json.NewEncoder(w).Encode(AuthResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if target != nil {
+			remaining, err := accountLockRemaining(db, target)
+			if err != nil {
+				log.Println("login: lockout check error:", err)
+				json.NewEncoder(w).Encode(AuthResponse{OK: false, Error: "INTERNAL_ERROR"})
+				return
+			}
+			if remaining > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(remaining.Seconds())+1))
+				w.WriteHeader(http.StatusTooManyRequests)
+				json.NewEncoder(w).Encode(AuthResponse{OK: false, Error: "ACCOUNT_LOCKED"})
+				return
+			}
+		}
 
 		account, err := authenticate(db, req.Username, req.Password)
 		if err != nil {
@@ -1651,9 +1767,26 @@ func loginHandler(db *sql.DB) http.HandlerFunc {
 				json.NewEncoder(w).Encode(AuthResponse{OK: false, Error: "ACCOUNT_FROZEN"})
 				return
 			}
+			if target != nil && err.Error() == "INVALID_CREDENTIALS" {
+				if _, err := recordLoginFailure(db, target, ip, r.UserAgent(), "password"); err != nil {
+					log.Println("login: record failure error:", err)
+				}
+			}
 			json.NewEncoder(w).Encode(AuthResponse{OK: false, Error: "INVALID_CREDENTIALS"})
 			return
 		}
+		if account.TwoFactorEnabled {
+			if err := verifySecondFactor(db, account.AccountID, req.TOTPCode, req.RecoveryCode); err != nil {
+				if target != nil && (err.Error() == "INVALID_TOTP_CODE" || err.Error() == "INVALID_RECOVERY_CODE") {
+					if _, err := recordLoginFailure(db, target, ip, r.UserAgent(), "second_factor"); err != nil {
+						log.Println("login: record failure error:", err)
+					}
+				}
+				json.NewEncoder(w).Encode(AuthResponse{OK: false, Error: err.Error()})
+				return
+			}
+		}
+		clearLoginFailures(db, account.AccountID)
 
 		if _, err := LoadOrCreatePlayer(db, account.PlayerID); err != nil {
 			json.NewEncoder(w).Encode(AuthResponse{OK: false, Error: "INTERNAL_ERROR"})
@@ -1662,20 +1795,21 @@ func loginHandler(db *sql.DB) http.HandlerFunc {
 		EnsurePlayableBalanceOnLogin(db, account.PlayerID, &account.AccountID)
 		verifyDailyPlayability(db, account.PlayerID, &account.AccountID)
 
-		sessionID, expiresAt, err := createSession(db, account.AccountID)
+		sessionID, expiresAt, err := createSession(db, account.AccountID, r.UserAgent(), getClientIP(r))
 		if err != nil {
 			json.NewEncoder(w).Encode(AuthResponse{OK: false, Error: "INTERNAL_ERROR"})
 			return
 		}
+		recordLoginDevice(db, account, r.UserAgent(), getClientIP(r))
 
 		writeSessionCookie(w, sessionID, expiresAt)
 
-		accessToken, accessExpires, err := issueAccessToken(account.AccountID, accessTokenTTL)
+		accessToken, accessExpires, err := issueAccessToken(account.AccountID, sessionID, accessTokenTTL)
 		if err != nil {
 			json.NewEncoder(w).Encode(AuthResponse{OK: false, Error: "INTERNAL_ERROR"})
 			return
 		}
-		refreshToken, _, err := createRefreshToken(db, account.AccountID, "auth", r.UserAgent(), getClientIP(r))
+		refreshToken, _, err := createRefreshToken(db, account.AccountID, sessionID, "auth", r.UserAgent(), getClientIP(r), time.Time{})
 		if err != nil {
 			json.NewEncoder(w).Encode(AuthResponse{OK: false, Error: "INTERNAL_ERROR"})
 			return
@@ -1689,6 +1823,7 @@ func loginHandler(db *sql.DB) http.HandlerFunc {
 			IsModerator:        account.Role == "moderator",
 			Role:               account.Role,
 			MustChangePassword: account.MustChangePassword,
+			TwoFactorEnabled:   account.TwoFactorEnabled,
 			AccessToken:        accessToken,
 			RefreshToken:       refreshToken,
 			ExpiresIn:          int64(time.Until(accessExpires).Seconds()),
@@ -1706,6 +1841,7 @@ func logoutHandler(db *sql.DB) http.HandlerFunc {
 		_, sessionID, err := getSessionAccount(db, r)
 		if err == nil && sessionID != "" {
 			clearSession(db, sessionID)
+			revokeSessionRefreshTokens(db, sessionID)
 		}
 		clearSessionCookie(w)
 		w.WriteHeader(http.StatusNoContent)
@@ -1719,8 +1855,14 @@ func meHandler(db *sql.DB) http.HandlerFunc {
 			json.NewEncoder(w).Encode(AuthResponse{OK: false})
 			return
 		}
+		if account.APIToken != nil && !account.APIToken.HasScope(ScopeReadPlayer) {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(AuthResponse{OK: false, Error: "INSUFFICIENT_SCOPE"})
+			return
+		}
 		EnsurePlayableBalanceOnLogin(db, account.PlayerID, &account.AccountID)
 		verifyDailyPlayability(db, account.PlayerID, &account.AccountID)
+		permissions := accountPermissions(db, account)
 		json.NewEncoder(w).Encode(AuthResponse{
 			OK:                 true,
 			Username:           account.Username,
@@ -1729,7 +1871,10 @@ func meHandler(db *sql.DB) http.HandlerFunc {
 			IsAdmin:            account.Role == "admin",
 			IsModerator:        account.Role == "moderator",
 			Role:               account.Role,
+			Permissions:        permissions,
 			MustChangePassword: account.MustChangePassword,
+			TwoFactorEnabled:   account.TwoFactorEnabled,
+			TwoFactorRequired:  twoFactorRequiredFor(account, permissions),
 		})
 	}
 }
@@ -1772,26 +1917,36 @@ func refreshTokenHandler(db *sql.DB) http.HandlerFunc {
 
 func profileHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		account, ok := requireSession(db, w, r)
+		account, ok := requireScopedSession(db, w, r, ScopeReadPlayer)
 		if !ok {
 			return
 		}
 
 		switch r.Method {
 		case http.MethodGet:
+			emailStatus, err := loadEmailStatus(db, account.AccountID)
+			if err != nil {
+				json.NewEncoder(w).Encode(ProfileResponse{OK: false, Error: "INTERNAL_ERROR"})
+				return
+			}
 			json.NewEncoder(w).Encode(ProfileResponse{
-				OK:          true,
-				Username:    account.Username,
-				DisplayName: account.DisplayName,
-				Email:       account.Email,
-				Bio:         account.Bio,
-				Pronouns:    account.Pronouns,
-				Location:    account.Location,
-				Website:     account.Website,
-				AvatarURL:   account.AvatarURL,
+				OK:            true,
+				Username:      account.Username,
+				DisplayName:   account.DisplayName,
+				Email:         emailStatus.Email,
+				EmailVerified: emailStatus.Verified,
+				PendingEmail:  emailStatus.PendingEmail,
+				Bio:           account.Bio,
+				Pronouns:      account.Pronouns,
+				Location:      account.Location,
+				Website:       account.Website,
+				AvatarURL:     account.AvatarURL,
 			})
 			return
 		case http.MethodPost:
+			if rejectAPIToken(w, account) {
+				return
+			}
 			var req ProfileUpdateRequest
 			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 				json.NewEncoder(w).Encode(ProfileResponse{OK: false, Error: "INVALID_REQUEST"})
@@ -1820,24 +1975,42 @@ func profileHandler(db *sql.DB) http.HandlerFunc {
 					return
 				}
 			}
+			if normalizedEmail != "" && normalizedEmail != account.Email {
+				inUse, err := emailInUse(db, account.AccountID, normalizedEmail)
+				if err != nil {
+					json.NewEncoder(w).Encode(ProfileResponse{OK: false, Error: "INTERNAL_ERROR"})
+					return
+				}
+				if inUse {
+					json.NewEncoder(w).Encode(ProfileResponse{OK: false, Error: "EMAIL_IN_USE"})
+					return
+				}
+			}
 
-			emailValue := sql.NullString{String: normalizedEmail, Valid: normalizedEmail != ""}
 			_, err := db.Exec(`
 				UPDATE accounts
 				SET display_name = $2,
-					email = $3,
-					bio = $4,
-					pronouns = $5,
-					location = $6,
-					website = $7,
-					avatar_url = $8
+					bio = $3,
+					pronouns = $4,
+					location = $5,
+					website = $6,
+					avatar_url = $7
 				WHERE account_id = $1
-			`, account.AccountID, displayName, emailValue, bio, pronouns, location, website, avatarURL)
+			`, account.AccountID, displayName, bio, pronouns, location, website, avatarURL)
 			if err != nil {
 				json.NewEncoder(w).Encode(ProfileResponse{OK: false, Error: "INTERNAL_ERROR"})
 				return
 			}
-			account.Email = normalizedEmail
+			emailStatus, err := updateAccountEmail(db, account.AccountID, normalizedEmail, appBaseURL(r))
+			if err != nil {
+				if err.Error() == "EMAIL_IN_USE" {
+					json.NewEncoder(w).Encode(ProfileResponse{OK: false, Error: "EMAIL_IN_USE"})
+					return
+				}
+				json.NewEncoder(w).Encode(ProfileResponse{OK: false, Error: "INTERNAL_ERROR"})
+				return
+			}
+			account.Email = emailStatus.Email
 			account.Bio = bio
 			account.Pronouns = pronouns
 			account.Location = location
@@ -1845,15 +2018,17 @@ func profileHandler(db *sql.DB) http.HandlerFunc {
 			account.AvatarURL = avatarURL
 
 			json.NewEncoder(w).Encode(ProfileResponse{
-				OK:          true,
-				Username:    account.Username,
-				DisplayName: displayName,
-				Email:       account.Email,
-				Bio:         account.Bio,
-				Pronouns:    account.Pronouns,
-				Location:    account.Location,
-				Website:     account.Website,
-				AvatarURL:   account.AvatarURL,
+				OK:            true,
+				Username:      account.Username,
+				DisplayName:   displayName,
+				Email:         account.Email,
+				EmailVerified: emailStatus.Verified,
+				PendingEmail:  emailStatus.PendingEmail,
+				Bio:           account.Bio,
+				Pronouns:      account.Pronouns,
+				Location:      account.Location,
+				Website:       account.Website,
+				AvatarURL:     account.AvatarURL,
 			})
 			return
 		default:
@@ -1878,7 +2053,15 @@ func dailyClaimHandler(db *sql.DB) http.HandlerFunc {
 			json.NewEncoder(w).Encode(FaucetClaimResponse{OK: false, Error: "SEASON_ENDED"})
 			return
 		}
-		if !featureFlags.FaucetsEnabled {
+		if code := economyFaucetBlock(); code != "" {
+			emitServerTelemetryWithCooldown(db, nil, "", "faucet_denied", map[string]interface{}{
+				"faucet": FaucetDaily,
+				"reason": code,
+			}, 5*time.Minute)
+			json.NewEncoder(w).Encode(FaucetClaimResponse{OK: false, Error: code})
+			return
+		}
+		if !currentFeatureFlags().FaucetsEnabled {
 			emitServerTelemetryWithCooldown(db, nil, "", "faucet_denied", map[string]interface{}{
 				"faucet": FaucetDaily,
 				"reason": "FEATURE_DISABLED",
@@ -1891,6 +2074,10 @@ func dailyClaimHandler(db *sql.DB) http.HandlerFunc {
 		if !ok {
 			return
 		}
+		if !featureFlagEnabledFor(FlagFaucets, account.PlayerID) {
+			json.NewEncoder(w).Encode(FaucetClaimResponse{OK: false, Error: "FEATURE_DISABLED"})
+			return
+		}
 		playerID := account.PlayerID
 		if !isValidPlayerID(playerID) {
 			json.NewEncoder(w).Encode(FaucetClaimResponse{OK: false, Error: "INVALID_PLAYER_ID"})
@@ -2024,7 +2211,15 @@ func activityClaimHandler(db *sql.DB) http.HandlerFunc {
 			json.NewEncoder(w).Encode(FaucetClaimResponse{OK: false, Error: "SEASON_ENDED"})
 			return
 		}
-		if !featureFlags.FaucetsEnabled {
+		if code := economyFaucetBlock(); code != "" {
+			emitServerTelemetryWithCooldown(db, nil, "", "faucet_denied", map[string]interface{}{
+				"faucet": FaucetActivity,
+				"reason": code,
+			}, 5*time.Minute)
+			json.NewEncoder(w).Encode(FaucetClaimResponse{OK: false, Error: code})
+			return
+		}
+		if !currentFeatureFlags().FaucetsEnabled {
 			emitServerTelemetryWithCooldown(db, nil, "", "faucet_denied", map[string]interface{}{
 				"faucet": FaucetActivity,
 				"reason": "FEATURE_DISABLED",
@@ -2037,6 +2232,10 @@ func activityClaimHandler(db *sql.DB) http.HandlerFunc {
 		if !ok {
 			return
 		}
+		if !featureFlagEnabledFor(FlagFaucets, account.PlayerID) {
+			json.NewEncoder(w).Encode(FaucetClaimResponse{OK: false, Error: "FEATURE_DISABLED"})
+			return
+		}
 		playerID := account.PlayerID
 		if !isValidPlayerID(playerID) {
 			json.NewEncoder(w).Encode(FaucetClaimResponse{OK: false, Error: "INVALID_PLAYER_ID"})
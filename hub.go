@@ -0,0 +1,325 @@
+package main
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Live stream event types published through the in-process hub.
+const (
+	HubEventEconomy      = "economy"
+	HubEventBalance      = "balance"
+	HubEventNotification = "notification"
+	HubEventSeason       = "season"
+	HubEventLeaderboard  = "leaderboard"
+)
+
+const (
+	hubSubscriberBuffer = 32
+	hubReplayBuffer     = 1024
+)
+
+// HubEvent is a single delta pushed to live stream subscribers. PlayerID and
+// AccountID scope balance and notification events; RecipientRole mirrors the
+// notification audience so subscribers can skip events they cannot see.
+// ID is the opaque event ID sent to clients; seq orders events in this hub.
+type HubEvent struct {
+	ID            string
+	seq           int64
+	Type          string
+	PlayerID      string
+	AccountID     string
+	RecipientRole string
+	Payload       interface{}
+}
+
+type EconomyDelta struct {
+	ServerTime            string  `json:"serverTime"`
+	SecondsRemaining      int64   `json:"secondsRemaining"`
+	CoinsInCirculation    int64   `json:"coinsInCirculation"`
+	CoinEmissionPerMinute float64 `json:"coinEmissionPerMinute"`
+	CurrentStarPrice      int     `json:"currentStarPrice"`
+	NextEmissionInSeconds int64   `json:"nextEmissionInSeconds"`
+	MarketPressure        float64 `json:"marketPressure"`
+}
+
+type BalanceDelta struct {
+	PlayerCoins int64 `json:"playerCoins"`
+	PlayerStars int64 `json:"playerStars"`
+}
+
+type NotificationDelta struct {
+	ID int64 `json:"id"`
+}
+
+type RankChangedDelta struct {
+	SeasonID     string `json:"seasonId"`
+	Rank         int    `json:"rank"`
+	PreviousRank int    `json:"previousRank,omitempty"`
+	Stars        int64  `json:"stars"`
+}
+
+type LeaderboardDelta struct {
+	SeasonID       string `json:"seasonId"`
+	ChangedPlayers int    `json:"changedPlayers"`
+}
+
+type hubSubscriber struct {
+	events chan HubEvent
+	filter func(HubEvent) bool
+	// lagged is set when an event was dropped because the subscriber's buffer
+	// was full; the stream should resync from a full snapshot.
+	lagged int32
+}
+
+func (s *hubSubscriber) Events() <-chan HubEvent {
+	return s.events
+}
+
+func (s *hubSubscriber) TakeLagged() bool {
+	return atomic.SwapInt32(&s.lagged, 0) == 1
+}
+
+// EventHub assigns every published event a monotonic ID and keeps the most
+// recent ones in a ring so reconnecting streams can resume without a gap.
+// IDs are "<epoch>.<seq>" where the epoch is random per process: sequences
+// are local to an instance, so an ID issued by another instance or by this
+// one before a restart never matches and the client resyncs instead of
+// resuming from the wrong position.
+type EventHub struct {
+	mu          sync.RWMutex
+	subscribers map[*hubSubscriber]struct{}
+	epoch       string
+	lastSeq     int64
+	history     []HubEvent
+	historyNext int
+	historyLen  int
+}
+
+var liveHub = NewEventHub()
+
+func NewEventHub() *EventHub {
+	epoch, err := randomToken(6)
+	if err != nil {
+		epoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return &EventHub{
+		subscribers: map[*hubSubscriber]struct{}{},
+		epoch:       epoch,
+		history:     make([]HubEvent, hubReplayBuffer),
+	}
+}
+
+func (h *EventHub) eventID(seq int64) string {
+	return h.epoch + "." + strconv.FormatInt(seq, 10)
+}
+
+// parseEventID returns the sequence number of an ID issued by this hub.
+func (h *EventHub) parseEventID(id string) (int64, bool) {
+	epoch, raw, ok := strings.Cut(strings.TrimSpace(id), ".")
+	if !ok || epoch != h.epoch {
+		return 0, false
+	}
+	seq, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, false
+	}
+	return seq, true
+}
+
+func (h *EventHub) Subscribe(filter func(HubEvent) bool) *hubSubscriber {
+	sub, _, _ := h.SubscribeFrom("", filter)
+	return sub
+}
+
+// SubscribeFrom registers a subscriber and returns the buffered events after
+// lastID that pass the filter. ok is false when lastID is empty, was issued by
+// another hub, or is older than the replay buffer, in which case the caller
+// should resync from a snapshot.
+func (h *EventHub) SubscribeFrom(lastID string, filter func(HubEvent) bool) (*hubSubscriber, []HubEvent, bool) {
+	sub := &hubSubscriber{
+		events: make(chan HubEvent, hubSubscriberBuffer),
+		filter: filter,
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribers[sub] = struct{}{}
+	if lastID == "" {
+		return sub, nil, false
+	}
+	lastSeq, ok := h.parseEventID(lastID)
+	if !ok {
+		return sub, nil, false
+	}
+	replay, ok := h.replayLocked(lastSeq)
+	if !ok {
+		return sub, nil, false
+	}
+	filtered := replay[:0]
+	for _, event := range replay {
+		if filter == nil || filter(event) {
+			filtered = append(filtered, event)
+		}
+	}
+	return sub, filtered, true
+}
+
+func (h *EventHub) replayLocked(lastSeq int64) ([]HubEvent, bool) {
+	if lastSeq > h.lastSeq {
+		return nil, false
+	}
+	if lastSeq == h.lastSeq {
+		return nil, true
+	}
+	if h.historyLen == 0 {
+		return nil, false
+	}
+	oldest := h.history[(h.historyNext-h.historyLen+len(h.history))%len(h.history)]
+	if lastSeq < oldest.seq-1 {
+		return nil, false
+	}
+	events := []HubEvent{}
+	for i := 0; i < h.historyLen; i++ {
+		event := h.history[(h.historyNext-h.historyLen+i+len(h.history))%len(h.history)]
+		if event.seq > lastSeq {
+			events = append(events, event)
+		}
+	}
+	return events, true
+}
+
+func (h *EventHub) LastID() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.eventID(h.lastSeq)
+}
+
+func (h *EventHub) Unsubscribe(sub *hubSubscriber) {
+	h.mu.Lock()
+	delete(h.subscribers, sub)
+	h.mu.Unlock()
+}
+
+func (h *EventHub) SubscriberCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subscribers)
+}
+
+// Publish never blocks: slow subscribers drop the event and are flagged as
+// lagged instead of stalling the tick loop or a purchase request.
+func (h *EventHub) Publish(event HubEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastSeq++
+	event.seq = h.lastSeq
+	event.ID = h.eventID(h.lastSeq)
+	h.history[h.historyNext] = event
+	h.historyNext = (h.historyNext + 1) % len(h.history)
+	if h.historyLen < len(h.history) {
+		h.historyLen++
+	}
+	for sub := range h.subscribers {
+		if sub.filter != nil && !sub.filter(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			atomic.StoreInt32(&sub.lagged, 1)
+		}
+	}
+}
+
+// broadcastHubEvent publishes locally and forwards the event to the other
+// instances so their stream subscribers see it too.
+func broadcastHubEvent(event HubEvent) {
+	liveHub.Publish(event)
+	clusterFanout.Forward(event)
+}
+
+func buildEconomyDelta(now time.Time) EconomyDelta {
+	coins := economy.CoinsInCirculation()
+	remaining := seasonSecondsRemaining(now)
+	return EconomyDelta{
+		ServerTime:            now.Format(time.RFC3339),
+		SecondsRemaining:      remaining,
+		CoinsInCirculation:    coins,
+		CoinEmissionPerMinute: economy.EffectiveEmissionPerMinute(remaining, economy.ActiveCoinsInCirculation()),
+		CurrentStarPrice:      ComputeStarPrice(coins, remaining),
+		NextEmissionInSeconds: nextEmissionSeconds(now),
+		MarketPressure:        economy.MarketPressure(),
+	}
+}
+
+func publishEconomyUpdate() {
+	now := time.Now().UTC()
+	if isSeasonEnded(now) {
+		return
+	}
+	broadcastHubEvent(HubEvent{Type: HubEventEconomy, Payload: buildEconomyDelta(now)})
+}
+
+func publishSeasonUpdate() {
+	broadcastHubEvent(HubEvent{Type: HubEventSeason})
+}
+
+func publishPlayerBalance(playerID string, coins int64, stars int64) {
+	if playerID == "" {
+		return
+	}
+	broadcastHubEvent(HubEvent{
+		Type:     HubEventBalance,
+		PlayerID: playerID,
+		Payload:  BalanceDelta{PlayerCoins: coins, PlayerStars: stars},
+	})
+}
+
+func publishPlayerBalanceFromDB(db *sql.DB, playerID string) {
+	var coins int64
+	var stars int64
+	if err := db.QueryRow(`
+		SELECT coins, stars
+		FROM players
+		WHERE player_id = $1
+	`, playerID).Scan(&coins, &stars); err != nil {
+		return
+	}
+	publishPlayerBalance(playerID, coins, stars)
+}
+
+func publishLeaderboardChange(seasonID string, changedPlayers int) {
+	broadcastHubEvent(HubEvent{
+		Type:    HubEventLeaderboard,
+		Payload: LeaderboardDelta{SeasonID: seasonID, ChangedPlayers: changedPlayers},
+	})
+}
+
+func publishNotificationCreated(id int64, role string, recipientAccountID string) {
+	broadcastHubEvent(HubEvent{
+		Type:          HubEventNotification,
+		AccountID:     recipientAccountID,
+		RecipientRole: role,
+		Payload:       NotificationDelta{ID: id},
+	})
+}
+
+// notificationVisibleTo mirrors notificationAccessSQL for freshly inserted
+// rows so stream subscribers only wake for notifications they can read.
+func notificationVisibleTo(event HubEvent, accountID string, role string) bool {
+	if event.AccountID != "" && event.AccountID != accountID {
+		return false
+	}
+	switch role {
+	case NotificationRoleAdmin:
+		return true
+	case NotificationRoleModerator:
+		return event.RecipientRole == NotificationRoleModerator
+	default:
+		return event.RecipientRole == NotificationRolePlayer
+	}
+}
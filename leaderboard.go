@@ -4,9 +4,11 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,6 +18,7 @@ type leaderboardFilters struct {
 	IncludeBots bool
 	BotOnly     bool
 	Sort        string
+	Scope       string
 	Page        int
 	PageSize    int
 }
@@ -46,11 +49,37 @@ func leaderboardHandler(db *sql.DB) http.HandlerFunc {
 			argIndex++
 		}
 
-		baseCTE := fmt.Sprintf(`
+		// scope=friends limits the board to the caller and accepted friends.
+		if filters.Scope == "friends" {
+			account, ok := requireScopedSession(db, w, r, ScopeReadLeaderboard)
+			if !ok {
+				return
+			}
+			whereClauses = append(whereClauses, "p.player_id IN ("+friendPlayerIDsSQL("$"+strconv.Itoa(argIndex))+" UNION SELECT $"+strconv.Itoa(argIndex+1)+")")
+			args = append(args, account.AccountID, account.PlayerID)
+			argIndex += 2
+		}
+
+		// Without a season the board keeps its original meaning: star purchase
+		// totals across all seasons, aggregated live. A season (or
+		// seasonId=current) is served from the materialized leaderboard_ranks
+		// table, whose stored rank is the canonical stars ranking; bot filters
+		// and alternate sorts are re-ranked over the filtered rows.
+		if filters.SeasonID == "current" {
+			args[0] = currentSeasonID()
+		}
+		rankExpr := "ROW_NUMBER() OVER (ORDER BY " + orderBy + ")"
+		if filters.SeasonID != "" && (filters.Sort == "" || filters.Sort == "stars_desc") && filters.IncludeBots && !filters.BotOnly && filters.Scope == "" {
+			rankExpr = "stored_rank"
+		}
+
+		var baseCTE string
+		if filters.SeasonID == "" {
+			baseCTE = fmt.Sprintf(`
 			WITH player_stats AS (
 				SELECT
+					NULL::INT AS stored_rank,
 					p.player_id,
-					p.coins,
 					p.stars,
 					p.created_at,
 					p.is_bot,
@@ -62,9 +91,29 @@ func leaderboardHandler(db *sql.DB) http.HandlerFunc {
 				LEFT JOIN accounts a ON a.player_id = p.player_id
 				LEFT JOIN star_purchase_log spl ON spl.player_id = p.player_id
 				WHERE %s
-				GROUP BY p.player_id, p.coins, p.stars, p.created_at, p.is_bot, p.bot_profile, a.display_name, a.username
+				GROUP BY p.player_id, p.stars, p.created_at, p.is_bot, p.bot_profile, a.display_name, a.username
 			)
 		`, strings.Join(whereClauses, " AND "))
+		} else {
+			baseCTE = fmt.Sprintf(`
+			WITH player_stats AS (
+				SELECT
+					lr.rank AS stored_rank,
+					lr.player_id,
+					lr.stars,
+					lr.player_created_at AS created_at,
+					p.is_bot,
+					p.bot_profile,
+					COALESCE(a.display_name, a.username, lr.player_id) AS display_name,
+					lr.coins_spent_lifetime,
+					lr.last_star_acquired_at
+				FROM leaderboard_ranks lr
+				JOIN players p ON p.player_id = lr.player_id
+				LEFT JOIN accounts a ON a.player_id = lr.player_id
+				WHERE lr.season_id = $1 AND %s
+			)
+		`, strings.Join(whereClauses, " AND "))
+		}
 
 		countQuery := baseCTE + "SELECT COUNT(*) FROM player_stats"
 		var total int
@@ -78,7 +127,7 @@ func leaderboardHandler(db *sql.DB) http.HandlerFunc {
 		resultsQuery := fmt.Sprintf(`
 			%s
 			SELECT
-				ROW_NUMBER() OVER (ORDER BY %s) AS rank,
+				%s AS rank,
 				player_id,
 				display_name,
 				stars,
@@ -89,7 +138,7 @@ func leaderboardHandler(db *sql.DB) http.HandlerFunc {
 			FROM player_stats
 			ORDER BY %s
 			LIMIT $%d OFFSET $%d
-		`, baseCTE, orderBy, orderBy, len(args)+1, len(args)+2)
+		`, baseCTE, rankExpr, orderBy, len(args)+1, len(args)+2)
 
 		rows, err := db.Query(resultsQuery, argsWithPage...)
 		if err != nil {
@@ -150,6 +199,7 @@ func parseLeaderboardFilters(r *http.Request) leaderboardFilters {
 		IncludeBots: includeBots,
 		BotOnly:     botOnly,
 		Sort:        strings.TrimSpace(query.Get("sort")),
+		Scope:       strings.TrimSpace(query.Get("scope")),
 		Page:        page,
 		PageSize:    pageSize,
 	}
@@ -181,3 +231,313 @@ func parsePositiveInt(value string, fallback int) int {
 	}
 	return parsed
 }
+
+// playerStarRank returns the player's 1-based position on the materialized
+// stars-descending leaderboard for the current season.
+func playerStarRank(db *sql.DB, playerID string) (int, error) {
+	var rank int
+	err := db.QueryRow(`
+		SELECT rank
+		FROM leaderboard_ranks
+		WHERE season_id = $1 AND player_id = $2
+	`, currentSeasonID(), playerID).Scan(&rank)
+	return rank, err
+}
+
+type leaderboardStanding struct {
+	Rank  int
+	Stars int64
+}
+
+// leaderboardStandings holds every player's materialized rank as of the
+// newest leaderboard event this instance has seen, so live streams find
+// their own rank in memory rather than each querying on every refresh.
+var (
+	leaderboardStandingsMu     sync.Mutex
+	leaderboardStandingsSeason string
+	leaderboardStandingsSeq    int64
+	leaderboardStandings       map[string]leaderboardStanding
+)
+
+// playerRankStanding returns the player's rank and stars as of a leaderboard
+// event. The first stream to handle an event loads the season's standings in
+// one query; the other streams, and replays of older events, reuse them.
+func playerRankStanding(db *sql.DB, event HubEvent, seasonID string, playerID string) (int, int64, bool) {
+	leaderboardStandingsMu.Lock()
+	defer leaderboardStandingsMu.Unlock()
+	if leaderboardStandings == nil || leaderboardStandingsSeason != seasonID || leaderboardStandingsSeq < event.seq {
+		rows, err := db.Query(`
+			SELECT player_id, rank, stars
+			FROM leaderboard_ranks
+			WHERE season_id = $1
+		`, seasonID)
+		if err != nil {
+			log.Println("leaderboard standings load failed:", err)
+			return 0, 0, false
+		}
+		standings := map[string]leaderboardStanding{}
+		for rows.Next() {
+			var id string
+			var standing leaderboardStanding
+			if err := rows.Scan(&id, &standing.Rank, &standing.Stars); err != nil {
+				rows.Close()
+				log.Println("leaderboard standings load failed:", err)
+				return 0, 0, false
+			}
+			standings[id] = standing
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			log.Println("leaderboard standings load failed:", err)
+			return 0, 0, false
+		}
+		leaderboardStandings = standings
+		leaderboardStandingsSeason = seasonID
+		leaderboardStandingsSeq = event.seq
+	}
+	standing, ok := leaderboardStandings[playerID]
+	return standing.Rank, standing.Stars, ok
+}
+
+func leaderboardHistoryHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		playerID := strings.TrimSpace(query.Get("playerId"))
+		if !isValidPlayerID(playerID) {
+			json.NewEncoder(w).Encode(LeaderboardHistoryResponse{OK: false, Error: "INVALID_PLAYER_ID"})
+			return
+		}
+		seasonID := strings.TrimSpace(query.Get("seasonId"))
+		if seasonID == "" || seasonID == "current" {
+			seasonID = currentSeasonID()
+		}
+		limit := parsePositiveInt(query.Get("limit"), 100)
+		if limit > 500 {
+			limit = 500
+		}
+
+		var currentRank int
+		err := db.QueryRow(`
+			SELECT rank
+			FROM leaderboard_ranks
+			WHERE season_id = $1 AND player_id = $2
+		`, seasonID, playerID).Scan(&currentRank)
+		if err == sql.ErrNoRows {
+			json.NewEncoder(w).Encode(LeaderboardHistoryResponse{OK: false, Error: "PLAYER_NOT_RANKED"})
+			return
+		}
+		if err != nil {
+			json.NewEncoder(w).Encode(LeaderboardHistoryResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT rank, previous_rank, stars, recorded_at
+			FROM leaderboard_rank_history
+			WHERE season_id = $1 AND player_id = $2
+			ORDER BY recorded_at DESC, id DESC
+			LIMIT $3
+		`, seasonID, playerID, limit)
+		if err != nil {
+			json.NewEncoder(w).Encode(LeaderboardHistoryResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		defer rows.Close()
+
+		history := []LeaderboardHistoryEntry{}
+		for rows.Next() {
+			var entry LeaderboardHistoryEntry
+			var previous sql.NullInt64
+			var recordedAt time.Time
+			if err := rows.Scan(&entry.Rank, &previous, &entry.Stars, &recordedAt); err != nil {
+				continue
+			}
+			if previous.Valid {
+				value := int(previous.Int64)
+				entry.PreviousRank = &value
+			}
+			entry.RecordedAt = recordedAt.UTC().Format(time.RFC3339)
+			history = append(history, entry)
+		}
+
+		json.NewEncoder(w).Encode(LeaderboardHistoryResponse{
+			OK:          true,
+			PlayerID:    playerID,
+			SeasonID:    seasonID,
+			CurrentRank: currentRank,
+			History:     history,
+		})
+	}
+}
+
+// rankedPlayerCount is the tier denominator: players holding at least one star.
+func rankedPlayerCount(db *sql.DB, seasonID string) (int, error) {
+	var total int
+	err := db.QueryRow(`
+		SELECT COUNT(*)
+		FROM leaderboard_ranks
+		WHERE season_id = $1 AND stars > 0
+	`, seasonID).Scan(&total)
+	return total, err
+}
+
+func leaderboardAroundMeHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		account, ok := requireScopedSession(db, w, r, ScopeReadLeaderboard)
+		if !ok {
+			return
+		}
+
+		span := parsePositiveInt(r.URL.Query().Get("n"), 5)
+		if span > 25 {
+			span = 25
+		}
+		seasonID := currentSeasonID()
+
+		var rank int
+		var stars int64
+		err := db.QueryRow(`
+			SELECT rank, stars
+			FROM leaderboard_ranks
+			WHERE season_id = $1 AND player_id = $2
+		`, seasonID, account.PlayerID).Scan(&rank, &stars)
+		if err == sql.ErrNoRows {
+			json.NewEncoder(w).Encode(LeaderboardAroundMeResponse{OK: false, Error: "PLAYER_NOT_RANKED"})
+			return
+		}
+		if err != nil {
+			json.NewEncoder(w).Encode(LeaderboardAroundMeResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		total, err := rankedPlayerCount(db, seasonID)
+		if err != nil {
+			json.NewEncoder(w).Encode(LeaderboardAroundMeResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT
+				lr.rank,
+				lr.player_id,
+				COALESCE(a.display_name, a.username, lr.player_id) AS display_name,
+				lr.stars,
+				lr.coins_spent_lifetime,
+				lr.last_star_acquired_at,
+				p.is_bot,
+				p.bot_profile
+			FROM leaderboard_ranks lr
+			JOIN players p ON p.player_id = lr.player_id
+			LEFT JOIN accounts a ON a.player_id = lr.player_id
+			WHERE lr.season_id = $1 AND lr.rank BETWEEN $2 AND $3
+			ORDER BY lr.rank ASC
+		`, seasonID, rank-span, rank+span)
+		if err != nil {
+			json.NewEncoder(w).Encode(LeaderboardAroundMeResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		defer rows.Close()
+
+		results := []LeaderboardEntry{}
+		for rows.Next() {
+			var entry LeaderboardEntry
+			var lastStar sql.NullTime
+			var botProfile sql.NullString
+			if err := rows.Scan(&entry.Rank, &entry.PlayerID, &entry.DisplayName, &entry.Stars, &entry.CoinsSpentLifetime, &lastStar, &entry.IsBot, &botProfile); err != nil {
+				continue
+			}
+			if lastStar.Valid {
+				entry.LastStarAcquiredAt = lastStar.Time.UTC().Format(time.RFC3339)
+			}
+			if botProfile.Valid {
+				entry.BotProfile = botProfile.String
+			}
+			entry.Tier = leaderboardTierForRank(entry.Rank, total, entry.Stars)
+			results = append(results, entry)
+		}
+
+		json.NewEncoder(w).Encode(LeaderboardAroundMeResponse{
+			OK:            true,
+			SeasonID:      seasonID,
+			Rank:          rank,
+			Tier:          leaderboardTierForRank(rank, total, stars),
+			RankedPlayers: total,
+			Results:       results,
+		})
+	}
+}
+
+// leaderboardTiersHandler summarizes each percentile tier: the rank range it
+// covers, how many players are in it and the stars needed to enter it.
+func leaderboardTiersHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		seasonID := strings.TrimSpace(r.URL.Query().Get("seasonId"))
+		if seasonID == "" {
+			seasonID = currentSeasonID()
+		}
+		total, err := rankedPlayerCount(db, seasonID)
+		if err != nil {
+			json.NewEncoder(w).Encode(LeaderboardTiersResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+
+		tiers := []LeaderboardTierSummary{}
+		fromRank := 1
+		for _, tier := range leaderboardTiers {
+			summary := LeaderboardTierSummary{
+				Name:           tier.Name,
+				Label:          tier.Label,
+				TopBasisPoints: tier.TopBasisPoints,
+			}
+			toRank := tierCutoffRank(tier, total)
+			if toRank >= fromRank {
+				summary.FromRank = fromRank
+				summary.ToRank = toRank
+				summary.Players = toRank - fromRank + 1
+				if err := db.QueryRow(`
+					SELECT stars
+					FROM leaderboard_ranks
+					WHERE season_id = $1 AND rank = $2
+				`, seasonID, toRank).Scan(&summary.MinStars); err != nil && err != sql.ErrNoRows {
+					json.NewEncoder(w).Encode(LeaderboardTiersResponse{OK: false, Error: "INTERNAL_ERROR"})
+					return
+				}
+				fromRank = toRank + 1
+			}
+			tiers = append(tiers, summary)
+		}
+
+		response := LeaderboardTiersResponse{
+			OK:            true,
+			SeasonID:      seasonID,
+			RankedPlayers: total,
+			Tiers:         tiers,
+		}
+		if account := optionalScopedSession(db, r, ScopeReadLeaderboard); account != nil {
+			var rank int
+			var stars int64
+			if err := db.QueryRow(`
+				SELECT rank, stars
+				FROM leaderboard_ranks
+				WHERE season_id = $1 AND player_id = $2
+			`, seasonID, account.PlayerID).Scan(&rank, &stars); err == nil {
+				response.YourRank = rank
+				response.YourTier = leaderboardTierForRank(rank, total, stars)
+			}
+		}
+		json.NewEncoder(w).Encode(response)
+	}
+}
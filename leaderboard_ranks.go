@@ -0,0 +1,207 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// The leaderboard is materialized into leaderboard_ranks so page loads do not
+// aggregate star_purchase_log. A rebuild only runs when the ranking inputs
+// (players' stars and the season's purchase log) have changed, and a player's
+// rank is appended to leaderboard_rank_history when their own stats change,
+// not when they are merely shifted by someone else.
+const (
+	leaderboardRefreshLockID   int64 = 824173922
+	leaderboardRefreshInterval       = 2 * time.Second
+)
+
+// leaderboardRankedCTE ranks every player for season $1 using the default
+// leaderboard ordering. Season finalization uses the same ranking.
+var leaderboardRankedCTE = `
+	player_stats AS (
+		SELECT
+			p.player_id,
+			p.stars,
+			p.coins,
+			p.created_at,
+			COALESCE(SUM(spl.price_paid), 0) AS coins_spent_lifetime,
+			MAX(spl.created_at) AS last_star_acquired_at
+		FROM players p
+		LEFT JOIN star_purchase_log spl ON spl.player_id = p.player_id AND spl.season_id = $1
+		GROUP BY p.player_id, p.stars, p.coins, p.created_at
+	),
+	ranked AS (
+		SELECT player_stats.*, ROW_NUMBER() OVER (ORDER BY ` + leaderboardOrderBy("") + `) AS rank
+		FROM player_stats
+	)
+`
+
+type LeaderboardRankChange struct {
+	PlayerID     string
+	Rank         int
+	PreviousRank int
+	Stars        int64
+}
+
+var leaderboardRefreshPending int32
+
+// leaderboardInputsVersion fingerprints everything the ranking reads.
+// Database triggers bump a player's leaderboard_version whenever their stars,
+// bot or trust flag, or purchase log rows change, and count player deletions,
+// so the sum and the count only ever grow and any change moves the version.
+func leaderboardInputsVersion(db *sql.DB, seasonID string) (string, error) {
+	var versions, deleted int64
+	err := db.QueryRow(`
+		SELECT
+			(SELECT COALESCE(SUM(leaderboard_version), 0) FROM players),
+			(SELECT COALESCE(MAX(players_deleted), 0) FROM leaderboard_input_state)
+	`).Scan(&versions, &deleted)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%d:%d", seasonID, versions, deleted), nil
+}
+
+// requestLeaderboardRefresh marks the leaderboard stale; the refresher
+// coalesces bursts of purchases into a single rebuild.
+func requestLeaderboardRefresh() {
+	atomic.StoreInt32(&leaderboardRefreshPending, 1)
+}
+
+func startLeaderboardRefresher(db *sql.DB) {
+	requestLeaderboardRefresh()
+	go func() {
+		ticker := time.NewTicker(leaderboardRefreshInterval)
+		defer ticker.Stop()
+		lastVersion := ""
+		for range ticker.C {
+			if atomic.SwapInt32(&leaderboardRefreshPending, 0) == 0 {
+				continue
+			}
+			seasonID := currentSeasonID()
+			version, err := leaderboardInputsVersion(db, seasonID)
+			if err != nil {
+				log.Println("leaderboard version check failed:", err)
+				requestLeaderboardRefresh()
+				continue
+			}
+			if version == lastVersion {
+				continue
+			}
+			if _, err := refreshLeaderboardRanks(db, seasonID, time.Now().UTC()); err != nil {
+				log.Println("leaderboard refresh failed:", err)
+				requestLeaderboardRefresh()
+				continue
+			}
+			lastVersion = version
+		}
+	}()
+}
+
+// refreshLeaderboardRanks recomputes the season ranking, upserts rows that
+// changed, records history for players whose stats changed and returns every
+// rank movement.
+func refreshLeaderboardRanks(db *sql.DB, seasonID string, now time.Time) ([]LeaderboardRankChange, error) {
+	if isSeasonEnded(now) {
+		return nil, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Serialize refreshes across instances so history rows are not doubled.
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, leaderboardRefreshLockID); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`
+		WITH `+leaderboardRankedCTE+`,
+		changed AS (
+			SELECT
+				r.*,
+				lr.rank AS previous_rank,
+				(lr.player_id IS NULL
+					OR lr.stars <> r.stars
+					OR lr.coins_spent_lifetime <> r.coins_spent_lifetime
+					OR lr.last_star_acquired_at IS DISTINCT FROM r.last_star_acquired_at) AS stats_changed
+			FROM ranked r
+			LEFT JOIN leaderboard_ranks lr ON lr.season_id = $1 AND lr.player_id = r.player_id
+			WHERE lr.player_id IS NULL
+				OR lr.rank <> r.rank
+				OR lr.stars <> r.stars
+				OR lr.coins_spent_lifetime <> r.coins_spent_lifetime
+				OR lr.last_star_acquired_at IS DISTINCT FROM r.last_star_acquired_at
+		),
+		history AS (
+			INSERT INTO leaderboard_rank_history (season_id, player_id, rank, previous_rank, stars, recorded_at)
+			SELECT $1, player_id, rank, previous_rank, stars, $2
+			FROM changed
+			WHERE stats_changed
+			RETURNING player_id
+		),
+		upserted AS (
+			INSERT INTO leaderboard_ranks (
+				season_id,
+				player_id,
+				rank,
+				stars,
+				coins_spent_lifetime,
+				last_star_acquired_at,
+				player_created_at,
+				updated_at
+			)
+			SELECT $1, player_id, rank, stars, coins_spent_lifetime, last_star_acquired_at, created_at, $2
+			FROM changed
+			ON CONFLICT (season_id, player_id) DO UPDATE SET
+				rank = EXCLUDED.rank,
+				stars = EXCLUDED.stars,
+				coins_spent_lifetime = EXCLUDED.coins_spent_lifetime,
+				last_star_acquired_at = EXCLUDED.last_star_acquired_at,
+				updated_at = EXCLUDED.updated_at
+			RETURNING player_id
+		)
+		SELECT player_id, rank, COALESCE(previous_rank, 0), stars
+		FROM changed
+		WHERE previous_rank IS DISTINCT FROM rank
+	`, seasonID, now)
+	if err != nil {
+		return nil, err
+	}
+	changes := []LeaderboardRankChange{}
+	for rows.Next() {
+		var change LeaderboardRankChange
+		if err := rows.Scan(&change.PlayerID, &change.Rank, &change.PreviousRank, &change.Stars); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`
+		DELETE FROM leaderboard_ranks lr
+		WHERE lr.season_id = $1
+			AND NOT EXISTS (SELECT 1 FROM players p WHERE p.player_id = lr.player_id)
+	`, seasonID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if len(changes) > 0 {
+		publishLeaderboardChange(seasonID, len(changes))
+		handleRankChanges(db, seasonID, changes)
+	}
+	return changes, nil
+}
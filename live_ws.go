@@ -0,0 +1,394 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Channels multiplexed over /ws.
+const (
+	wsChannelSeason        = "season"
+	wsChannelBalance       = "balance"
+	wsChannelNotifications = "notifications"
+	wsChannelLeaderboard   = "leaderboard"
+)
+
+var wsChannelList = []string{
+	wsChannelSeason,
+	wsChannelBalance,
+	wsChannelNotifications,
+	wsChannelLeaderboard,
+}
+
+// wsClientMessage is sent by the browser to subscribe or unsubscribe channels.
+type wsClientMessage struct {
+	Type     string   `json:"type"`
+	Channels []string `json:"channels,omitempty"`
+}
+
+type wsServerMessage struct {
+	ID       string      `json:"id,omitempty"`
+	Channel  string      `json:"channel,omitempty"`
+	Type     string      `json:"type"`
+	Data     interface{} `json:"data,omitempty"`
+	Channels []string    `json:"channels,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+func isWSChannel(channel string) bool {
+	for _, candidate := range wsChannelList {
+		if candidate == channel {
+			return true
+		}
+	}
+	return false
+}
+
+func parseWSChannels(raw string) []string {
+	channels := []string{}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part != "" {
+			channels = append(channels, part)
+		}
+	}
+	return channels
+}
+
+// wsSession owns all per-socket state; only the serve loop touches it.
+type wsSession struct {
+	db                 *sql.DB
+	ws                 *wsConn
+	account            *Account
+	role               string
+	subscribed         map[string]bool
+	adjustment         playerPriceAdjustment
+	lastNotificationID int64
+	// lastRank is the rank last sent on the leaderboard channel.
+	lastRank int
+}
+
+// liveSocketHandler serves /ws. Channels can be preselected with ?channels=
+// and a reconnecting client passes ?lastEventId= to replay what it missed;
+// a "reset" message means the gap was too large and baselines follow.
+func liveSocketHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		account, ok := requireSession(db, w, r)
+		if !ok {
+			return
+		}
+		ws, err := upgradeWebSocket(w, r)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		session := &wsSession{
+			db:         db,
+			ws:         ws,
+			account:    account,
+			role:       notificationRoleForAccount(account),
+			subscribed: map[string]bool{},
+			adjustment: loadPlayerPriceAdjustment(db, account.PlayerID),
+		}
+
+		lastEventID := strings.TrimSpace(r.URL.Query().Get("lastEventId"))
+		initial := parseWSChannels(r.URL.Query().Get("channels"))
+		session.serve(lastEventID, initial)
+	}
+}
+
+func (s *wsSession) filter(event HubEvent) bool {
+	switch event.Type {
+	case HubEventEconomy, HubEventSeason, HubEventLeaderboard:
+		return true
+	case HubEventBalance:
+		return event.PlayerID == s.account.PlayerID
+	case HubEventNotification:
+		return notificationVisibleTo(event, s.account.AccountID, s.role)
+	default:
+		return false
+	}
+}
+
+func (s *wsSession) serve(lastEventID string, initial []string) {
+	sub, replay, resumed := liveHub.SubscribeFrom(lastEventID, s.filter)
+	defer liveHub.Unsubscribe(sub)
+
+	incoming := make(chan wsClientMessage, 8)
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		for {
+			opcode, data, err := s.ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			if opcode != wsOpText {
+				continue
+			}
+			var msg wsClientMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				msg = wsClientMessage{Type: "invalid"}
+			}
+			select {
+			case incoming <- msg:
+			case <-time.After(5 * time.Second):
+				return
+			}
+		}
+	}()
+
+	if err := s.ws.WriteJSON(wsServerMessage{
+		ID:       liveHub.LastID(),
+		Type:     "welcome",
+		Channels: wsChannelList,
+	}); err != nil {
+		return
+	}
+	if len(initial) > 0 {
+		if !s.subscribe(initial, !resumed) {
+			return
+		}
+	}
+	if lastEventID != "" {
+		if resumed {
+			if !s.replay(replay) {
+				return
+			}
+		} else if err := s.ws.WriteJSON(wsServerMessage{ID: liveHub.LastID(), Type: "reset"}); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(25 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-readerDone:
+			return
+		case msg := <-incoming:
+			if !s.handleClientMessage(msg) {
+				return
+			}
+		case <-heartbeat.C:
+			if err := s.ws.WriteMessage(wsOpPing, nil); err != nil {
+				return
+			}
+		case event := <-sub.Events():
+			if sub.TakeLagged() {
+				if !s.resync() {
+					return
+				}
+				continue
+			}
+			if !s.handleEvent(event) {
+				return
+			}
+		}
+	}
+}
+
+func (s *wsSession) handleClientMessage(msg wsClientMessage) bool {
+	switch msg.Type {
+	case "subscribe":
+		return s.subscribe(msg.Channels, true)
+	case "unsubscribe":
+		for _, channel := range msg.Channels {
+			delete(s.subscribed, strings.ToLower(strings.TrimSpace(channel)))
+		}
+		return s.ws.WriteJSON(wsServerMessage{Type: "unsubscribed", Channels: s.channels()}) == nil
+	case "ping":
+		return s.ws.WriteJSON(wsServerMessage{ID: liveHub.LastID(), Type: "pong"}) == nil
+	default:
+		return s.ws.WriteJSON(wsServerMessage{Type: "error", Error: "INVALID_MESSAGE"}) == nil
+	}
+}
+
+func (s *wsSession) channels() []string {
+	channels := []string{}
+	for _, channel := range wsChannelList {
+		if s.subscribed[channel] {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+func (s *wsSession) subscribe(channels []string, sendInitial bool) bool {
+	added := []string{}
+	for _, channel := range channels {
+		channel = strings.ToLower(strings.TrimSpace(channel))
+		if !isWSChannel(channel) {
+			if err := s.ws.WriteJSON(wsServerMessage{Type: "error", Channel: channel, Error: "UNKNOWN_CHANNEL"}); err != nil {
+				return false
+			}
+			continue
+		}
+		if s.subscribed[channel] {
+			continue
+		}
+		s.subscribed[channel] = true
+		added = append(added, channel)
+	}
+	if err := s.ws.WriteJSON(wsServerMessage{Type: "subscribed", Channels: s.channels()}); err != nil {
+		return false
+	}
+	for _, channel := range added {
+		if channel == wsChannelNotifications {
+			s.lastNotificationID = s.latestNotificationID()
+		}
+		if sendInitial && !s.sendInitial(channel) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *wsSession) latestNotificationID() int64 {
+	items, err := fetchNotifications(s.db, s.account.AccountID, s.role, 0, 1, false)
+	if err != nil || len(items) == 0 {
+		return 0
+	}
+	return items[0].ID
+}
+
+func (s *wsSession) sendInitial(channel string) bool {
+	id := liveHub.LastID()
+	switch channel {
+	case wsChannelSeason:
+		s.adjustment = loadPlayerPriceAdjustment(s.db, s.account.PlayerID)
+		snapshot := buildLiveSnapshotForAccount(s.db, s.account)
+		return s.ws.WriteJSON(wsServerMessage{ID: id, Channel: wsChannelSeason, Type: "snapshot", Data: snapshot}) == nil
+	case wsChannelBalance:
+		player, err := LoadPlayer(s.db, s.account.PlayerID)
+		if err != nil || player == nil {
+			return true
+		}
+		data := BalanceDelta{PlayerCoins: player.Coins, PlayerStars: player.Stars}
+		return s.ws.WriteJSON(wsServerMessage{ID: id, Channel: wsChannelBalance, Type: "balance", Data: data}) == nil
+	case wsChannelLeaderboard:
+		rank, err := playerStarRank(s.db, s.account.PlayerID)
+		if err != nil {
+			return true
+		}
+		s.lastRank = rank
+		data := RankChangedDelta{SeasonID: currentSeasonID(), Rank: rank}
+		return s.ws.WriteJSON(wsServerMessage{ID: id, Channel: wsChannelLeaderboard, Type: "rank", Data: data}) == nil
+	}
+	return true
+}
+
+// resync is used after the subscriber lagged behind the hub: every subscribed
+// channel gets a fresh baseline instead of the dropped deltas.
+func (s *wsSession) resync() bool {
+	if err := s.ws.WriteJSON(wsServerMessage{ID: liveHub.LastID(), Type: "reset"}); err != nil {
+		return false
+	}
+	for _, channel := range s.channels() {
+		if !s.sendInitial(channel) {
+			return false
+		}
+	}
+	if s.subscribed[wsChannelNotifications] {
+		return s.sendPendingNotifications(liveHub.LastID())
+	}
+	return true
+}
+
+func (s *wsSession) replay(events []HubEvent) bool {
+	// Replayed notification events only carry IDs, so rewind the cursor to
+	// just before the oldest one and let the normal fetch deliver them.
+	for _, event := range events {
+		if delta, ok := event.Payload.(NotificationDelta); ok && s.subscribed[wsChannelNotifications] {
+			if s.lastNotificationID == 0 || delta.ID-1 < s.lastNotificationID {
+				s.lastNotificationID = delta.ID - 1
+			}
+		}
+	}
+	for _, event := range events {
+		if !s.handleEvent(event) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *wsSession) handleEvent(event HubEvent) bool {
+	switch event.Type {
+	case HubEventEconomy:
+		if !s.subscribed[wsChannelSeason] {
+			return true
+		}
+		delta, ok := event.Payload.(EconomyDelta)
+		if !ok {
+			return true
+		}
+		delta.CurrentStarPrice = s.adjustment.Apply(delta.CurrentStarPrice)
+		return s.ws.WriteJSON(wsServerMessage{ID: event.ID, Channel: wsChannelSeason, Type: "economy", Data: delta}) == nil
+	case HubEventSeason:
+		if !s.subscribed[wsChannelSeason] {
+			return true
+		}
+		snapshot := buildLiveSnapshotForAccount(s.db, s.account)
+		return s.ws.WriteJSON(wsServerMessage{ID: event.ID, Channel: wsChannelSeason, Type: "snapshot", Data: snapshot}) == nil
+	case HubEventBalance:
+		if s.subscribed[wsChannelSeason] {
+			s.adjustment = loadPlayerPriceAdjustment(s.db, s.account.PlayerID)
+		}
+		if !s.subscribed[wsChannelBalance] {
+			return true
+		}
+		return s.ws.WriteJSON(wsServerMessage{ID: event.ID, Channel: wsChannelBalance, Type: "balance", Data: event.Payload}) == nil
+	case HubEventNotification:
+		if !s.subscribed[wsChannelNotifications] {
+			return true
+		}
+		if delta, ok := event.Payload.(NotificationDelta); ok && delta.ID <= s.lastNotificationID {
+			return true
+		}
+		return s.sendPendingNotifications(event.ID)
+	case HubEventLeaderboard:
+		if !s.subscribed[wsChannelLeaderboard] {
+			return true
+		}
+		if err := s.ws.WriteJSON(wsServerMessage{ID: event.ID, Channel: wsChannelLeaderboard, Type: "updated", Data: event.Payload}); err != nil {
+			return false
+		}
+		// One leaderboard event covers the whole refresh; each socket looks
+		// up its own rank in the shared standings rather than receiving an
+		// event per moved player.
+		delta, ok := event.Payload.(LeaderboardDelta)
+		if !ok {
+			return true
+		}
+		rank, stars, ok := playerRankStanding(s.db, event, delta.SeasonID, s.account.PlayerID)
+		if !ok || rank == s.lastRank {
+			return true
+		}
+		change := RankChangedDelta{SeasonID: delta.SeasonID, Rank: rank, PreviousRank: s.lastRank, Stars: stars}
+		s.lastRank = rank
+		return s.ws.WriteJSON(wsServerMessage{ID: event.ID, Channel: wsChannelLeaderboard, Type: "rank_changed", Data: change}) == nil
+	}
+	return true
+}
+
+func (s *wsSession) sendPendingNotifications(eventID string) bool {
+	items, err := fetchNotifications(s.db, s.account.AccountID, s.role, s.lastNotificationID, 25, true)
+	if err != nil {
+		return true
+	}
+	for _, item := range items {
+		if err := s.ws.WriteJSON(wsServerMessage{ID: eventID, Channel: wsChannelNotifications, Type: "notification", Data: item}); err != nil {
+			return false
+		}
+		if item.ID > s.lastNotificationID {
+			s.lastNotificationID = item.ID
+		}
+	}
+	return true
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Failed logins are counted per account as well as per IP, so credential
+// stuffing spread across many IPs still slows down. LOGIN_LOCKOUT_THRESHOLD
+// failures within LOGIN_FAILURE_WINDOW_SECONDS lock the account for
+// LOGIN_LOCKOUT_BASE_SECONDS, doubling with each further lockout up to
+// LOGIN_LOCKOUT_MAX_SECONDS. The doubling resets after a successful login or
+// a quiet day. While locked, even the right password is refused with
+// ACCOUNT_LOCKED, so a lucky guess cannot be confirmed.
+//
+// Lockouts and unlocks are written to abuse_events as account_lockout and
+// account_unlock, and the owner is told about each lockout.
+const (
+	loginLockoutLevelReset = 24 * time.Hour
+)
+
+type loginLockoutConfig struct {
+	threshold int
+	window    time.Duration
+	base      time.Duration
+	max       time.Duration
+}
+
+func loginLockoutSettings() loginLockoutConfig {
+	return loginLockoutConfig{
+		threshold: parseEnvInt("LOGIN_LOCKOUT_THRESHOLD", 5),
+		window:    time.Duration(parseEnvInt("LOGIN_FAILURE_WINDOW_SECONDS", 900)) * time.Second,
+		base:      time.Duration(parseEnvInt("LOGIN_LOCKOUT_BASE_SECONDS", 60)) * time.Second,
+		max:       time.Duration(parseEnvInt("LOGIN_LOCKOUT_MAX_SECONDS", 3600)) * time.Second,
+	}
+}
+
+// lockoutDuration is the lock for the given lockout level: base, 2×base,
+// 4×base, ... capped at max.
+func (c loginLockoutConfig) lockoutDuration(level int) time.Duration {
+	if level < 1 {
+		level = 1
+	}
+	d := float64(c.base) * math.Pow(2, float64(level-1))
+	if d > float64(c.max) {
+		return c.max
+	}
+	return time.Duration(d)
+}
+
+type loginTarget struct {
+	AccountID string
+	PlayerID  string
+}
+
+// lookupLoginTarget finds the account a login attempt names. It returns nil
+// for unknown usernames, which have nothing to lock.
+func lookupLoginTarget(db *sql.DB, username string) (*loginTarget, error) {
+	username = strings.TrimSpace(strings.ToLower(username))
+	if username == "" {
+		return nil, nil
+	}
+	var target loginTarget
+	err := db.QueryRow(`
+		SELECT account_id, player_id
+		FROM accounts
+		WHERE username = $1
+	`, username).Scan(&target.AccountID, &target.PlayerID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+func logLoginLockEvent(db *sql.DB, target *loginTarget, eventType string, severity int, details map[string]interface{}) {
+	logAbuseEvent(db, AbuseSignal{
+		PlayerID:  target.PlayerID,
+		EventType: eventType,
+		Severity:  severity,
+		Details:   details,
+	}, target.AccountID, currentSeasonID(), time.Now().UTC())
+}
+
+// accountLockRemaining reports how long the account stays locked. A lock
+// found to have run out is cleared here and logged as an unlock.
+func accountLockRemaining(db *sql.DB, target *loginTarget) (time.Duration, error) {
+	var lockedUntil sql.NullTime
+	err := db.QueryRow(`
+		SELECT locked_until
+		FROM account_login_failures
+		WHERE account_id = $1
+	`, target.AccountID).Scan(&lockedUntil)
+	if err == sql.ErrNoRows || (err == nil && !lockedUntil.Valid) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if remaining := time.Until(lockedUntil.Time); remaining > 0 {
+		return remaining, nil
+	}
+	res, err := db.Exec(`
+		UPDATE account_login_failures
+		SET locked_until = NULL, updated_at = NOW()
+		WHERE account_id = $1 AND locked_until IS NOT NULL AND locked_until <= NOW()
+	`, target.AccountID)
+	if err != nil {
+		return 0, err
+	}
+	if affected, _ := res.RowsAffected(); affected > 0 {
+		logLoginLockEvent(db, target, "account_unlock", 0, map[string]interface{}{
+			"reason": "expired",
+		})
+	}
+	return 0, nil
+}
+
+// recordLoginFailure counts a failed password or second factor against the
+// account and locks it once the threshold is reached. It returns the length
+// of the new lock, or zero.
+func recordLoginFailure(db *sql.DB, target *loginTarget, ip string, userAgent string, reason string) (time.Duration, error) {
+	config := loginLockoutSettings()
+	if config.threshold <= 0 || config.base <= 0 {
+		return 0, nil
+	}
+	now := time.Now().UTC()
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO account_login_failures (account_id, failed_count, lockout_level, updated_at)
+		VALUES ($1, 0, 0, $2)
+		ON CONFLICT (account_id) DO NOTHING
+	`, target.AccountID, now); err != nil {
+		return 0, err
+	}
+	var failedCount, level int
+	var lastFailedAt sql.NullTime
+	if err := tx.QueryRow(`
+		SELECT failed_count, lockout_level, last_failed_at
+		FROM account_login_failures
+		WHERE account_id = $1
+		FOR UPDATE
+	`, target.AccountID).Scan(&failedCount, &level, &lastFailedAt); err != nil {
+		return 0, err
+	}
+	if !lastFailedAt.Valid || now.Sub(lastFailedAt.Time) > config.window {
+		failedCount = 0
+	}
+	if !lastFailedAt.Valid || now.Sub(lastFailedAt.Time) > loginLockoutLevelReset {
+		level = 0
+	}
+	failedCount++
+
+	var lockFor time.Duration
+	var lockedUntil interface{}
+	if failedCount >= config.threshold {
+		level++
+		lockFor = config.lockoutDuration(level)
+		lockedUntil = now.Add(lockFor)
+		failedCount = 0
+	}
+	if _, err := tx.Exec(`
+		UPDATE account_login_failures
+		SET failed_count = $2,
+			lockout_level = $3,
+			last_failed_at = $4,
+			locked_until = COALESCE($5, locked_until),
+			updated_at = $4
+		WHERE account_id = $1
+	`, target.AccountID, failedCount, level, now, lockedUntil); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	if lockFor == 0 {
+		return 0, nil
+	}
+
+	severity := 1
+	if level >= 3 {
+		severity = 2
+	}
+	logLoginLockEvent(db, target, "account_lockout", severity, map[string]interface{}{
+		"reason":        reason,
+		"level":         level,
+		"lockSeconds":   int(lockFor.Seconds()),
+		"lockedUntil":   now.Add(lockFor).Format(time.RFC3339),
+		"lastIp":        ip,
+		"lastDevice":    describeUserAgent(userAgent),
+		"threshold":     config.threshold,
+		"windowSeconds": int(config.window.Seconds()),
+	})
+	message := "Too many failed sign-in attempts. Your account is locked for " + formatLockDuration(lockFor) + ". If this wasn't you, change your password."
+	emitNotification(db, NotificationInput{
+		RecipientRole:      NotificationRolePlayer,
+		RecipientAccountID: target.AccountID,
+		Category:           NotificationCategorySecurity,
+		Type:               "account_locked",
+		Priority:           NotificationPriorityHigh,
+		Message:            message,
+		Payload: map[string]interface{}{
+			"ip":          ip,
+			"lockSeconds": int(lockFor.Seconds()),
+		},
+	})
+	sendSecurityAlertEmail(db, target.AccountID, "account locked", message, describeUserAgent(userAgent), ip)
+	return lockFor, nil
+}
+
+func formatLockDuration(d time.Duration) string {
+	if d < time.Minute {
+		return strconv.Itoa(int(d.Seconds())) + " seconds"
+	}
+	minutes := int(math.Ceil(d.Minutes()))
+	if minutes == 1 {
+		return "1 minute"
+	}
+	return strconv.Itoa(minutes) + " minutes"
+}
+
+// verifyReauthentication confirms a signed-in account before a sensitive
+// change such as turning off 2FA or deleting the account. The password and,
+// when 2FA is on, the second factor are both checked before answering, and
+// any miss counts towards the login lockout and comes back as
+// INVALID_CREDENTIALS. A locked account gets ACCOUNT_LOCKED with the time
+// left, as at login.
+func verifyReauthentication(db *sql.DB, account *Account, r *http.Request, password string, code string, recoveryCode string) (string, time.Duration) {
+	target := &loginTarget{AccountID: account.AccountID, PlayerID: account.PlayerID}
+	remaining, err := accountLockRemaining(db, target)
+	if err != nil {
+		log.Println("reauth: lockout check error:", err)
+		return "INTERNAL_ERROR", 0
+	}
+	if remaining > 0 {
+		return "ACCOUNT_LOCKED", remaining
+	}
+	if account.TwoFactorEnabled && strings.TrimSpace(code) == "" && strings.TrimSpace(recoveryCode) == "" {
+		return "TOTP_REQUIRED", 0
+	}
+
+	failed := false
+	reason := "password"
+	if _, err := authenticate(db, account.Username, password); err != nil {
+		if err.Error() == "ACCOUNT_FROZEN" {
+			return "ACCOUNT_FROZEN", 0
+		}
+		if err.Error() != "INVALID_CREDENTIALS" {
+			log.Println("reauth: password check error:", err)
+			return "INTERNAL_ERROR", 0
+		}
+		failed = true
+	}
+	if account.TwoFactorEnabled {
+		if err := verifySecondFactor(db, account.AccountID, code, recoveryCode); err != nil {
+			if err.Error() != "INVALID_TOTP_CODE" && err.Error() != "INVALID_RECOVERY_CODE" {
+				log.Println("reauth: second factor check error:", err)
+				return "INTERNAL_ERROR", 0
+			}
+			if !failed {
+				reason = "second_factor"
+			}
+			failed = true
+		}
+	}
+	if failed {
+		lockFor, err := recordLoginFailure(db, target, getClientIP(r), r.UserAgent(), reason)
+		if err != nil {
+			log.Println("reauth: record failure error:", err)
+		}
+		if lockFor > 0 {
+			return "ACCOUNT_LOCKED", lockFor
+		}
+		return "INVALID_CREDENTIALS", 0
+	}
+	clearLoginFailures(db, account.AccountID)
+	return "", 0
+}
+
+// clearLoginFailures forgets an account's failures after a good login.
+func clearLoginFailures(db *sql.DB, accountID string) {
+	if _, err := db.Exec(`DELETE FROM account_login_failures WHERE account_id = $1`, accountID); err != nil {
+		log.Println("login: clear failures error:", err)
+	}
+}
+
+// unlockAccount lifts an active lock early and resets the doubling. It
+// reports whether a lock was lifted.
+func unlockAccount(db *sql.DB, accountID string, reason string, actorAccountID string) (bool, error) {
+	var playerID string
+	err := db.QueryRow(`
+		DELETE FROM account_login_failures f
+		USING accounts a
+		WHERE f.account_id = $1 AND a.account_id = f.account_id
+			AND f.locked_until IS NOT NULL AND f.locked_until > NOW()
+		RETURNING a.player_id
+	`, accountID).Scan(&playerID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	details := map[string]interface{}{"reason": reason}
+	if actorAccountID != "" {
+		details["actorAccountId"] = actorAccountID
+	}
+	logLoginLockEvent(db, &loginTarget{AccountID: accountID, PlayerID: playerID}, "account_unlock", 0, details)
+	return true, nil
+}
+
+// loginIPRange is the network a login came from: the /24 for IPv4 and the
+// /48 for IPv6. Moving within a range is normal; leaving it is worth a note.
+func loginIPRange(ip string) string {
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String() + "/48"
+}
+
+// recordLoginRange remembers the network of a successful login. It reports
+// whether the range is new for an account that has logged in before.
+func recordLoginRange(db *sql.DB, accountID string, ip string) bool {
+	ipRange := loginIPRange(ip)
+	if ipRange == "" {
+		return false
+	}
+	var inserted bool
+	err := db.QueryRow(`
+		INSERT INTO account_login_ranges (account_id, ip_range, first_seen_at, last_seen_at)
+		VALUES ($1, $2, NOW(), NOW())
+		ON CONFLICT (account_id, ip_range) DO UPDATE SET last_seen_at = NOW()
+		RETURNING (xmax = 0)
+	`, accountID, ipRange).Scan(&inserted)
+	if err != nil || !inserted {
+		return false
+	}
+	var known int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM account_login_ranges WHERE account_id = $1`, accountID).Scan(&known); err != nil {
+		return false
+	}
+	return known > 1
+}
+
+type AdminAccountUnlockRequest struct {
+	Username string `json:"username"`
+	Reason   string `json:"reason"`
+}
+
+func adminAccountUnlockHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		admin, ok := requirePermission(db, w, r, PermFreezeAccounts)
+		if !ok {
+			return
+		}
+		var req AdminAccountUnlockRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Username) == "" {
+			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "INVALID_REQUEST"})
+			return
+		}
+		target, err := lookupLoginTarget(db, req.Username)
+		if err != nil {
+			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if target == nil {
+			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "NOT_FOUND"})
+			return
+		}
+		unlocked, err := unlockAccount(db, target.AccountID, "admin", admin.AccountID)
+		if err != nil {
+			log.Println("admin unlock: error:", err)
+			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if !unlocked {
+			json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "NOT_LOCKED"})
+			return
+		}
+		_ = logAdminAction(db, admin.AccountID, "account_unlock", "account", target.AccountID, strings.TrimSpace(req.Reason), map[string]interface{}{
+			"username": strings.TrimSpace(strings.ToLower(req.Username)),
+		})
+		json.NewEncoder(w).Encode(SimpleResponse{OK: true})
+	}
+}
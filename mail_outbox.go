@@ -0,0 +1,297 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"math"
+	"strings"
+	"time"
+)
+
+// Outgoing mail is rendered when it is queued and stored in mail_outbox. The
+// leader drains the outbox on a ticker, so a slow or failing SMTP server never
+// holds up a request. Failed sends are retried with exponential backoff until
+// MAIL_MAX_ATTEMPTS is reached, after which the row is marked failed.
+//
+// Bodies can hold single-use links and personal details, so they are cleared
+// as soon as a row is sent or fails for good. Reset and verification mail
+// still waiting when its link expires is failed instead of sent, and failed
+// rows of that kind are deleted once the link would have expired.
+const (
+	MailStatusPending = "pending"
+	MailStatusSent    = "sent"
+	MailStatusFailed  = "failed"
+
+	mailOutboxInterval  = 5 * time.Second
+	mailOutboxBatchSize = 20
+	// mailOutboxLease keeps a claimed row from being picked up again while
+	// its send is still in flight.
+	mailOutboxLease     = 2 * time.Minute
+	mailRetryBaseDelay  = 30 * time.Second
+	mailRetryMaxDelay   = 1 * time.Hour
+	mailOutboxRetention = 30 * 24 * time.Hour
+)
+
+func mailMaxAttempts() int {
+	return parseEnvInt("MAIL_MAX_ATTEMPTS", 6)
+}
+
+// mailRetryDelay is the wait after the given number of failed attempts:
+// 30s, 1m, 2m, ... capped at one hour.
+func mailRetryDelay(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := float64(mailRetryBaseDelay) * math.Pow(2, float64(attempts-1))
+	if delay > float64(mailRetryMaxDelay) {
+		return mailRetryMaxDelay
+	}
+	return time.Duration(delay)
+}
+
+// enqueueMail renders a template and queues it for delivery. A non-empty
+// dedupKey makes the call a no-op if that key was queued before.
+func enqueueMail(db *sql.DB, templateName string, to string, data interface{}, dedupKey string) error {
+	msg, err := renderMail(templateName, to, data)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		INSERT INTO mail_outbox (template, recipient, subject, text_body, html_body, dedup_key, status, next_attempt_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, NOW(), NOW())
+		ON CONFLICT (dedup_key) DO NOTHING
+	`, templateName, msg.To, msg.Subject, msg.TextBody, msg.HTMLBody, dedupKey, MailStatusPending)
+	return err
+}
+
+type outboxMail struct {
+	id        int64
+	template  string
+	attempts  int
+	createdAt time.Time
+	msg       MailMessage
+}
+
+// claimOutboxMail leases a batch of due mail to this instance.
+func claimOutboxMail(db *sql.DB) ([]outboxMail, error) {
+	rows, err := db.Query(`
+		UPDATE mail_outbox
+		SET next_attempt_at = NOW() + ($2 * INTERVAL '1 second')
+		WHERE id IN (
+			SELECT id
+			FROM mail_outbox
+			WHERE status = $1 AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, template, attempts, created_at, recipient, subject, text_body, COALESCE(html_body, '')
+	`, MailStatusPending, int(mailOutboxLease.Seconds()), mailOutboxBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []outboxMail
+	for rows.Next() {
+		var m outboxMail
+		if err := rows.Scan(&m.id, &m.template, &m.attempts, &m.createdAt, &m.msg.To, &m.msg.Subject, &m.msg.TextBody, &m.msg.HTMLBody); err != nil {
+			return nil, err
+		}
+		batch = append(batch, m)
+	}
+	return batch, rows.Err()
+}
+
+func processMailOutbox(db *sql.DB) {
+	batch, err := claimOutboxMail(db)
+	if err != nil {
+		log.Println("mail outbox: claim failed:", err)
+		return
+	}
+	mailer := currentMailer()
+	maxAttempts := mailMaxAttempts()
+	for _, m := range batch {
+		if ttl, ok := sensitiveMailTemplates[m.template]; ok && time.Since(m.createdAt) >= ttl {
+			log.Printf("mail outbox: dropping mail %d (%s): link expired before delivery", m.id, m.template)
+			if _, err := db.Exec(`
+				UPDATE mail_outbox
+				SET status = $2, last_error = 'LINK_EXPIRED', text_body = '', html_body = NULL
+				WHERE id = $1
+			`, m.id, MailStatusFailed); err != nil {
+				log.Println("mail outbox: mark expired failed:", err)
+			}
+			continue
+		}
+
+		sendErr := mailer.Send(m.msg)
+		attempts := m.attempts + 1
+		if sendErr == nil {
+			_, err = db.Exec(`
+				UPDATE mail_outbox
+				SET status = $2, attempts = $3, sent_at = NOW(), last_error = NULL, text_body = '', html_body = NULL
+				WHERE id = $1
+			`, m.id, MailStatusSent, attempts)
+			if err != nil {
+				log.Println("mail outbox: mark sent failed:", err)
+			}
+			continue
+		}
+
+		if attempts >= maxAttempts {
+			log.Printf("mail outbox: giving up on mail %d (%s) after %d attempts: %v", m.id, m.template, attempts, sendErr)
+			_, err = db.Exec(`
+				UPDATE mail_outbox
+				SET status = $2, attempts = $3, last_error = $4, text_body = '', html_body = NULL
+				WHERE id = $1
+			`, m.id, MailStatusFailed, attempts, truncateMailError(sendErr.Error()))
+		} else {
+			_, err = db.Exec(`
+				UPDATE mail_outbox
+				SET status = $2, attempts = $3, last_error = $4, next_attempt_at = $5
+				WHERE id = $1
+			`, m.id, MailStatusPending, attempts, truncateMailError(sendErr.Error()), time.Now().UTC().Add(mailRetryDelay(attempts)))
+		}
+		if err != nil {
+			log.Println("mail outbox: mark retry failed:", err)
+		}
+	}
+}
+
+func truncateMailError(message string) string {
+	message = strings.TrimSpace(message)
+	if len(message) > 500 {
+		return message[:500]
+	}
+	return message
+}
+
+func pruneMailOutbox(db *sql.DB) {
+	now := time.Now().UTC()
+	if _, err := db.Exec(`
+		DELETE FROM mail_outbox
+		WHERE status IN ($1, $2) AND created_at < $3
+	`, MailStatusSent, MailStatusFailed, now.Add(-mailOutboxRetention)); err != nil {
+		log.Println("mail outbox: prune failed:", err)
+	}
+	for template, ttl := range sensitiveMailTemplates {
+		if _, err := db.Exec(`
+			DELETE FROM mail_outbox
+			WHERE status = $1 AND template = $2 AND created_at < $3
+		`, MailStatusFailed, template, now.Add(-ttl)); err != nil {
+			log.Println("mail outbox: prune failed:", err)
+		}
+	}
+}
+
+func startMailOutboxWorker(db *sql.DB) {
+	go func() {
+		ticker := time.NewTicker(mailOutboxInterval)
+		defer ticker.Stop()
+		lastPrune := time.Time{}
+		for range ticker.C {
+			if !isLeaderInstance() {
+				continue
+			}
+			processMailOutbox(db)
+			// Often enough that failed reset mail is gone soon after its
+			// one-hour link would have expired.
+			if time.Since(lastPrune) > 10*time.Minute {
+				pruneMailOutbox(db)
+				lastPrune = time.Now()
+			}
+		}
+	}()
+}
+
+func sendPasswordResetEmail(db *sql.DB, to string, token string, baseURL string) error {
+	return enqueueMail(db, MailTemplatePasswordReset, to, map[string]interface{}{
+		"Link": strings.TrimRight(baseURL, "/") + "/#/reset?token=" + token,
+	}, "")
+}
+
+func sendVerificationEmail(db *sql.DB, to string, token string, baseURL string) error {
+	return enqueueMail(db, MailTemplateEmailVerification, to, map[string]interface{}{
+		"Link": strings.TrimRight(baseURL, "/") + "/#/verify-email?token=" + token,
+	}, "")
+}
+
+// sendSecurityAlertEmail mails a security alert to the account's verified
+// address. Accounts without one only get the in-app notification.
+func sendSecurityAlertEmail(db *sql.DB, accountID string, title string, message string, device string, ip string) {
+	var email, displayName string
+	err := db.QueryRow(`
+		SELECT email, display_name
+		FROM accounts
+		WHERE account_id = $1 AND email IS NOT NULL AND email_verified_at IS NOT NULL
+	`, accountID).Scan(&email, &displayName)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Println("security alert email: lookup failed:", err)
+		}
+		return
+	}
+	if err := enqueueMail(db, MailTemplateSecurityAlert, email, map[string]interface{}{
+		"DisplayName": displayName,
+		"Title":       title,
+		"Message":     message,
+		"Device":      device,
+		"IP":          ip,
+		"Time":        time.Now().UTC().Format("2006-01-02 15:04 MST"),
+		"Link":        configuredBaseURL() + "/#/home",
+	}, ""); err != nil {
+		log.Println("security alert email: enqueue failed:", err)
+	}
+}
+
+// enqueueSeasonSummaryEmails queues one summary per finalized player with a
+// verified address. The dedup key makes it safe to call more than once.
+func enqueueSeasonSummaryEmails(db *sql.DB, seasonID string) {
+	rows, err := db.Query(`
+		SELECT a.account_id, a.email, a.display_name, f.stars, COALESCE(f.final_rank, 0), COALESCE(f.tier, $2)
+		FROM season_final_rankings f
+		JOIN accounts a ON a.player_id = f.player_id
+		WHERE f.season_id = $1 AND a.email IS NOT NULL AND a.email_verified_at IS NOT NULL
+	`, seasonID, TierUnranked)
+	if err != nil {
+		log.Println("season summary email: query failed:", err)
+		return
+	}
+	type summary struct {
+		accountID   string
+		email       string
+		displayName string
+		stars       int64
+		rank        int
+		tier        string
+	}
+	var summaries []summary
+	for rows.Next() {
+		var s summary
+		if err := rows.Scan(&s.accountID, &s.email, &s.displayName, &s.stars, &s.rank, &s.tier); err != nil {
+			log.Println("season summary email: scan failed:", err)
+			rows.Close()
+			return
+		}
+		summaries = append(summaries, s)
+	}
+	rows.Close()
+
+	link := configuredBaseURL() + "/#/leaderboard"
+	for _, s := range summaries {
+		rank := s.rank
+		if s.tier == TierUnranked {
+			rank = 0
+		}
+		if err := enqueueMail(db, MailTemplateSeasonSummary, s.email, map[string]interface{}{
+			"DisplayName": s.displayName,
+			"SeasonID":    seasonID,
+			"Rank":        rank,
+			"Tier":        s.tier,
+			"Stars":       s.stars,
+			"Link":        link,
+		}, "season_summary:"+seasonID+":"+s.accountID); err != nil {
+			log.Println("season summary email: enqueue failed:", err)
+		}
+	}
+}
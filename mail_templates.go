@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// Each mail template lives in templates/mail as three files: <name>.subject.txt
+// and <name>.txt are text/template, <name>.html is html/template.
+//
+//go:embed templates/mail/*
+var mailTemplateFS embed.FS
+
+const (
+	MailTemplatePasswordReset     = "password_reset"
+	MailTemplateEmailVerification = "email_verification"
+	MailTemplateSeasonSummary     = "season_summary"
+	MailTemplateSecurityAlert     = "security_alert"
+)
+
+var mailTemplateNames = []string{
+	MailTemplatePasswordReset,
+	MailTemplateEmailVerification,
+	MailTemplateSeasonSummary,
+	MailTemplateSecurityAlert,
+}
+
+// sensitiveMailTemplates carry single-use links, mapped to how long the link
+// stays valid. Past that the mail is not sent and its row is not kept.
+var sensitiveMailTemplates = map[string]time.Duration{
+	MailTemplatePasswordReset:     passwordResetTTL,
+	MailTemplateEmailVerification: emailVerificationTTL,
+}
+
+type mailTemplate struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+var mailTemplates = mustLoadMailTemplates()
+
+func mustLoadMailTemplates() map[string]mailTemplate {
+	templates := make(map[string]mailTemplate, len(mailTemplateNames))
+	for _, name := range mailTemplateNames {
+		base := "templates/mail/" + name
+		templates[name] = mailTemplate{
+			subject: texttemplate.Must(texttemplate.ParseFS(mailTemplateFS, base+".subject.txt")),
+			text:    texttemplate.Must(texttemplate.ParseFS(mailTemplateFS, base+".txt")),
+			html:    htmltemplate.Must(htmltemplate.ParseFS(mailTemplateFS, base+".html")),
+		}
+	}
+	return templates
+}
+
+func renderMail(name string, to string, data interface{}) (MailMessage, error) {
+	tmpl, ok := mailTemplates[name]
+	if !ok {
+		return MailMessage{}, fmt.Errorf("unknown mail template %q", name)
+	}
+	var subject, text, html bytes.Buffer
+	if err := tmpl.subject.Execute(&subject, data); err != nil {
+		return MailMessage{}, err
+	}
+	if err := tmpl.text.Execute(&text, data); err != nil {
+		return MailMessage{}, err
+	}
+	if err := tmpl.html.Execute(&html, data); err != nil {
+		return MailMessage{}, err
+	}
+	return MailMessage{
+		To:       to,
+		Subject:  strings.Join(strings.Fields(subject.String()), " "),
+		TextBody: text.String(),
+		HTMLBody: html.String(),
+	}, nil
+}
@@ -124,30 +124,39 @@ type BurnCoinsResponse struct {
 }
 
 type SignupRequest struct {
-	Username    string `json:"username"`
-	Password    string `json:"password"`
-	DisplayName string `json:"displayName,omitempty"`
-	Email       string `json:"email,omitempty"`
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	DisplayName  string `json:"displayName,omitempty"`
+	Email        string `json:"email,omitempty"`
+	PowChallenge string `json:"powChallenge,omitempty"`
+	PowSolution  string `json:"powSolution,omitempty"`
 }
 
 type LoginRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	TOTPCode     string `json:"totpCode,omitempty"`
+	RecoveryCode string `json:"recoveryCode,omitempty"`
+	PowChallenge string `json:"powChallenge,omitempty"`
+	PowSolution  string `json:"powSolution,omitempty"`
 }
 
 type AuthResponse struct {
-	OK                 bool   `json:"ok"`
-	Error              string `json:"error,omitempty"`
-	Username           string `json:"username,omitempty"`
-	DisplayName        string `json:"displayName,omitempty"`
-	PlayerID           string `json:"playerId,omitempty"`
-	IsAdmin            bool   `json:"isAdmin,omitempty"`
-	IsModerator        bool   `json:"isModerator,omitempty"`
-	Role               string `json:"role,omitempty"`
-	MustChangePassword bool   `json:"mustChangePassword,omitempty"`
-	AccessToken        string `json:"accessToken,omitempty"`
-	RefreshToken       string `json:"refreshToken,omitempty"`
-	ExpiresIn          int64  `json:"expiresIn,omitempty"`
+	OK                 bool     `json:"ok"`
+	Error              string   `json:"error,omitempty"`
+	Username           string   `json:"username,omitempty"`
+	DisplayName        string   `json:"displayName,omitempty"`
+	PlayerID           string   `json:"playerId,omitempty"`
+	IsAdmin            bool     `json:"isAdmin,omitempty"`
+	IsModerator        bool     `json:"isModerator,omitempty"`
+	Role               string   `json:"role,omitempty"`
+	Permissions        []string `json:"permissions,omitempty"`
+	MustChangePassword bool     `json:"mustChangePassword,omitempty"`
+	TwoFactorEnabled   bool     `json:"twoFactorEnabled,omitempty"`
+	TwoFactorRequired  bool     `json:"twoFactorRequired,omitempty"`
+	AccessToken        string   `json:"accessToken,omitempty"`
+	RefreshToken       string   `json:"refreshToken,omitempty"`
+	ExpiresIn          int64    `json:"expiresIn,omitempty"`
 }
 
 type RefreshTokenRequest struct {
@@ -178,6 +187,162 @@ type LeaderboardEntry struct {
 	LastStarAcquiredAt string `json:"lastStarAcquiredAt,omitempty"`
 	IsBot              bool   `json:"isBot"`
 	BotProfile         string `json:"botProfile,omitempty"`
+	Tier               string `json:"tier,omitempty"`
+}
+
+type LeaderboardAroundMeResponse struct {
+	OK            bool               `json:"ok"`
+	Error         string             `json:"error,omitempty"`
+	SeasonID      string             `json:"seasonId,omitempty"`
+	Rank          int                `json:"rank,omitempty"`
+	Tier          string             `json:"tier,omitempty"`
+	RankedPlayers int                `json:"rankedPlayers"`
+	Results       []LeaderboardEntry `json:"results,omitempty"`
+}
+
+type LeaderboardTierSummary struct {
+	Name           string `json:"name"`
+	Label          string `json:"label"`
+	TopBasisPoints int    `json:"topBasisPoints"`
+	FromRank       int    `json:"fromRank,omitempty"`
+	ToRank         int    `json:"toRank,omitempty"`
+	Players        int    `json:"players"`
+	MinStars       int64  `json:"minStars,omitempty"`
+}
+
+type LeaderboardTiersResponse struct {
+	OK            bool                     `json:"ok"`
+	Error         string                   `json:"error,omitempty"`
+	SeasonID      string                   `json:"seasonId,omitempty"`
+	RankedPlayers int                      `json:"rankedPlayers"`
+	Tiers         []LeaderboardTierSummary `json:"tiers,omitempty"`
+	YourRank      int                      `json:"yourRank,omitempty"`
+	YourTier      string                   `json:"yourTier,omitempty"`
+}
+
+type LeaderboardHistoryEntry struct {
+	Rank         int    `json:"rank"`
+	PreviousRank *int   `json:"previousRank,omitempty"`
+	Stars        int64  `json:"stars"`
+	RecordedAt   string `json:"recordedAt"`
+}
+
+type LeaderboardHistoryResponse struct {
+	OK          bool                      `json:"ok"`
+	Error       string                    `json:"error,omitempty"`
+	PlayerID    string                    `json:"playerId,omitempty"`
+	SeasonID    string                    `json:"seasonId,omitempty"`
+	CurrentRank int                       `json:"currentRank,omitempty"`
+	History     []LeaderboardHistoryEntry `json:"history,omitempty"`
+}
+
+type FriendRequest struct {
+	Username  string `json:"username,omitempty"`
+	AccountID string `json:"accountId,omitempty"`
+	Accept    bool   `json:"accept,omitempty"`
+}
+
+type FriendEntry struct {
+	AccountID   string `json:"accountId"`
+	PlayerID    string `json:"playerId"`
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName"`
+	Stars       int64  `json:"stars"`
+	Since       string `json:"since"`
+}
+
+type FriendsResponse struct {
+	OK       bool          `json:"ok"`
+	Error    string        `json:"error,omitempty"`
+	Status   string        `json:"status,omitempty"`
+	Friends  []FriendEntry `json:"friends,omitempty"`
+	Incoming []FriendEntry `json:"incoming,omitempty"`
+	Outgoing []FriendEntry `json:"outgoing,omitempty"`
+}
+
+type TeamRequest struct {
+	TeamID      string `json:"teamId,omitempty"`
+	AccountID   string `json:"accountId,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Tag         string `json:"tag,omitempty"`
+	Description string `json:"description,omitempty"`
+	Message     string `json:"message,omitempty"`
+	Action      string `json:"action,omitempty"`
+	Accept      bool   `json:"accept,omitempty"`
+}
+
+type TeamSummary struct {
+	TeamID      string `json:"teamId"`
+	Name        string `json:"name"`
+	Tag         string `json:"tag"`
+	Description string `json:"description,omitempty"`
+	MaxMembers  int    `json:"maxMembers"`
+	MemberCount int    `json:"memberCount"`
+	Stars       int64  `json:"stars,omitempty"`
+	CreatedAt   string `json:"createdAt"`
+}
+
+type TeamMemberEntry struct {
+	AccountID   string `json:"accountId"`
+	PlayerID    string `json:"playerId"`
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName"`
+	Role        string `json:"role"`
+	Stars       int64  `json:"stars"`
+	JoinedAt    string `json:"joinedAt"`
+}
+
+type TeamJoinRequestEntry struct {
+	AccountID   string `json:"accountId"`
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName"`
+	Message     string `json:"message,omitempty"`
+	CreatedAt   string `json:"createdAt"`
+}
+
+type TeamLogEntry struct {
+	AccountID      string          `json:"accountId"`
+	Username       string          `json:"username,omitempty"`
+	Action         string          `json:"action"`
+	ActorAccountID string          `json:"actorAccountId,omitempty"`
+	Details        json.RawMessage `json:"details,omitempty"`
+	CreatedAt      string          `json:"createdAt"`
+}
+
+type TeamResponse struct {
+	OK       bool                   `json:"ok"`
+	Error    string                 `json:"error,omitempty"`
+	TeamID   string                 `json:"teamId,omitempty"`
+	Status   string                 `json:"status,omitempty"`
+	Role     string                 `json:"role,omitempty"`
+	Team     *TeamSummary           `json:"team,omitempty"`
+	Members  []TeamMemberEntry      `json:"members,omitempty"`
+	Requests []TeamJoinRequestEntry `json:"requests,omitempty"`
+	Log      []TeamLogEntry         `json:"log,omitempty"`
+}
+
+type TeamListResponse struct {
+	OK    bool          `json:"ok"`
+	Error string        `json:"error,omitempty"`
+	Teams []TeamSummary `json:"teams"`
+}
+
+type TeamLeaderboardEntry struct {
+	Rank        int    `json:"rank"`
+	TeamID      string `json:"teamId"`
+	Name        string `json:"name"`
+	Tag         string `json:"tag"`
+	MemberCount int    `json:"memberCount"`
+	Stars       int64  `json:"stars"`
+}
+
+type TeamLeaderboardResponse struct {
+	OK       bool                   `json:"ok"`
+	SeasonID string                 `json:"seasonId"`
+	Page     int                    `json:"page"`
+	PageSize int                    `json:"pageSize"`
+	Total    int                    `json:"total"`
+	Results  []TeamLeaderboardEntry `json:"results"`
 }
 
 type ProfileUpdateRequest struct {
@@ -191,16 +356,18 @@ type ProfileUpdateRequest struct {
 }
 
 type ProfileResponse struct {
-	OK          bool   `json:"ok"`
-	Error       string `json:"error,omitempty"`
-	Username    string `json:"username,omitempty"`
-	DisplayName string `json:"displayName,omitempty"`
-	Email       string `json:"email,omitempty"`
-	Bio         string `json:"bio,omitempty"`
-	Pronouns    string `json:"pronouns,omitempty"`
-	Location    string `json:"location,omitempty"`
-	Website     string `json:"website,omitempty"`
-	AvatarURL   string `json:"avatarUrl,omitempty"`
+	OK            bool   `json:"ok"`
+	Error         string `json:"error,omitempty"`
+	Username      string `json:"username,omitempty"`
+	DisplayName   string `json:"displayName,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"emailVerified"`
+	PendingEmail  string `json:"pendingEmail,omitempty"`
+	Bio           string `json:"bio,omitempty"`
+	Pronouns      string `json:"pronouns,omitempty"`
+	Location      string `json:"location,omitempty"`
+	Website       string `json:"website,omitempty"`
+	AvatarURL     string `json:"avatarUrl,omitempty"`
 }
 
 type PasswordResetRequest struct {
@@ -315,21 +482,38 @@ type AdminPlayerControlResponse struct {
 	LastGrantAt    time.Time `json:"lastGrantAt,omitempty"`
 }
 
+// AdminGlobalSettingsRequest carries setting values keyed by their stored
+// snake_case key. PUT must include every schema key; PATCH may send a subset.
 type AdminGlobalSettingsRequest struct {
-	ActiveDripIntervalSeconds *int  `json:"activeDripIntervalSeconds,omitempty"`
-	IdleDripIntervalSeconds   *int  `json:"idleDripIntervalSeconds,omitempty"`
-	ActiveDripAmount          *int  `json:"activeDripAmount,omitempty"`
-	IdleDripAmount            *int  `json:"idleDripAmount,omitempty"`
-	ActivityWindowSeconds     *int  `json:"activityWindowSeconds,omitempty"`
-	DripEnabled               *bool `json:"dripEnabled,omitempty"`
-	BotsEnabled               *bool `json:"botsEnabled,omitempty"`
-	BotMinStarIntervalSeconds *int  `json:"botMinStarIntervalSeconds,omitempty"`
+	Settings map[string]json.RawMessage `json:"settings"`
+	Reason   string                     `json:"reason"`
+}
+
+type AdminSettingsRollbackRequest struct {
+	Version int64  `json:"version"`
+	Reason  string `json:"reason"`
 }
 
 type AdminGlobalSettingsResponse struct {
-	OK       bool           `json:"ok"`
-	Error    string         `json:"error,omitempty"`
-	Settings GlobalSettings `json:"settings,omitempty"`
+	OK       bool                   `json:"ok"`
+	Error    string                 `json:"error,omitempty"`
+	ErrorKey string                 `json:"errorKey,omitempty"`
+	Settings GlobalSettings         `json:"settings,omitempty"`
+	Version  int64                  `json:"version,omitempty"`
+	Schema   []SettingSpec          `json:"schema,omitempty"`
+	Phase    string                 `json:"phase,omitempty"`
+	History  []GlobalSettingsChange `json:"history,omitempty"`
+}
+
+type GlobalSettingsChange struct {
+	Version    int64  `json:"version"`
+	Key        string `json:"key"`
+	OldValue   string `json:"oldValue,omitempty"`
+	NewValue   string `json:"newValue"`
+	ChangedBy  string `json:"changedBy,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	RollbackOf int64  `json:"rollbackOf,omitempty"`
+	CreatedAt  string `json:"createdAt"`
 }
 
 type AdminBotListItem struct {
@@ -349,14 +533,16 @@ type AdminBotListResponse struct {
 type AdminProfileActionRequest struct {
 	Username string `json:"username"`
 	Action   string `json:"action"`
+	Reason   string `json:"reason,omitempty"`
 }
 
 type AdminProfileActionResponse struct {
-	OK       bool   `json:"ok"`
-	Error    string `json:"error,omitempty"`
-	Username string `json:"username,omitempty"`
-	Role     string `json:"role,omitempty"`
-	Frozen   bool   `json:"frozen,omitempty"`
+	OK            bool                `json:"ok"`
+	Error         string              `json:"error,omitempty"`
+	Username      string              `json:"username,omitempty"`
+	Role          string              `json:"role,omitempty"`
+	Frozen        bool                `json:"frozen,omitempty"`
+	PendingAction *PendingAdminAction `json:"pendingAction,omitempty"`
 }
 
 type AdminBotCreateRequest struct {
@@ -378,12 +564,14 @@ type AdminBotCreateResponse struct {
 type AdminBotDeleteRequest struct {
 	PlayerID string `json:"playerId,omitempty"`
 	Username string `json:"username,omitempty"`
+	Reason   string `json:"reason,omitempty"`
 }
 
 type AdminBotDeleteResponse struct {
-	OK       bool   `json:"ok"`
-	Error    string `json:"error,omitempty"`
-	PlayerID string `json:"playerId,omitempty"`
+	OK            bool                `json:"ok"`
+	Error         string              `json:"error,omitempty"`
+	PlayerID      string              `json:"playerId,omitempty"`
+	PendingAction *PendingAdminAction `json:"pendingAction,omitempty"`
 }
 
 /* ======================
@@ -458,6 +646,7 @@ func main() {
 		if err := ensureActiveSeason(ctx, db); err != nil {
 			log.Fatal("Failed to ensure active season:", err)
 		}
+		sealLegacyTOTPSecrets(db)
 	} else {
 		log.Println("Startup lock held by another instance; skipping leader-only initialization")
 	}
@@ -476,19 +665,36 @@ func main() {
 		log.Println("Failed to load global settings:", err)
 	}
 	if CurrentPhase() == PhaseAlpha {
-		settings := GetGlobalSettings()
-		if settings.DripEnabled {
-			log.Println("WARN: passive drip enabled in settings; overriding to disabled for alpha")
-			if _, err := UpdateGlobalSettings(db, map[string]string{"drip_enabled": "false"}); err != nil {
-				log.Println("Failed to persist alpha drip override:", err)
-				settingsMu.Lock()
-				cachedSettings.DripEnabled = false
-				settingsMu.Unlock()
+		// LoadGlobalSettings already refuses a stored drip_enabled=true in
+		// alpha; persist the override so the stored row matches.
+		var storedDrip string
+		if err := db.QueryRow(`SELECT value FROM global_settings WHERE key = 'drip_enabled'`).Scan(&storedDrip); err == nil {
+			if enabled, err := parseBool(storedDrip); err != nil || enabled {
+				log.Println("WARN: passive drip enabled in settings; overriding to disabled for alpha")
+				if _, _, err := UpdateGlobalSettings(db, map[string]string{"drip_enabled": "false"}, "", "alpha phase requires passive drip disabled"); err != nil {
+					log.Println("Failed to persist alpha drip override:", err)
+				}
 			}
 		}
+		settingsMu.Lock()
+		cachedSettings.DripEnabled = false
+		settingsMu.Unlock()
 		log.Println("ECONOMY_CONFIG: passive_drip=DISABLED (alpha default)")
 	}
 
+	if err := startClusterFanout(db, dbURL); err != nil {
+		log.Println("Cluster fan-out unavailable; live updates stay local to this instance:", err)
+	}
+	startLeaderboardRefresher(db)
+	startSeasonControlsRefresher(db)
+	startGlobalSettingsRefresher(db)
+	startFeatureFlagRefresher(db)
+	startPermissionRefresher(db)
+	startTokenKeyringRefresher(db)
+	startPendingActionExpiry(db)
+	startMailOutboxWorker(db)
+	startAccountDeletionWorker(db)
+
 	if acquired {
 		startTickLoop(db)
 		startNotificationPruner(db)
@@ -531,6 +737,7 @@ func registerRoutes(mux *http.ServeMux, db *sql.DB) {
 	mux.HandleFunc("/player", playerHandler(db))
 	mux.HandleFunc("/seasons", seasonsHandler(db))
 	mux.HandleFunc("/events", eventsHandler(db))
+	mux.HandleFunc("/ws", liveSocketHandler(db))
 	mux.HandleFunc("/buy-star", buyStarHandler(db))
 	mux.HandleFunc("/buy-star/quote", buyStarQuoteHandler(db))
 	mux.HandleFunc("/buy-variant-star", buyVariantStarHandler(db))
@@ -541,8 +748,20 @@ func registerRoutes(mux *http.ServeMux, db *sql.DB) {
 	mux.HandleFunc("/auth/signup", signupHandler(db))
 	mux.HandleFunc("/auth/login", loginHandler(db))
 	mux.HandleFunc("/auth/logout", logoutHandler(db))
+	mux.HandleFunc("/auth/challenge", powChallengeHandler(db))
+	mux.HandleFunc("/auth/password-policy", passwordPolicyHandler())
 	mux.HandleFunc("/auth/me", meHandler(db))
+	mux.HandleFunc("/auth/sessions", accountSessionsHandler(db))
+	mux.HandleFunc("/auth/sessions/revoke", revokeSessionHandler(db))
+	mux.HandleFunc("/auth/api-tokens", apiTokensHandler(db))
+	mux.HandleFunc("/auth/api-tokens/revoke", revokeAPITokenHandler(db))
+	mux.HandleFunc("/auth/2fa", twoFactorStatusHandler(db))
+	mux.HandleFunc("/auth/2fa/enroll", twoFactorEnrollHandler(db))
+	mux.HandleFunc("/auth/2fa/confirm", twoFactorConfirmHandler(db))
+	mux.HandleFunc("/auth/2fa/disable", twoFactorDisableHandler(db))
 	mux.HandleFunc("/auth/refresh", refreshTokenHandler(db))
+	mux.HandleFunc("/auth/verify-email", verifyEmailHandler(db))
+	mux.HandleFunc("/auth/resend-verification", resendVerificationHandler(db))
 	mux.HandleFunc("/auth/request-reset", requestPasswordResetHandler(db))
 	mux.HandleFunc("/auth/reset-password", resetPasswordHandler(db))
 	mux.HandleFunc("/auth/bootstrap-password", bootstrapPasswordHandler(db))
@@ -554,12 +773,17 @@ func registerRoutes(mux *http.ServeMux, db *sql.DB) {
 	mux.HandleFunc("/notifications/stream", notificationsStreamHandler(db))
 	mux.HandleFunc("/activity", activityHandler(db))
 	mux.HandleFunc("/profile", profileHandler(db))
+	mux.HandleFunc("/account/export", accountExportHandler(db))
+	mux.HandleFunc("/account/delete", accountDeleteHandler(db))
+	mux.HandleFunc("/account/delete/cancel", accountDeleteCancelHandler(db))
 	mux.HandleFunc("/telemetry", telemetryHandler(db))
 	mux.HandleFunc("/admin/telemetry", adminTelemetryHandler(db))
 	mux.HandleFunc("/admin/abuse-events", adminAbuseEventsHandler(db))
+	mux.HandleFunc("/admin/account-unlock", adminAccountUnlockHandler(db))
 	mux.HandleFunc("/admin/overview", adminOverviewHandler(db))
 	mux.HandleFunc("/admin/anti-cheat", adminAntiCheatHandler(db))
 	mux.HandleFunc("/admin/economy", adminEconomyHandler(db))
+	mux.HandleFunc("/admin/economy/controls", adminEconomyControlsHandler(db))
 	mux.HandleFunc("/admin/player-search", adminPlayerSearchHandler(db))
 	mux.HandleFunc("/admin/audit-log", adminAuditLogHandler(db))
 	mux.HandleFunc("/admin/set-key", adminKeySetHandler(db))
@@ -568,13 +792,39 @@ func registerRoutes(mux *http.ServeMux, db *sql.DB) {
 	mux.HandleFunc("/admin/notifications", adminNotificationsHandler(db))
 	mux.HandleFunc("/admin/player-controls", adminPlayerControlsHandler(db))
 	mux.HandleFunc("/admin/settings", adminSettingsHandler(db))
+	mux.HandleFunc("/admin/feature-flags", adminFeatureFlagsHandler(db))
+	mux.HandleFunc("/admin/permissions", adminPermissionsHandler(db))
+	mux.HandleFunc("/admin/approvals", adminApprovalsHandler(db))
+	mux.HandleFunc("/admin/settings/history", adminSettingsHistoryHandler(db))
+	mux.HandleFunc("/admin/settings/rollback", adminSettingsRollbackHandler(db))
+	mux.HandleFunc("/admin/token-keys", adminTokenKeysHandler(db))
+	mux.HandleFunc("/admin/token-keys/rotate", adminTokenKeyRotateHandler(db))
+	mux.HandleFunc("/admin/token-keys/retire", adminTokenKeyRetireHandler(db))
 	mux.HandleFunc("/admin/star-purchases", adminStarPurchaseLogHandler(db))
+	mux.HandleFunc("/admin/leaderboard/export", adminLeaderboardExportHandler(db))
 	mux.HandleFunc("/admin/bots", adminBotListHandler(db))
 	mux.HandleFunc("/admin/bots/create", adminBotCreateHandler(db))
 	mux.HandleFunc("/admin/bots/delete", adminBotDeleteHandler(db))
 	mux.HandleFunc("/admin/profile-actions", adminProfileActionHandler(db))
 	mux.HandleFunc("/moderator/profile", moderatorProfileHandler(db))
 	mux.HandleFunc("/leaderboard", leaderboardHandler(db))
+	mux.HandleFunc("/leaderboard/history", leaderboardHistoryHandler(db))
+	mux.HandleFunc("/leaderboard/around-me", leaderboardAroundMeHandler(db))
+	mux.HandleFunc("/leaderboard/tiers", leaderboardTiersHandler(db))
+	mux.HandleFunc("/leaderboard/export", leaderboardExportHandler(db))
+	mux.HandleFunc("/friends", friendsHandler(db))
+	mux.HandleFunc("/friends/request", friendRequestHandler(db))
+	mux.HandleFunc("/friends/respond", friendRespondHandler(db))
+	mux.HandleFunc("/friends/remove", friendRemoveHandler(db))
+	mux.HandleFunc("/teams", teamsHandler(db))
+	mux.HandleFunc("/teams/create", teamCreateHandler(db))
+	mux.HandleFunc("/teams/detail", teamDetailHandler(db))
+	mux.HandleFunc("/teams/join", teamJoinHandler(db))
+	mux.HandleFunc("/teams/requests/respond", teamRequestRespondHandler(db))
+	mux.HandleFunc("/teams/leave", teamLeaveHandler(db))
+	mux.HandleFunc("/teams/member", teamMemberHandler(db))
+	mux.HandleFunc("/teams/log", teamLogHandler(db))
+	mux.HandleFunc("/teams/leaderboard", teamLeaderboardHandler(db))
 }
 
 /* ======================
@@ -583,7 +833,7 @@ func registerRoutes(mux *http.ServeMux, db *sql.DB) {
 
 func runPassiveDrip(db *sql.DB) {
 	now := time.Now().UTC()
-	if isSeasonEnded(now) {
+	if isSeasonEnded(now) || economyFaucetBlock() != "" || !featureFlagAvailable(FlagFaucets) {
 		return
 	}
 
@@ -642,7 +892,7 @@ func runPassiveDrip(db *sql.DB) {
 		if err := rows.Scan(&playerID, &lastActive, &lastGrant, &dripMultiplier, &dripPaused); err != nil {
 			continue
 		}
-		if dripPaused {
+		if dripPaused || !featureFlagEnabledFor(FlagFaucets, playerID) {
 			continue
 		}
 
@@ -45,7 +45,7 @@ func updateMarketPressure(db *sql.DB, now time.Time) {
 	maxDelta := maxDeltaPerHour / 60
 	current := economy.MarketPressure()
 	updated := economy.UpdateMarketPressure(desired, maxDelta)
-	if featureFlags.Telemetry {
+	if currentFeatureFlags().Telemetry {
 		emitServerTelemetry(db, nil, "", "market_pressure_tick", map[string]interface{}{
 			"seasonId":        seasonID,
 			"last24h":         last24h,
@@ -23,6 +23,9 @@ const (
 	NotificationCategoryAbuse        = "abuse"
 	NotificationCategorySystem       = "system"
 	NotificationCategoryAdmin        = "admin"
+	NotificationCategoryLeaderboard  = "leaderboard"
+	NotificationCategoryFriends      = "friends"
+	NotificationCategorySecurity     = "security"
 )
 
 const (
@@ -38,6 +41,19 @@ var notificationCategoryList = []string{
 	NotificationCategoryAbuse,
 	NotificationCategorySystem,
 	NotificationCategoryAdmin,
+	NotificationCategoryLeaderboard,
+	NotificationCategoryFriends,
+	NotificationCategorySecurity,
+}
+
+// optInNotificationCategories stay off until the player enables them.
+var optInNotificationCategories = map[string]bool{
+	NotificationCategoryLeaderboard: true,
+	NotificationCategoryFriends:     true,
+}
+
+func notificationCategoryDefaultEnabled(category string) bool {
+	return !optInNotificationCategories[category]
 }
 
 const notificationAccessSQL = `
@@ -250,7 +266,8 @@ func insertNotification(db *sql.DB, input NotificationInput) error {
 		legacyRole = "user"
 	}
 
-	_, err := db.Exec(`
+	var notificationID int64
+	err := db.QueryRow(`
 		INSERT INTO notifications (
 			target_role,
 			account_id,
@@ -270,6 +287,7 @@ func insertNotification(db *sql.DB, input NotificationInput) error {
 			dedupe_key
 		)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NOW(), $13, $14, $15)
+		RETURNING id
 	`,
 		legacyRole,
 		nullableString(strings.TrimSpace(input.RecipientAccountID)),
@@ -286,12 +304,13 @@ func insertNotification(db *sql.DB, input NotificationInput) error {
 		expires,
 		ackRequired,
 		nullableString(strings.TrimSpace(input.DedupKey)),
-	)
+	).Scan(&notificationID)
 	if err != nil {
 		return err
 	}
+	publishNotificationCreated(notificationID, role, strings.TrimSpace(input.RecipientAccountID))
 
-	if featureFlags.Telemetry {
+	if currentFeatureFlags().Telemetry {
 		accountID := strings.TrimSpace(input.RecipientAccountID)
 		var accountPtr *string
 		if accountID != "" {
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Passwords chosen at signup, reset and bootstrap must pass the same policy.
+// Each failed rule has its own error code so clients can say what to fix:
+//
+//	PASSWORD_TOO_SHORT, PASSWORD_TOO_LONG   length outside the configured range
+//	PASSWORD_TOO_WEAK                       estimated entropy below the minimum
+//	PASSWORD_CONTAINS_USERNAME              the username appears in the password
+//	PASSWORD_CONTAINS_DISPLAY_NAME          so does the display name
+//	PASSWORD_BREACHED                       found in the breached-password list
+//
+// The breached list is checked offline, k-anonymity style: passwords are
+// SHA-1 hashed and only the bucket for the hash's first five hex characters
+// is searched. A small list of very common passwords is built in;
+// PASSWORD_BREACH_FILE adds either one file of full hashes ("HASH" or
+// "HASH:COUNT" per line) or a directory of range files named "<PREFIX>.txt"
+// holding "SUFFIX:COUNT" lines, as produced by the Pwned Passwords downloader.
+const (
+	breachPrefixLen = 5
+	// Names shorter than this are too likely to appear by chance.
+	passwordNameMinLen = 3
+)
+
+//go:embed data/breached-passwords.sha1.txt
+var bundledBreachedPasswords string
+
+type PasswordPolicy struct {
+	MinLength      int  `json:"minLength"`
+	MaxLength      int  `json:"maxLength"`
+	MinEntropyBits int  `json:"minEntropyBits"`
+	BreachCheck    bool `json:"breachCheck"`
+}
+
+type PasswordPolicyResponse struct {
+	OK     bool           `json:"ok"`
+	Policy PasswordPolicy `json:"policy"`
+}
+
+func currentPasswordPolicy() PasswordPolicy {
+	policy := PasswordPolicy{
+		MinLength:      parseEnvInt("PASSWORD_MIN_LENGTH", 8),
+		MaxLength:      parseEnvInt("PASSWORD_MAX_LENGTH", 128),
+		MinEntropyBits: parseEnvInt("PASSWORD_MIN_ENTROPY_BITS", 40),
+	}
+	if policy.MinLength < 1 {
+		policy.MinLength = 1
+	}
+	if policy.MaxLength < policy.MinLength {
+		policy.MaxLength = policy.MinLength
+	}
+	raw := strings.ToLower(strings.TrimSpace(os.Getenv("PASSWORD_BREACH_CHECK")))
+	policy.BreachCheck = raw != "false" && raw != "0" && raw != "no"
+	return policy
+}
+
+// estimatePasswordEntropy gives a rough strength estimate in bits. Each
+// character is worth log2 of the pool its character classes span, except
+// that repeats and steps of a run ("aaa", "abc", "321") are worth one bit.
+func estimatePasswordEntropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r < utf8.RuneSelf && unicode.IsLower(r):
+			lower = true
+		case r < utf8.RuneSelf && unicode.IsUpper(r):
+			upper = true
+		case r < utf8.RuneSelf && unicode.IsDigit(r):
+			digit = true
+		case r < utf8.RuneSelf:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	pool := 0
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	if other {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+	perChar := math.Log2(float64(pool))
+
+	bits := 0.0
+	prev := rune(-1)
+	for _, r := range password {
+		delta := r - prev
+		if prev >= 0 && (delta == 0 || delta == 1 || delta == -1) {
+			bits++
+		} else {
+			bits += perChar
+		}
+		prev = r
+	}
+	return bits
+}
+
+func passwordContainsName(password string, name string) bool {
+	name = strings.ToLower(strings.Join(strings.Fields(name), ""))
+	if utf8.RuneCountInString(name) < passwordNameMinLen {
+		return false
+	}
+	folded := strings.ToLower(password)
+	return strings.Contains(folded, name) || strings.Contains(strings.Join(strings.Fields(folded), ""), name)
+}
+
+// checkPasswordPolicy returns nil or an error whose message is one of the
+// PASSWORD_* codes above.
+func checkPasswordPolicy(password string, username string, displayName string) error {
+	policy := currentPasswordPolicy()
+	length := utf8.RuneCountInString(password)
+	if length < policy.MinLength {
+		return errors.New("PASSWORD_TOO_SHORT")
+	}
+	if length > policy.MaxLength {
+		return errors.New("PASSWORD_TOO_LONG")
+	}
+	if passwordContainsName(password, username) {
+		return errors.New("PASSWORD_CONTAINS_USERNAME")
+	}
+	if passwordContainsName(password, displayName) {
+		return errors.New("PASSWORD_CONTAINS_DISPLAY_NAME")
+	}
+	if estimatePasswordEntropy(password) < float64(policy.MinEntropyBits) {
+		return errors.New("PASSWORD_TOO_WEAK")
+	}
+	if policy.BreachCheck && passwordBreached(password) {
+		return errors.New("PASSWORD_BREACHED")
+	}
+	return nil
+}
+
+func isPasswordPolicyError(code string) bool {
+	switch code {
+	case "PASSWORD_TOO_SHORT", "PASSWORD_TOO_LONG", "PASSWORD_TOO_WEAK",
+		"PASSWORD_CONTAINS_USERNAME", "PASSWORD_CONTAINS_DISPLAY_NAME", "PASSWORD_BREACHED":
+		return true
+	}
+	return false
+}
+
+// breachIndex maps a five-character SHA-1 prefix to the set of suffixes seen
+// with it. rangeDir, when set, is consulted for prefixes not held in memory.
+type breachIndex struct {
+	buckets  map[string]map[string]struct{}
+	rangeDir string
+}
+
+var (
+	breachOnce       sync.Once
+	breachIndexValue *breachIndex
+)
+
+func (idx *breachIndex) add(line string) {
+	line = strings.TrimSpace(line)
+	if i := strings.IndexByte(line, ':'); i >= 0 {
+		line = line[:i]
+	}
+	if len(line) != sha1.Size*2 {
+		return
+	}
+	line = strings.ToUpper(line)
+	prefix, suffix := line[:breachPrefixLen], line[breachPrefixLen:]
+	bucket := idx.buckets[prefix]
+	if bucket == nil {
+		bucket = make(map[string]struct{})
+		idx.buckets[prefix] = bucket
+	}
+	bucket[suffix] = struct{}{}
+}
+
+func (idx *breachIndex) load(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		idx.add(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+func loadBreachIndex() *breachIndex {
+	idx := &breachIndex{buckets: make(map[string]map[string]struct{})}
+	_ = idx.load(strings.NewReader(bundledBreachedPasswords))
+
+	path := strings.TrimSpace(os.Getenv("PASSWORD_BREACH_FILE"))
+	if path == "" {
+		return idx
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Println("password policy: breach list unavailable:", err)
+		return idx
+	}
+	if info.IsDir() {
+		idx.rangeDir = path
+		return idx
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		log.Println("password policy: breach list unavailable:", err)
+		return idx
+	}
+	defer file.Close()
+	if err := idx.load(file); err != nil {
+		log.Println("password policy: breach list read failed:", err)
+	}
+	return idx
+}
+
+// inRangeFile looks for suffix in the range file for prefix. Only that one
+// file is read, never the whole directory.
+func (idx *breachIndex) inRangeFile(prefix string, suffix string) bool {
+	file, err := os.Open(filepath.Join(idx.rangeDir, prefix+".txt"))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("password policy: range file unavailable:", err)
+		}
+		return false
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			line = line[:i]
+		}
+		if strings.EqualFold(line, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func passwordBreached(password string) bool {
+	breachOnce.Do(func() {
+		breachIndexValue = loadBreachIndex()
+	})
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:breachPrefixLen], hash[breachPrefixLen:]
+	if _, ok := breachIndexValue.buckets[prefix][suffix]; ok {
+		return true
+	}
+	if breachIndexValue.rangeDir != "" {
+		return breachIndexValue.inRangeFile(prefix, suffix)
+	}
+	return false
+}
+
+func passwordPolicyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		json.NewEncoder(w).Encode(PasswordPolicyResponse{OK: true, Policy: currentPasswordPolicy()})
+	}
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Admin endpoints check a named permission instead of a role. Roles carry a
+// set of permissions (role_permissions) and individual accounts can be granted
+// extras (account_permissions). A permission's role defaults are written the
+// first time it appears in the permissions catalog, so later revocations stick
+// across restarts.
+const (
+	PermViewOverview       = "view_overview"
+	PermViewTelemetry      = "view_telemetry"
+	PermViewEconomy        = "view_economy"
+	PermManageEconomy      = "manage_economy"
+	PermViewAbuse          = "view_abuse"
+	PermViewPlayers        = "view_players"
+	PermManagePlayers      = "manage_players"
+	PermEditProfiles       = "edit_profiles"
+	PermFreezeAccounts     = "freeze_accounts"
+	PermDeleteAccounts     = "delete_accounts"
+	PermManageBots         = "manage_bots"
+	PermSendNotifications  = "send_notifications"
+	PermViewSettings       = "view_settings"
+	PermEditSettings       = "edit_settings"
+	PermManageFeatureFlags = "manage_feature_flags"
+	PermManageRoles        = "manage_roles"
+	PermManagePermissions  = "manage_permissions"
+	PermViewAuditLog       = "view_audit_log"
+	PermExportData         = "export_data"
+	PermApproveActions     = "approve_actions"
+	PermManageTokenKeys    = "manage_token_keys"
+
+	permissionRefreshInterval = 5 * time.Second
+)
+
+type PermissionDefinition struct {
+	Key          string   `json:"key"`
+	Description  string   `json:"description"`
+	DefaultRoles []string `json:"defaultRoles"`
+}
+
+var permissionCatalog = []PermissionDefinition{
+	{Key: PermViewOverview, Description: "View the admin overview", DefaultRoles: []string{"admin"}},
+	{Key: PermViewTelemetry, Description: "View telemetry rollups", DefaultRoles: []string{"admin"}},
+	{Key: PermViewEconomy, Description: "View economy state and the star purchase log", DefaultRoles: []string{"admin"}},
+	{Key: PermManageEconomy, Description: "Pause purchases, scale emission and freeze seasons", DefaultRoles: []string{"admin"}},
+	{Key: PermViewAbuse, Description: "View abuse events and anti-cheat signals", DefaultRoles: []string{"admin"}},
+	{Key: PermViewPlayers, Description: "Search players and view profiles", DefaultRoles: []string{"admin", "moderator"}},
+	{Key: PermManagePlayers, Description: "Apply player controls", DefaultRoles: []string{"admin"}},
+	{Key: PermEditProfiles, Description: "Edit player profile fields", DefaultRoles: []string{"admin", "moderator"}},
+	{Key: PermFreezeAccounts, Description: "Freeze and unfreeze accounts", DefaultRoles: []string{"admin"}},
+	{Key: PermDeleteAccounts, Description: "Delete accounts", DefaultRoles: []string{"admin"}},
+	{Key: PermManageBots, Description: "Create and delete bots", DefaultRoles: []string{"admin"}},
+	{Key: PermSendNotifications, Description: "Send admin notifications", DefaultRoles: []string{"admin"}},
+	{Key: PermViewSettings, Description: "View global settings, their history and feature flags", DefaultRoles: []string{"admin"}},
+	{Key: PermEditSettings, Description: "Edit and roll back global settings", DefaultRoles: []string{"admin"}},
+	{Key: PermManageFeatureFlags, Description: "Change feature flags", DefaultRoles: []string{"admin"}},
+	{Key: PermManageRoles, Description: "Change account roles", DefaultRoles: []string{"admin"}},
+	{Key: PermManagePermissions, Description: "Grant and revoke permissions", DefaultRoles: []string{"admin"}},
+	{Key: PermViewAuditLog, Description: "View the admin audit log", DefaultRoles: []string{"admin"}},
+	{Key: PermExportData, Description: "Export leaderboards with private columns", DefaultRoles: []string{"admin"}},
+	{Key: PermApproveActions, Description: "Review queued admin actions; approving also needs the action's own permission", DefaultRoles: []string{"admin"}},
+	{Key: PermManageTokenKeys, Description: "Rotate and retire access token signing keys", DefaultRoles: []string{"admin"}},
+}
+
+var permissionRoles = []string{"admin", "moderator", "user"}
+
+var (
+	rolePermissionsMu    sync.RWMutex
+	rolePermissionsCache = map[string]map[string]bool{}
+)
+
+func isKnownPermission(permission string) bool {
+	for _, def := range permissionCatalog {
+		if def.Key == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func isPermissionRole(role string) bool {
+	for _, known := range permissionRoles {
+		if known == role {
+			return true
+		}
+	}
+	return false
+}
+
+func seedPermissions(db *sql.DB) error {
+	for _, def := range permissionCatalog {
+		var inserted bool
+		err := db.QueryRow(`
+			INSERT INTO permissions (permission, description, created_at)
+			VALUES ($1, $2, NOW())
+			ON CONFLICT (permission) DO NOTHING
+			RETURNING TRUE
+		`, def.Key, def.Description).Scan(&inserted)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, role := range def.DefaultRoles {
+			if _, err := db.Exec(`
+				INSERT INTO role_permissions (role, permission, granted_at)
+				VALUES ($1, $2, NOW())
+				ON CONFLICT (role, permission) DO NOTHING
+			`, role, def.Key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func loadRolePermissions(db *sql.DB) error {
+	rows, err := db.Query(`SELECT role, permission FROM role_permissions`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cache := map[string]map[string]bool{}
+	for rows.Next() {
+		var role, permission string
+		if err := rows.Scan(&role, &permission); err != nil {
+			continue
+		}
+		if cache[role] == nil {
+			cache[role] = map[string]bool{}
+		}
+		cache[role][permission] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rolePermissionsMu.Lock()
+	rolePermissionsCache = cache
+	rolePermissionsMu.Unlock()
+	return nil
+}
+
+func startPermissionRefresher(db *sql.DB) {
+	if err := seedPermissions(db); err != nil {
+		log.Println("permission seed failed:", err)
+	}
+	if err := loadRolePermissions(db); err != nil {
+		log.Println("permission load failed:", err)
+	}
+	go func() {
+		ticker := time.NewTicker(permissionRefreshInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := loadRolePermissions(db); err != nil {
+				log.Println("permission refresh failed:", err)
+			}
+		}
+	}()
+}
+
+func roleHasPermission(role string, permission string) bool {
+	rolePermissionsMu.RLock()
+	defer rolePermissionsMu.RUnlock()
+	return rolePermissionsCache[role][permission]
+}
+
+func accountHasPermission(db *sql.DB, account *Account, permission string) bool {
+	if account == nil {
+		return false
+	}
+	if roleHasPermission(account.Role, permission) {
+		return true
+	}
+	var granted bool
+	if err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM account_permissions
+			WHERE account_id = $1 AND permission = $2
+		)
+	`, account.AccountID, permission).Scan(&granted); err != nil {
+		return false
+	}
+	return granted
+}
+
+// accountPermissions lists everything an account can do, from its role and
+// its own grants.
+func accountPermissions(db *sql.DB, account *Account) []string {
+	if account == nil {
+		return nil
+	}
+	set := map[string]bool{}
+	rolePermissionsMu.RLock()
+	for permission := range rolePermissionsCache[account.Role] {
+		set[permission] = true
+	}
+	rolePermissionsMu.RUnlock()
+	rows, err := db.Query(`SELECT permission FROM account_permissions WHERE account_id = $1`, account.AccountID)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var permission string
+			if err := rows.Scan(&permission); err == nil {
+				set[permission] = true
+			}
+		}
+	}
+	permissions := make([]string, 0, len(set))
+	for permission := range set {
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+	return permissions
+}
+
+func requirePermission(db *sql.DB, w http.ResponseWriter, r *http.Request, permission string) (*Account, bool) {
+	account, _, err := getSessionAccount(db, r)
+	if err != nil || account == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil, false
+	}
+	if rejectAPIToken(w, account) {
+		return nil, false
+	}
+	if account.MustChangePassword {
+		w.WriteHeader(http.StatusForbidden)
+		return nil, false
+	}
+	if !accountHasPermission(db, account, permission) {
+		w.WriteHeader(http.StatusForbidden)
+		return nil, false
+	}
+	if adminTwoFactorRequired() && !account.TwoFactorEnabled {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(SimpleResponse{OK: false, Error: "TWO_FACTOR_REQUIRED"})
+		return nil, false
+	}
+	return account, true
+}
+
+type AccountPermissionGrant struct {
+	AccountID  string    `json:"accountId"`
+	Username   string    `json:"username"`
+	Permission string    `json:"permission"`
+	GrantedBy  string    `json:"grantedBy,omitempty"`
+	GrantedAt  time.Time `json:"grantedAt"`
+}
+
+type AdminPermissionsRequest struct {
+	Action     string `json:"action"`
+	Permission string `json:"permission"`
+	Role       string `json:"role,omitempty"`
+	Username   string `json:"username,omitempty"`
+	Reason     string `json:"reason"`
+}
+
+type AdminPermissionsResponse struct {
+	OK          bool                     `json:"ok"`
+	Error       string                   `json:"error,omitempty"`
+	Permissions []PermissionDefinition   `json:"permissions,omitempty"`
+	Roles       map[string][]string      `json:"roles,omitempty"`
+	Accounts    []AccountPermissionGrant `json:"accounts,omitempty"`
+}
+
+func listAccountPermissionGrants(db *sql.DB) ([]AccountPermissionGrant, error) {
+	rows, err := db.Query(`
+		SELECT ap.account_id, COALESCE(a.username, ''), ap.permission, COALESCE(ap.granted_by, ''), ap.granted_at
+		FROM account_permissions ap
+		LEFT JOIN accounts a ON a.account_id = ap.account_id
+		ORDER BY a.username ASC, ap.permission ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	grants := []AccountPermissionGrant{}
+	for rows.Next() {
+		var grant AccountPermissionGrant
+		if err := rows.Scan(&grant.AccountID, &grant.Username, &grant.Permission, &grant.GrantedBy, &grant.GrantedAt); err != nil {
+			continue
+		}
+		grants = append(grants, grant)
+	}
+	return grants, rows.Err()
+}
+
+func adminPermissionsSnapshot(db *sql.DB) (AdminPermissionsResponse, error) {
+	roles := map[string][]string{}
+	rolePermissionsMu.RLock()
+	for _, role := range permissionRoles {
+		permissions := []string{}
+		for permission := range rolePermissionsCache[role] {
+			permissions = append(permissions, permission)
+		}
+		sort.Strings(permissions)
+		roles[role] = permissions
+	}
+	rolePermissionsMu.RUnlock()
+	grants, err := listAccountPermissionGrants(db)
+	if err != nil {
+		return AdminPermissionsResponse{}, err
+	}
+	return AdminPermissionsResponse{
+		OK:          true,
+		Permissions: permissionCatalog,
+		Roles:       roles,
+		Accounts:    grants,
+	}, nil
+}
+
+func adminPermissionsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		admin, ok := requirePermission(db, w, r, PermManagePermissions)
+		if !ok {
+			return
+		}
+		if r.Method == http.MethodGet {
+			resp, err := adminPermissionsSnapshot(db)
+			if err != nil {
+				json.NewEncoder(w).Encode(AdminPermissionsResponse{OK: false, Error: "INTERNAL_ERROR"})
+				return
+			}
+			json.NewEncoder(w).Encode(resp)
+			return
+		}
+
+		var req AdminPermissionsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			json.NewEncoder(w).Encode(AdminPermissionsResponse{OK: false, Error: "INVALID_REQUEST"})
+			return
+		}
+		action := strings.ToLower(strings.TrimSpace(req.Action))
+		if action != "grant" && action != "revoke" {
+			json.NewEncoder(w).Encode(AdminPermissionsResponse{OK: false, Error: "INVALID_ACTION"})
+			return
+		}
+		permission := strings.ToLower(strings.TrimSpace(req.Permission))
+		if !isKnownPermission(permission) {
+			json.NewEncoder(w).Encode(AdminPermissionsResponse{OK: false, Error: "UNKNOWN_PERMISSION"})
+			return
+		}
+		reason := strings.TrimSpace(req.Reason)
+		if reason == "" {
+			json.NewEncoder(w).Encode(AdminPermissionsResponse{OK: false, Error: "REASON_REQUIRED"})
+			return
+		}
+		role := strings.ToLower(strings.TrimSpace(req.Role))
+		username := strings.ToLower(strings.TrimSpace(req.Username))
+		if (role == "") == (username == "") {
+			json.NewEncoder(w).Encode(AdminPermissionsResponse{OK: false, Error: "ROLE_OR_USERNAME_REQUIRED"})
+			return
+		}
+
+		var err error
+		scopeType := "role"
+		scopeID := role
+		if role != "" {
+			if !isPermissionRole(role) {
+				json.NewEncoder(w).Encode(AdminPermissionsResponse{OK: false, Error: "INVALID_ROLE"})
+				return
+			}
+			// The admin role always keeps the ability to hand permissions back out.
+			if action == "revoke" && role == "admin" && permission == PermManagePermissions {
+				json.NewEncoder(w).Encode(AdminPermissionsResponse{OK: false, Error: "LOCKOUT_PREVENTED"})
+				return
+			}
+			if action == "grant" {
+				_, err = db.Exec(`
+					INSERT INTO role_permissions (role, permission, granted_by, granted_at)
+					VALUES ($1, $2, $3, NOW())
+					ON CONFLICT (role, permission) DO NOTHING
+				`, role, permission, admin.AccountID)
+			} else {
+				_, err = db.Exec(`DELETE FROM role_permissions WHERE role = $1 AND permission = $2`, role, permission)
+			}
+		} else {
+			var accountID string
+			if err := db.QueryRow(`SELECT account_id FROM accounts WHERE username = $1`, username).Scan(&accountID); err != nil {
+				json.NewEncoder(w).Encode(AdminPermissionsResponse{OK: false, Error: "NOT_FOUND"})
+				return
+			}
+			scopeType = "account"
+			scopeID = accountID
+			if action == "grant" {
+				_, err = db.Exec(`
+					INSERT INTO account_permissions (account_id, permission, granted_by, granted_at)
+					VALUES ($1, $2, $3, NOW())
+					ON CONFLICT (account_id, permission) DO NOTHING
+				`, accountID, permission, admin.AccountID)
+			} else {
+				_, err = db.Exec(`DELETE FROM account_permissions WHERE account_id = $1 AND permission = $2`, accountID, permission)
+			}
+		}
+		if err != nil {
+			json.NewEncoder(w).Encode(AdminPermissionsResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if err := loadRolePermissions(db); err != nil {
+			log.Println("permission reload failed:", err)
+		}
+
+		details := map[string]interface{}{
+			"permission": permission,
+		}
+		if username != "" {
+			details["username"] = username
+		}
+		_ = logAdminAction(db, admin.AccountID, "permission_"+action, scopeType, scopeID, reason, details)
+
+		resp, err := adminPermissionsSnapshot(db)
+		if err != nil {
+			json.NewEncoder(w).Encode(AdminPermissionsResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -26,6 +26,19 @@ func CurrentPhase() Phase {
 	return PhaseAlpha
 }
 
+// parsePhaseValue parses an explicit phase name.
+func parsePhaseValue(value string) (Phase, bool) {
+	switch Phase(strings.ToLower(strings.TrimSpace(value))) {
+	case PhaseAlpha:
+		return PhaseAlpha, true
+	case PhaseBeta:
+		return PhaseBeta, true
+	case PhaseRelease:
+		return PhaseRelease, true
+	}
+	return "", false
+}
+
 func parsePhaseFromEnv(key string) (Phase, bool) {
 	value := strings.ToLower(strings.TrimSpace(os.Getenv(key)))
 	switch value {
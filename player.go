@@ -193,7 +193,7 @@ func RecordPlayerIP(db *sql.DB, playerID string, ip string) (bool, error) {
 }
 
 func ApplyIPDampeningDelay(db *sql.DB, playerID string, ip string) error {
-	if !featureFlags.IPThrottling {
+	if !featureFlagEnabledFor(FlagIPThrottling, playerID) {
 		return nil
 	}
 	if ip == "" {
@@ -228,7 +228,7 @@ func ApplyIPDampeningDelay(db *sql.DB, playerID string, ip string) error {
 }
 
 func IsPlayerThrottledByIP(db *sql.DB, playerID string) (bool, error) {
-	if !featureFlags.IPThrottling {
+	if !featureFlagEnabledFor(FlagIPThrottling, playerID) {
 		return false, nil
 	}
 	ip, err := latestIPForPlayer(db, playerID)
@@ -254,27 +254,37 @@ func IsPlayerThrottledByIP(db *sql.DB, playerID string) (bool, error) {
 }
 
 func ComputeDampenedStarPrice(db *sql.DB, playerID string, basePrice int) (int, error) {
-	if !featureFlags.IPThrottling {
+	multiplier, err := playerDampeningPriceMultiplier(db, playerID)
+	if err != nil {
+		return basePrice, err
+	}
+	if multiplier == 1 {
 		return basePrice, nil
 	}
+	return int(float64(basePrice)*multiplier + 0.9999), nil
+}
+
+func playerDampeningPriceMultiplier(db *sql.DB, playerID string) (float64, error) {
+	if !featureFlagEnabledFor(FlagIPThrottling, playerID) {
+		return 1, nil
+	}
 	throttled, err := IsPlayerThrottledByIP(db, playerID)
 	if err != nil {
-		return basePrice, err
+		return 1, err
 	}
 	if !throttled {
-		return basePrice, nil
+		return 1, nil
 	}
 
 	trustStatus, err := accountTrustStatusForPlayer(db, playerID)
 	if err != nil {
 		trustStatus = trustStatusNormal
 	}
-	multiplier := ipDampeningPriceMultiplier * trustStatusPriceMultiplier(trustStatus)
-	return int(float64(basePrice)*multiplier + 0.9999), nil
+	return ipDampeningPriceMultiplier * trustStatusPriceMultiplier(trustStatus), nil
 }
 
 func ApplyIPDampeningReward(db *sql.DB, playerID string, reward int) (int, error) {
-	if !featureFlags.IPThrottling {
+	if !featureFlagEnabledFor(FlagIPThrottling, playerID) {
 		return reward, nil
 	}
 	if reward <= 0 {
@@ -349,6 +359,10 @@ func UpdatePlayerBalances(
 			last_active_at = NOW()
 		WHERE player_id = $1
 	`, playerID, coins, stars)
+	if err != nil {
+		return err
+	}
 
-	return err
+	publishPlayerBalance(playerID, coins, stars)
+	return nil
 }
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/bits"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Signup and login can demand a hashcash-style proof of work once an IP puts
+// pressure on them. GET /auth/challenge returns a challenge signed by the
+// server, bound to the action and the caller's IP. The client searches for a
+// solution string such that SHA-256(challenge + ":" + solution) starts with
+// at least `difficulty` zero bits, then sends both with the request. Nothing
+// is stored until a solution is redeemed, and each challenge works once.
+//
+// Difficulty is zero (no challenge) until the IP's attempts in the current
+// rate limit window reach POW_<ACTION>_THRESHOLD or, for signup, the IP
+// already has POW_IP_PLAYERS_THRESHOLD players. Past that it starts at
+// POW_BASE_DIFFICULTY and grows with each extra attempt and extra player, up
+// to POW_MAX_DIFFICULTY.
+const (
+	PowActionSignup = "signup"
+	PowActionLogin  = "login"
+
+	powChallengeTTL   = 5 * time.Minute
+	powPruneInterval  = 10 * time.Minute
+	powMaxSolutionLen = 64
+)
+
+type PowChallengeResponse struct {
+	OK         bool   `json:"ok"`
+	Error      string `json:"error,omitempty"`
+	Required   bool   `json:"required"`
+	Challenge  string `json:"challenge,omitempty"`
+	Difficulty int    `json:"difficulty,omitempty"`
+	ExpiresAt  string `json:"expiresAt,omitempty"`
+}
+
+func powEnabled() bool {
+	raw := strings.ToLower(strings.TrimSpace(os.Getenv("POW_ENABLED")))
+	return raw != "false" && raw != "0" && raw != "no"
+}
+
+func powSecret() []byte {
+	if secret := strings.TrimSpace(os.Getenv("POW_SECRET")); secret != "" {
+		return []byte(secret)
+	}
+	return append([]byte("pow:"), accessTokenSecret()...)
+}
+
+func powIPTag(ip string) string {
+	return hashToken("pow-ip:" + strings.TrimSpace(ip))[:16]
+}
+
+// powDifficulty returns the number of leading zero bits required for action
+// from ip, or 0 when no challenge is needed. pendingAttempts counts attempts
+// that are about to be made but are not yet in auth_rate_limits.
+func powDifficulty(db *sql.DB, action string, ip string, pendingAttempts int) (int, error) {
+	ip = strings.TrimSpace(ip)
+	if !powEnabled() || ip == "" {
+		return 0, nil
+	}
+
+	var threshold int
+	switch action {
+	case PowActionSignup:
+		threshold = parseEnvInt("POW_SIGNUP_THRESHOLD", 2)
+	case PowActionLogin:
+		threshold = parseEnvInt("POW_LOGIN_THRESHOLD", 5)
+	default:
+		return 0, errors.New("INVALID_ACTION")
+	}
+
+	_, window := authRateLimitConfig(action)
+	attempts := 0
+	var windowStart time.Time
+	var count int
+	err := db.QueryRow(`
+		SELECT window_start, attempt_count
+		FROM auth_rate_limits
+		WHERE ip = $1 AND action = $2
+	`, ip, action).Scan(&windowStart, &count)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	if err == nil && time.Since(windowStart) < window {
+		attempts = count
+	}
+	attempts += pendingAttempts
+
+	excess := 0
+	if threshold > 0 && attempts >= threshold {
+		excess = attempts - threshold + 1
+	}
+	if action == PowActionSignup {
+		playerThreshold := parseEnvInt("POW_IP_PLAYERS_THRESHOLD", 2)
+		players, err := countPlayersForIP(db, ip)
+		if err != nil {
+			return 0, err
+		}
+		if playerThreshold > 0 && players >= playerThreshold {
+			excess += 2 * (players - playerThreshold + 1)
+		}
+	}
+	if excess == 0 {
+		return 0, nil
+	}
+
+	base := parseEnvInt("POW_BASE_DIFFICULTY", 16)
+	maxDifficulty := parseEnvInt("POW_MAX_DIFFICULTY", 22)
+	difficulty := base + excess - 1
+	if difficulty > maxDifficulty {
+		difficulty = maxDifficulty
+	}
+	if difficulty < 1 {
+		difficulty = 1
+	}
+	return difficulty, nil
+}
+
+func issuePowChallenge(action string, ip string, difficulty int) (string, time.Time, error) {
+	nonce, err := randomToken(12)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().UTC().Add(powChallengeTTL)
+	payload := strings.Join([]string{
+		action,
+		powIPTag(ip),
+		strconv.Itoa(difficulty),
+		strconv.FormatInt(expiresAt.Unix(), 10),
+		nonce,
+	}, "|")
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	mac := hmac.New(sha256.New, powSecret())
+	mac.Write([]byte(encoded))
+	return encoded + "." + hex.EncodeToString(mac.Sum(nil)), expiresAt, nil
+}
+
+func leadingZeroBits(sum []byte) int {
+	total := 0
+	for _, b := range sum {
+		if b == 0 {
+			total += 8
+			continue
+		}
+		return total + bits.LeadingZeros8(b)
+	}
+	return total
+}
+
+// checkPowSolution verifies a challenge and its solution without consuming
+// it. It returns the difficulty the challenge was issued with.
+func checkPowSolution(challenge string, solution string, action string, ip string) (int, time.Time, error) {
+	parts := strings.Split(challenge, ".")
+	if len(parts) != 2 || solution == "" || len(solution) > powMaxSolutionLen {
+		return 0, time.Time{}, errors.New("POW_INVALID")
+	}
+	mac := hmac.New(sha256.New, powSecret())
+	mac.Write([]byte(parts[0]))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if subtle.ConstantTimeCompare([]byte(parts[1]), []byte(expected)) != 1 {
+		return 0, time.Time{}, errors.New("POW_INVALID")
+	}
+	payloadBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return 0, time.Time{}, errors.New("POW_INVALID")
+	}
+	fields := strings.Split(string(payloadBytes), "|")
+	if len(fields) != 5 || fields[0] != action || fields[1] != powIPTag(ip) {
+		return 0, time.Time{}, errors.New("POW_INVALID")
+	}
+	difficulty, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return 0, time.Time{}, errors.New("POW_INVALID")
+	}
+	exp, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return 0, time.Time{}, errors.New("POW_INVALID")
+	}
+	expiresAt := time.Unix(exp, 0).UTC()
+	if time.Now().UTC().After(expiresAt) {
+		return 0, time.Time{}, errors.New("POW_EXPIRED")
+	}
+	sum := sha256.Sum256([]byte(challenge + ":" + solution))
+	if leadingZeroBits(sum[:]) < difficulty {
+		return 0, time.Time{}, errors.New("POW_INVALID")
+	}
+	return difficulty, expiresAt, nil
+}
+
+var (
+	powPruneMu   sync.Mutex
+	powLastPrune time.Time
+)
+
+func prunePowRedemptions(db *sql.DB) {
+	powPruneMu.Lock()
+	if time.Since(powLastPrune) < powPruneInterval {
+		powPruneMu.Unlock()
+		return
+	}
+	powLastPrune = time.Now()
+	powPruneMu.Unlock()
+	if _, err := db.Exec(`DELETE FROM pow_redemptions WHERE expires_at < NOW()`); err != nil {
+		log.Println("pow: prune failed:", err)
+	}
+}
+
+// requireProofOfWork enforces the challenge for action. It returns "" when the
+// request may proceed, or an error code: POW_REQUIRED (fetch a new challenge),
+// POW_INVALID, POW_EXPIRED or POW_REPLAYED.
+func requireProofOfWork(db *sql.DB, action string, ip string, challenge string, solution string) (string, error) {
+	required, err := powDifficulty(db, action, ip, 0)
+	if err != nil {
+		return "", err
+	}
+	if required == 0 {
+		return "", nil
+	}
+	challenge = strings.TrimSpace(challenge)
+	solution = strings.TrimSpace(solution)
+	if challenge == "" {
+		return "POW_REQUIRED", nil
+	}
+	difficulty, expiresAt, err := checkPowSolution(challenge, solution, action, ip)
+	if err != nil {
+		return err.Error(), nil
+	}
+	if difficulty < required {
+		return "POW_REQUIRED", nil
+	}
+
+	res, err := db.Exec(`
+		INSERT INTO pow_redemptions (challenge_hash, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (challenge_hash) DO NOTHING
+	`, hashToken(challenge), expiresAt)
+	if err != nil {
+		return "", err
+	}
+	prunePowRedemptions(db)
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return "POW_REPLAYED", nil
+	}
+	return "", nil
+}
+
+func powChallengeHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		action := strings.TrimSpace(r.URL.Query().Get("action"))
+		if action != PowActionSignup && action != PowActionLogin {
+			json.NewEncoder(w).Encode(PowChallengeResponse{OK: false, Error: "INVALID_ACTION"})
+			return
+		}
+		ip := getClientIP(r)
+		// The attempt that redeems this challenge will itself count against
+		// the rate limit window, so size the puzzle for it.
+		difficulty, err := powDifficulty(db, action, ip, 1)
+		if err != nil {
+			log.Println("pow: difficulty error:", err)
+			json.NewEncoder(w).Encode(PowChallengeResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if difficulty == 0 {
+			json.NewEncoder(w).Encode(PowChallengeResponse{OK: true, Required: false})
+			return
+		}
+		challenge, expiresAt, err := issuePowChallenge(action, ip, difficulty)
+		if err != nil {
+			json.NewEncoder(w).Encode(PowChallengeResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		json.NewEncoder(w).Encode(PowChallengeResponse{
+			OK:         true,
+			Required:   true,
+			Challenge:  challenge,
+			Difficulty: difficulty,
+			ExpiresAt:  expiresAt.Format(time.RFC3339),
+		})
+	}
+}
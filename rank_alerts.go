@@ -0,0 +1,104 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Rank alerts are opt-in (NotificationCategoryLeaderboard) and rate limited
+// per player through notification dedupe keys, which hold across instances.
+const (
+	rankPassedAlertCooldown = 15 * time.Minute
+	rankTopAlertCooldown    = time.Hour
+)
+
+func rankAlertTopN() int {
+	n := parseEnvInt("RANK_ALERT_TOP_N", 10)
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// handleRankChanges sends leaderboard notifications to players who opted in.
+// Live rank_changed messages are not published per player: streams look up
+// their own rank when the leaderboard event for the refresh arrives.
+func handleRankChanges(db *sql.DB, seasonID string, changes []LeaderboardRankChange) {
+	topN := rankAlertTopN()
+	notifyFriendsPassed(db, seasonID, changes)
+	candidates := map[string]LeaderboardRankChange{}
+	playerIDs := []string{}
+	for _, change := range changes {
+		passed := change.PreviousRank > 0 && change.Rank > change.PreviousRank
+		enteredTop := change.Stars > 0 && change.Rank <= topN && (change.PreviousRank == 0 || change.PreviousRank > topN)
+		if passed || enteredTop {
+			candidates[change.PlayerID] = change
+			playerIDs = append(playerIDs, change.PlayerID)
+		}
+	}
+	if len(playerIDs) == 0 {
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT a.account_id, a.player_id
+		FROM accounts a
+		JOIN notification_settings s
+			ON s.account_id = a.account_id AND s.category = $1
+		WHERE s.enabled = true
+			AND a.player_id = ANY($2)
+	`, NotificationCategoryLeaderboard, pq.Array(playerIDs))
+	if err != nil {
+		log.Println("rank alerts: opt-in lookup failed:", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var accountID string
+		var playerID string
+		if err := rows.Scan(&accountID, &playerID); err != nil {
+			continue
+		}
+		change := candidates[playerID]
+		payload := map[string]interface{}{
+			"seasonId":     seasonID,
+			"rank":         change.Rank,
+			"previousRank": change.PreviousRank,
+			"stars":        change.Stars,
+		}
+		if change.Stars > 0 && change.Rank <= topN && (change.PreviousRank == 0 || change.PreviousRank > topN) {
+			emitNotification(db, NotificationInput{
+				RecipientRole:      NotificationRolePlayer,
+				RecipientAccountID: accountID,
+				SeasonID:           seasonID,
+				Category:           NotificationCategoryLeaderboard,
+				Type:               "rank_entered_top",
+				Priority:           NotificationPriorityNormal,
+				Message:            "You entered the top " + strconv.Itoa(topN) + " at rank #" + strconv.Itoa(change.Rank) + ".",
+				Link:               "#/leaderboard",
+				Payload:            payload,
+				DedupKey:           "rank_entered_top:" + accountID,
+				DedupWindow:        rankTopAlertCooldown,
+			})
+			continue
+		}
+		emitNotification(db, NotificationInput{
+			RecipientRole:      NotificationRolePlayer,
+			RecipientAccountID: accountID,
+			SeasonID:           seasonID,
+			Category:           NotificationCategoryLeaderboard,
+			Type:               "rank_passed",
+			Priority:           NotificationPriorityNormal,
+			Message:            "You were passed on the leaderboard and are now rank #" + strconv.Itoa(change.Rank) + ".",
+			Link:               "#/leaderboard",
+			Payload:            payload,
+			DedupKey:           "rank_passed:" + accountID,
+			DedupWindow:        rankPassedAlertCooldown,
+		})
+	}
+}
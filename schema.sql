@@ -58,6 +58,46 @@ ALTER TABLE accounts
 ALTER TABLE accounts
     ADD COLUMN IF NOT EXISTS must_change_password BOOLEAN NOT NULL DEFAULT FALSE;
 
+ALTER TABLE accounts
+    ADD COLUMN IF NOT EXISTS frozen_at TIMESTAMPTZ;
+
+ALTER TABLE accounts
+    ADD COLUMN IF NOT EXISTS frozen_by TEXT;
+
+ALTER TABLE accounts
+    ADD COLUMN IF NOT EXISTS totp_secret TEXT;
+
+ALTER TABLE accounts
+    ADD COLUMN IF NOT EXISTS totp_pending_secret TEXT;
+
+ALTER TABLE accounts
+    ADD COLUMN IF NOT EXISTS totp_enabled_at TIMESTAMPTZ;
+
+ALTER TABLE accounts
+    ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1
+        FROM information_schema.columns
+        WHERE table_name = 'accounts'
+          AND column_name = 'email_verified_at'
+    ) THEN
+        ALTER TABLE accounts
+            ADD COLUMN email_verified_at TIMESTAMPTZ;
+        UPDATE accounts
+        SET email_verified_at = created_at
+        WHERE email IS NOT NULL AND email_verified_at IS NULL;
+    END IF;
+END $$;
+
+ALTER TABLE accounts
+    ADD COLUMN IF NOT EXISTS pending_email TEXT;
+
+ALTER TABLE accounts
+    ADD COLUMN IF NOT EXISTS deletion_scheduled_for TIMESTAMPTZ;
+
 CREATE TABLE IF NOT EXISTS sessions (
     session_id TEXT PRIMARY KEY,
     account_id TEXT NOT NULL,
@@ -67,6 +107,28 @@ CREATE TABLE IF NOT EXISTS sessions (
 CREATE INDEX IF NOT EXISTS idx_sessions_account_id
     ON sessions (account_id);
 
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ;
+
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMPTZ;
+
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS user_agent TEXT;
+
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS ip TEXT;
+
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS public_id TEXT;
+
+UPDATE sessions
+SET public_id = 's_' || substr(translate(encode(sha256(convert_to(session_id, 'UTF8')), 'base64'), '+/', '-_'), 1, 16)
+WHERE public_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_public_id
+    ON sessions (public_id);
+
 ALTER TABLE players
     ADD COLUMN IF NOT EXISTS last_coin_grant_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
 
@@ -157,6 +219,25 @@ CREATE TABLE IF NOT EXISTS auth_rate_limits (
 CREATE INDEX IF NOT EXISTS idx_refresh_tokens_account_id
     ON refresh_tokens (account_id, revoked_at);
 
+ALTER TABLE refresh_tokens
+    ADD COLUMN IF NOT EXISTS session_id TEXT;
+
+ALTER TABLE refresh_tokens
+    ADD COLUMN IF NOT EXISTS started_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id
+    ON refresh_tokens (session_id);
+
+ALTER TABLE refresh_tokens
+    ADD COLUMN IF NOT EXISTS session_public_id TEXT;
+
+UPDATE refresh_tokens
+SET session_public_id = 's_' || substr(translate(encode(sha256(convert_to(session_id, 'UTF8')), 'base64'), '+/', '-_'), 1, 16)
+WHERE session_public_id IS NULL AND session_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_public_id
+    ON refresh_tokens (session_public_id);
+
 ALTER TABLE notifications
     ADD COLUMN IF NOT EXISTS link TEXT;
 
@@ -235,6 +316,21 @@ CREATE TABLE IF NOT EXISTS global_settings (
     updated_at TIMESTAMPTZ NOT NULL
 );
 
+CREATE TABLE IF NOT EXISTS global_settings_history (
+    id BIGSERIAL PRIMARY KEY,
+    version BIGINT NOT NULL,
+    key TEXT NOT NULL,
+    old_value TEXT,
+    new_value TEXT NOT NULL,
+    changed_by TEXT,
+    reason TEXT,
+    rollback_of BIGINT,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_global_settings_history_version
+    ON global_settings_history (version DESC);
+
 CREATE TABLE IF NOT EXISTS password_resets (
     reset_id TEXT PRIMARY KEY,
     account_id TEXT NOT NULL,
@@ -334,6 +430,8 @@ CREATE TABLE IF NOT EXISTS season_final_rankings (
     stars BIGINT NOT NULL,
     coins BIGINT NOT NULL,
     captured_at TIMESTAMPTZ NOT NULL,
+    final_rank INT,
+    tier TEXT,
     PRIMARY KEY (season_id, player_id)
 );
 
@@ -478,3 +576,339 @@ CREATE TABLE IF NOT EXISTS tsa_activation_log (
 CREATE INDEX IF NOT EXISTS idx_tsa_activation_log_activated_at
     ON tsa_activation_log (activated_at DESC);
 
+
+CREATE TABLE IF NOT EXISTS leaderboard_ranks (
+    season_id TEXT NOT NULL,
+    player_id TEXT NOT NULL,
+    rank INT NOT NULL,
+    stars BIGINT NOT NULL,
+    coins_spent_lifetime BIGINT NOT NULL DEFAULT 0,
+    last_star_acquired_at TIMESTAMPTZ,
+    player_created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (season_id, player_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_leaderboard_ranks_rank
+    ON leaderboard_ranks (season_id, rank);
+
+CREATE TABLE IF NOT EXISTS leaderboard_rank_history (
+    id BIGSERIAL PRIMARY KEY,
+    season_id TEXT NOT NULL,
+    player_id TEXT NOT NULL,
+    rank INT NOT NULL,
+    previous_rank INT,
+    stars BIGINT NOT NULL,
+    recorded_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_leaderboard_rank_history_player
+    ON leaderboard_rank_history (season_id, player_id, recorded_at DESC);
+
+-- Every change to a ranking input bumps a player's leaderboard_version or
+-- the deletion count, so the refresher can skip rebuilds when neither moved.
+ALTER TABLE players
+    ADD COLUMN IF NOT EXISTS leaderboard_version BIGINT NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS leaderboard_input_state (
+    id INT PRIMARY KEY,
+    players_deleted BIGINT NOT NULL DEFAULT 0
+);
+
+INSERT INTO leaderboard_input_state (id)
+VALUES (1)
+ON CONFLICT (id) DO NOTHING;
+
+CREATE OR REPLACE FUNCTION bump_player_leaderboard_version() RETURNS trigger AS $$
+BEGIN
+    NEW.leaderboard_version := OLD.leaderboard_version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION bump_leaderboard_version_for_player() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        UPDATE players SET leaderboard_version = leaderboard_version + 1 WHERE player_id = OLD.player_id;
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        UPDATE players SET leaderboard_version = leaderboard_version + 1 WHERE player_id = NEW.player_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION count_leaderboard_player_deletes() RETURNS trigger AS $$
+BEGIN
+    UPDATE leaderboard_input_state SET players_deleted = players_deleted + 1 WHERE id = 1;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'players_leaderboard_version') THEN
+        CREATE TRIGGER players_leaderboard_version
+            BEFORE UPDATE OF stars, is_bot ON players
+            FOR EACH ROW
+            WHEN (OLD.stars IS DISTINCT FROM NEW.stars OR OLD.is_bot IS DISTINCT FROM NEW.is_bot)
+            EXECUTE FUNCTION bump_player_leaderboard_version();
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'players_leaderboard_delete') THEN
+        CREATE TRIGGER players_leaderboard_delete
+            AFTER DELETE ON players
+            FOR EACH STATEMENT
+            EXECUTE FUNCTION count_leaderboard_player_deletes();
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'star_purchase_log_leaderboard_version') THEN
+        CREATE TRIGGER star_purchase_log_leaderboard_version
+            AFTER INSERT OR UPDATE OR DELETE ON star_purchase_log
+            FOR EACH ROW
+            EXECUTE FUNCTION bump_leaderboard_version_for_player();
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'accounts_leaderboard_version') THEN
+        CREATE TRIGGER accounts_leaderboard_version
+            AFTER UPDATE OF trust_status ON accounts
+            FOR EACH ROW
+            WHEN (OLD.trust_status IS DISTINCT FROM NEW.trust_status)
+            EXECUTE FUNCTION bump_leaderboard_version_for_player();
+    END IF;
+END $$;
+
+CREATE TABLE IF NOT EXISTS friendships (
+    requester_account_id TEXT NOT NULL,
+    addressee_account_id TEXT NOT NULL,
+    status TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    responded_at TIMESTAMPTZ,
+    PRIMARY KEY (requester_account_id, addressee_account_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_friendships_addressee
+    ON friendships (addressee_account_id, status);
+
+CREATE TABLE IF NOT EXISTS teams (
+    team_id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    tag TEXT NOT NULL UNIQUE,
+    description TEXT,
+    owner_account_id TEXT NOT NULL,
+    max_members INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_teams_name_lower
+    ON teams (LOWER(name));
+
+CREATE TABLE IF NOT EXISTS team_members (
+    account_id TEXT PRIMARY KEY,
+    team_id TEXT NOT NULL,
+    role TEXT NOT NULL,
+    joined_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_team_members_team
+    ON team_members (team_id);
+
+CREATE TABLE IF NOT EXISTS team_join_requests (
+    team_id TEXT NOT NULL,
+    account_id TEXT NOT NULL,
+    message TEXT,
+    status TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    responded_at TIMESTAMPTZ,
+    responded_by TEXT,
+    PRIMARY KEY (team_id, account_id)
+);
+
+CREATE TABLE IF NOT EXISTS team_membership_log (
+    id BIGSERIAL PRIMARY KEY,
+    team_id TEXT NOT NULL,
+    account_id TEXT NOT NULL,
+    action TEXT NOT NULL,
+    actor_account_id TEXT,
+    details JSONB,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_team_membership_log_team
+    ON team_membership_log (team_id, created_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_team_membership_log_account
+    ON team_membership_log (account_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS season_controls (
+    season_id TEXT PRIMARY KEY,
+    purchases_paused BOOLEAN NOT NULL DEFAULT FALSE,
+    purchases_paused_reason TEXT,
+    emission_multiplier DOUBLE PRECISION NOT NULL DEFAULT 1,
+    emission_multiplier_expires_at TIMESTAMPTZ,
+    emission_reason TEXT,
+    frozen BOOLEAN NOT NULL DEFAULT FALSE,
+    frozen_reason TEXT,
+    updated_by TEXT,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS feature_flags (
+    key TEXT PRIMARY KEY,
+    enabled BOOLEAN NOT NULL,
+    phases TEXT NOT NULL DEFAULT '',
+    rollout_percent INT NOT NULL DEFAULT 100,
+    description TEXT,
+    updated_by TEXT,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    permission TEXT PRIMARY KEY,
+    description TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role TEXT NOT NULL,
+    permission TEXT NOT NULL,
+    granted_by TEXT,
+    granted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (role, permission)
+);
+
+CREATE TABLE IF NOT EXISTS account_permissions (
+    account_id TEXT NOT NULL,
+    permission TEXT NOT NULL,
+    granted_by TEXT,
+    granted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (account_id, permission)
+);
+
+CREATE TABLE IF NOT EXISTS admin_pending_actions (
+    id BIGSERIAL PRIMARY KEY,
+    action_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    reason TEXT,
+    requested_by TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    decided_by TEXT,
+    decided_at TIMESTAMPTZ,
+    decision_reason TEXT,
+    result_error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_admin_pending_actions_status
+    ON admin_pending_actions (status, expires_at);
+
+CREATE TABLE IF NOT EXISTS account_recovery_codes (
+    account_id TEXT NOT NULL,
+    code_hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    PRIMARY KEY (account_id, code_hash)
+);
+
+CREATE TABLE IF NOT EXISTS account_devices (
+    account_id TEXT NOT NULL,
+    device_key TEXT NOT NULL,
+    user_agent TEXT,
+    first_seen_at TIMESTAMPTZ NOT NULL,
+    last_seen_at TIMESTAMPTZ NOT NULL,
+    last_ip TEXT,
+    PRIMARY KEY (account_id, device_key)
+);
+
+CREATE TABLE IF NOT EXISTS email_verifications (
+    token_hash TEXT PRIMARY KEY,
+    account_id TEXT NOT NULL,
+    email TEXT NOT NULL,
+    purpose TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_verifications_account
+    ON email_verifications (account_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS mail_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    template TEXT NOT NULL,
+    recipient TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    text_body TEXT NOT NULL,
+    html_body TEXT,
+    dedup_key TEXT UNIQUE,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    sent_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_mail_outbox_due
+    ON mail_outbox (status, next_attempt_at);
+
+CREATE TABLE IF NOT EXISTS pow_redemptions (
+    challenge_hash TEXT PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+    token_id TEXT PRIMARY KEY,
+    account_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    last_used_at TIMESTAMPTZ,
+    last_used_ip TEXT,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_account
+    ON api_tokens (account_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS account_deletions (
+    id BIGSERIAL PRIMARY KEY,
+    account_id TEXT NOT NULL,
+    player_id TEXT NOT NULL,
+    status TEXT NOT NULL,
+    requested_at TIMESTAMPTZ NOT NULL,
+    scheduled_for TIMESTAMPTZ NOT NULL,
+    cancelled_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_deletions_account
+    ON account_deletions (account_id, status);
+
+CREATE TABLE IF NOT EXISTS account_login_failures (
+    account_id TEXT PRIMARY KEY,
+    failed_count INT NOT NULL DEFAULT 0,
+    lockout_level INT NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMPTZ,
+    locked_until TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS account_login_ranges (
+    account_id TEXT NOT NULL,
+    ip_range TEXT NOT NULL,
+    first_seen_at TIMESTAMPTZ NOT NULL,
+    last_seen_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (account_id, ip_range)
+);
+
+CREATE TABLE IF NOT EXISTS access_token_keys (
+    kid TEXT PRIMARY KEY,
+    secret TEXT,
+    source TEXT NOT NULL,
+    status TEXT NOT NULL,
+    created_by TEXT,
+    created_at TIMESTAMPTZ NOT NULL,
+    activated_at TIMESTAMPTZ,
+    retired_at TIMESTAMPTZ
+);
@@ -36,16 +36,26 @@ func FinalizeSeason(db *sql.DB, seasonID string) (bool, error) {
 		return false, tx.Commit()
 	}
 
+	// Final rank and tier use the live leaderboard ordering and tier table so
+	// end-of-season rewards match what players saw during the season.
 	_, err = tx.Exec(`
+		WITH `+leaderboardRankedCTE+`,
+		totals AS (
+			SELECT COUNT(*) FILTER (WHERE stars > 0) AS ranked_total
+			FROM player_stats
+		)
 		INSERT INTO season_final_rankings (
 			season_id,
 			player_id,
 			stars,
 			coins,
-			captured_at
+			captured_at,
+			final_rank,
+			tier
 		)
-		SELECT $1, player_id, stars, coins, NOW()
-		FROM players
+		SELECT $1, r.player_id, r.stars, r.coins, NOW(), r.rank, `+leaderboardTierSQL("r.rank", "t.ranked_total", "r.stars")+`
+		FROM ranked r
+		CROSS JOIN totals t
 		ON CONFLICT (season_id, player_id) DO NOTHING
 	`, seasonID)
 	if err != nil {
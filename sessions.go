@@ -0,0 +1,382 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Players can see where they are signed in and sign other devices out. A
+// device is a cookie session or a refresh-token chain; the two are linked
+// when they came from the same login. Session IDs are bearer secrets, so the
+// list only exposes a hash of them.
+const (
+	sessionTouchInterval = 5 * time.Minute
+
+	sessionKindCookie  = "session"
+	sessionKindRefresh = "refresh_token"
+)
+
+type AccountSession struct {
+	ID         string    `json:"id"`
+	Kind       string    `json:"kind"`
+	Device     string    `json:"device"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Current    bool      `json:"current"`
+}
+
+type RevokeSessionRequest struct {
+	ID           string `json:"id,omitempty"`
+	AllOthers    bool   `json:"allOthers,omitempty"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+}
+
+type AccountSessionsResponse struct {
+	OK       bool             `json:"ok"`
+	Error    string           `json:"error,omitempty"`
+	Sessions []AccountSession `json:"sessions,omitempty"`
+	Revoked  int              `json:"revoked,omitempty"`
+}
+
+func touchSession(db *sql.DB, sessionID string, ip string) {
+	_, _ = db.Exec(`
+		UPDATE sessions
+		SET last_seen_at = NOW(), ip = COALESCE(NULLIF($2, ''), ip)
+		WHERE session_id = $1
+	`, sessionID, ip)
+}
+
+func sessionPublicID(sessionID string) string {
+	return "s_" + hashToken(sessionID)[:16]
+}
+
+func refreshTokenPublicID(id int64) string {
+	return "r_" + strconv.FormatInt(id, 10)
+}
+
+// describeUserAgent turns a user agent into a short "Browser on OS" label.
+func describeUserAgent(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	if ua == "" {
+		return "Unknown device"
+	}
+	browser := "Browser"
+	switch {
+	case strings.Contains(ua, "edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "opr/") || strings.Contains(ua, "opera"):
+		browser = "Opera"
+	case strings.Contains(ua, "firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "chrome/") || strings.Contains(ua, "crios/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "safari/"):
+		browser = "Safari"
+	case strings.Contains(ua, "curl/"):
+		browser = "curl"
+	case strings.Contains(ua, "go-http-client"):
+		browser = "Go client"
+	}
+	system := ""
+	switch {
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad"):
+		system = "iOS"
+	case strings.Contains(ua, "android"):
+		system = "Android"
+	case strings.Contains(ua, "windows"):
+		system = "Windows"
+	case strings.Contains(ua, "mac os"):
+		system = "macOS"
+	case strings.Contains(ua, "linux"):
+		system = "Linux"
+	}
+	if system == "" {
+		return browser
+	}
+	return browser + " on " + system
+}
+
+// recordLoginDevice remembers the device and network behind a login and
+// sends the player a security notification when either is new, unless it is
+// the account's very first one. A new device takes precedence over a new
+// network so one login never raises two alerts.
+func recordLoginDevice(db *sql.DB, account *Account, userAgent string, ip string) {
+	newRange := recordLoginRange(db, account.AccountID, ip)
+	deviceKey := hashToken(strings.ToLower(strings.TrimSpace(userAgent)))
+	var inserted bool
+	err := db.QueryRow(`
+		INSERT INTO account_devices (account_id, device_key, user_agent, first_seen_at, last_seen_at, last_ip)
+		VALUES ($1, $2, $3, NOW(), NOW(), $4)
+		ON CONFLICT (account_id, device_key) DO UPDATE SET last_seen_at = NOW(), last_ip = EXCLUDED.last_ip
+		RETURNING (xmax = 0)
+	`, account.AccountID, deviceKey, userAgent, ip).Scan(&inserted)
+	if err != nil {
+		return
+	}
+	newDevice := false
+	if inserted {
+		var known int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM account_devices WHERE account_id = $1`, account.AccountID).Scan(&known); err == nil && known > 1 {
+			newDevice = true
+		}
+	}
+	device := describeUserAgent(userAgent)
+	switch {
+	case newDevice:
+		emitNotification(db, NotificationInput{
+			RecipientRole:      NotificationRolePlayer,
+			RecipientAccountID: account.AccountID,
+			Category:           NotificationCategorySecurity,
+			Type:               "new_device_login",
+			Priority:           NotificationPriorityHigh,
+			Message:            "New sign-in from " + device + " (" + ip + "). If this wasn't you, sign out other devices and change your password.",
+			Link:               "#/account",
+			Payload: map[string]interface{}{
+				"device":    device,
+				"userAgent": userAgent,
+				"ip":        ip,
+			},
+		})
+		sendSecurityAlertEmail(db, account.AccountID, "new sign-in", "Your account was just used to sign in from a device we haven't seen before.", device, ip)
+	case newRange:
+		emitNotification(db, NotificationInput{
+			RecipientRole:      NotificationRolePlayer,
+			RecipientAccountID: account.AccountID,
+			Category:           NotificationCategorySecurity,
+			Type:               "new_network_login",
+			Priority:           NotificationPriorityHigh,
+			Message:            "New sign-in from an unfamiliar network (" + ip + ") on " + device + ". If this wasn't you, sign out other devices and change your password.",
+			Link:               "#/account",
+			Payload: map[string]interface{}{
+				"device":  device,
+				"ip":      ip,
+				"ipRange": loginIPRange(ip),
+			},
+		})
+		sendSecurityAlertEmail(db, account.AccountID, "sign-in from a new network", "Your account was just used to sign in from a network we haven't seen before.", device, ip)
+	}
+}
+
+func listAccountSessions(db *sql.DB, accountID string, currentSessionID string) ([]AccountSession, error) {
+	sessions := []AccountSession{}
+	rows, err := db.Query(`
+		SELECT session_id, COALESCE(user_agent, ''), COALESCE(ip, ''),
+			COALESCE(created_at, expires_at - INTERVAL '7 days'),
+			COALESCE(last_seen_at, created_at, expires_at - INTERVAL '7 days'),
+			expires_at
+		FROM sessions
+		WHERE account_id = $1 AND expires_at > NOW()
+	`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var sessionID string
+		var item AccountSession
+		if err := rows.Scan(&sessionID, &item.UserAgent, &item.IP, &item.CreatedAt, &item.LastUsedAt, &item.ExpiresAt); err != nil {
+			continue
+		}
+		item.ID = sessionPublicID(sessionID)
+		item.Kind = sessionKindCookie
+		item.Device = describeUserAgent(item.UserAgent)
+		item.Current = sessionID == currentSessionID
+		sessions = append(sessions, item)
+	}
+	rows.Close()
+
+	rows, err = db.Query(`
+		SELECT id, COALESCE(user_agent, ''), COALESCE(ip, ''), COALESCE(started_at, issued_at), issued_at, expires_at,
+			COALESCE(session_id, '')
+		FROM refresh_tokens
+		WHERE account_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+	`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var linkedSession string
+		var item AccountSession
+		if err := rows.Scan(&id, &item.UserAgent, &item.IP, &item.CreatedAt, &item.LastUsedAt, &item.ExpiresAt, &linkedSession); err != nil {
+			continue
+		}
+		item.ID = refreshTokenPublicID(id)
+		item.Kind = sessionKindRefresh
+		item.Device = describeUserAgent(item.UserAgent)
+		item.Current = currentSessionID != "" && linkedSession == currentSessionID
+		sessions = append(sessions, item)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt) })
+	return sessions, rows.Err()
+}
+
+// revokeSessionByID signs out one device. Revoking a cookie session also
+// revokes refresh tokens from the same login, and the other way round.
+func revokeSessionByID(db *sql.DB, accountID string, publicID string) (bool, error) {
+	if strings.HasPrefix(publicID, "r_") {
+		id, err := strconv.ParseInt(strings.TrimPrefix(publicID, "r_"), 10, 64)
+		if err != nil {
+			return false, nil
+		}
+		var linkedSession sql.NullString
+		err = db.QueryRow(`
+			UPDATE refresh_tokens
+			SET revoked_at = NOW()
+			WHERE id = $1 AND account_id = $2 AND revoked_at IS NULL
+			RETURNING session_id
+		`, id, accountID).Scan(&linkedSession)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if linkedSession.Valid && linkedSession.String != "" {
+			clearSession(db, linkedSession.String)
+		}
+		return true, nil
+	}
+
+	var target string
+	err := db.QueryRow(`
+		DELETE FROM sessions
+		WHERE public_id = $2 AND account_id = $1
+		RETURNING session_id
+	`, accountID, publicID).Scan(&target)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	revokeSessionRefreshTokens(db, target)
+	return true, nil
+}
+
+func revokeSessionRefreshTokens(db *sql.DB, sessionID string) {
+	_, _ = db.Exec(`
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE session_id = $1 AND revoked_at IS NULL
+	`, sessionID)
+}
+
+// revokeOtherSessions signs out everything except the caller's own cookie
+// session and the refresh token it presents (with anything linked to them).
+func revokeOtherSessions(db *sql.DB, accountID string, keepSessionID string, keepRefreshToken string) (int, error) {
+	keepHash := ""
+	if keepRefreshToken != "" {
+		keepHash = hashToken(keepRefreshToken)
+		var linked sql.NullString
+		if err := db.QueryRow(`
+			SELECT session_id FROM refresh_tokens
+			WHERE token_hash = $1 AND account_id = $2 AND revoked_at IS NULL
+		`, keepHash, accountID).Scan(&linked); err == nil && keepSessionID == "" && linked.Valid {
+			keepSessionID = linked.String
+		}
+	}
+	sessionsResult, err := db.Exec(`
+		DELETE FROM sessions
+		WHERE account_id = $1 AND session_id <> $2
+	`, accountID, keepSessionID)
+	if err != nil {
+		return 0, err
+	}
+	tokensResult, err := db.Exec(`
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE account_id = $1
+			AND revoked_at IS NULL
+			AND token_hash <> $2
+			AND (session_id IS NULL OR session_id <> $3)
+	`, accountID, keepHash, keepSessionID)
+	if err != nil {
+		return 0, err
+	}
+	sessionsRevoked, _ := sessionsResult.RowsAffected()
+	tokensRevoked, _ := tokensResult.RowsAffected()
+	return int(sessionsRevoked + tokensRevoked), nil
+}
+
+func accountSessionsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		account, sessionID, err := getSessionAccount(db, r)
+		if err != nil || account == nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if rejectAPIToken(w, account) {
+			return
+		}
+		sessions, err := listAccountSessions(db, account.AccountID, sessionID)
+		if err != nil {
+			json.NewEncoder(w).Encode(AccountSessionsResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		json.NewEncoder(w).Encode(AccountSessionsResponse{OK: true, Sessions: sessions})
+	}
+}
+
+func revokeSessionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		account, sessionID, err := getSessionAccount(db, r)
+		if err != nil || account == nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if rejectAPIToken(w, account) {
+			return
+		}
+		var req RevokeSessionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			json.NewEncoder(w).Encode(AccountSessionsResponse{OK: false, Error: "INVALID_REQUEST"})
+			return
+		}
+
+		if req.AllOthers {
+			revoked, err := revokeOtherSessions(db, account.AccountID, sessionID, strings.TrimSpace(req.RefreshToken))
+			if err != nil {
+				json.NewEncoder(w).Encode(AccountSessionsResponse{OK: false, Error: "INTERNAL_ERROR"})
+				return
+			}
+			json.NewEncoder(w).Encode(AccountSessionsResponse{OK: true, Revoked: revoked})
+			return
+		}
+
+		id := strings.TrimSpace(req.ID)
+		if id == "" {
+			json.NewEncoder(w).Encode(AccountSessionsResponse{OK: false, Error: "INVALID_REQUEST"})
+			return
+		}
+		found, err := revokeSessionByID(db, account.AccountID, id)
+		if err != nil {
+			json.NewEncoder(w).Encode(AccountSessionsResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if !found {
+			json.NewEncoder(w).Encode(AccountSessionsResponse{OK: false, Error: "NOT_FOUND"})
+			return
+		}
+		if sessionID != "" && id == sessionPublicID(sessionID) {
+			clearSessionCookie(w)
+		}
+		json.NewEncoder(w).Encode(AccountSessionsResponse{OK: true, Revoked: 1})
+	}
+}
@@ -2,21 +2,25 @@ package main
 
 import (
 	"database/sql"
+	"log"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
+// GlobalSettings serializes with the same snake_case keys that writes,
+// history and the schema use.
 type GlobalSettings struct {
-	ActiveDripIntervalSeconds int
-	IdleDripIntervalSeconds   int
-	ActiveDripAmount          int
-	IdleDripAmount            int
-	ActivityWindowSeconds     int
-	DripEnabled               bool
-	BotsEnabled               bool
-	BotMinStarIntervalSeconds int
+	ActiveDripIntervalSeconds int  `json:"active_drip_interval_seconds"`
+	IdleDripIntervalSeconds   int  `json:"idle_drip_interval_seconds"`
+	ActiveDripAmount          int  `json:"active_drip_amount"`
+	IdleDripAmount            int  `json:"idle_drip_amount"`
+	ActivityWindowSeconds     int  `json:"activity_window_seconds"`
+	DripEnabled               bool `json:"drip_enabled"`
+	BotsEnabled               bool `json:"bots_enabled"`
+	BotMinStarIntervalSeconds int  `json:"bot_min_star_interval_seconds"`
 }
 
 var (
@@ -33,6 +37,79 @@ var (
 	}
 )
 
+type settingKind string
+
+const (
+	settingKindInt  settingKind = "int"
+	settingKindBool settingKind = "bool"
+)
+
+// SettingSpec describes one writable global setting. PhaseLocks pins a value
+// for a phase; writes of any other value are rejected while in that phase.
+type SettingSpec struct {
+	Key        string           `json:"key"`
+	Kind       settingKind      `json:"type"`
+	Min        int              `json:"min,omitempty"`
+	Max        int              `json:"max,omitempty"`
+	PhaseLocks map[Phase]string `json:"phaseLocks,omitempty"`
+}
+
+var settingsSchema = map[string]SettingSpec{
+	"active_drip_interval_seconds":  {Key: "active_drip_interval_seconds", Kind: settingKindInt, Min: 10, Max: 3600},
+	"idle_drip_interval_seconds":    {Key: "idle_drip_interval_seconds", Kind: settingKindInt, Min: 10, Max: 86400},
+	"active_drip_amount":            {Key: "active_drip_amount", Kind: settingKindInt, Min: 1, Max: 100},
+	"idle_drip_amount":              {Key: "idle_drip_amount", Kind: settingKindInt, Min: 1, Max: 100},
+	"activity_window_seconds":       {Key: "activity_window_seconds", Kind: settingKindInt, Min: 30, Max: 3600},
+	"drip_enabled":                  {Key: "drip_enabled", Kind: settingKindBool, PhaseLocks: map[Phase]string{PhaseAlpha: "false"}},
+	"bots_enabled":                  {Key: "bots_enabled", Kind: settingKindBool},
+	"bot_min_star_interval_seconds": {Key: "bot_min_star_interval_seconds", Kind: settingKindInt, Min: 10, Max: 86400},
+}
+
+// SettingError is returned when a write fails schema validation.
+type SettingError struct {
+	Key  string
+	Code string
+}
+
+func (e *SettingError) Error() string {
+	return e.Code + ": " + e.Key
+}
+
+// validateSetting checks a value against the schema for the given phase and
+// returns it in canonical form.
+func validateSetting(key string, value string, phase Phase) (string, error) {
+	spec, ok := settingsSchema[key]
+	if !ok {
+		return "", &SettingError{Key: key, Code: "UNKNOWN_SETTING"}
+	}
+	value = strings.TrimSpace(value)
+	switch spec.Kind {
+	case settingKindInt:
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return "", &SettingError{Key: key, Code: "INVALID_SETTING_TYPE"}
+		}
+		if v < spec.Min || v > spec.Max {
+			return "", &SettingError{Key: key, Code: "SETTING_OUT_OF_RANGE"}
+		}
+		value = strconv.Itoa(v)
+	case settingKindBool:
+		v, err := parseBool(value)
+		if err != nil {
+			return "", &SettingError{Key: key, Code: "INVALID_SETTING_TYPE"}
+		}
+		value = strconv.FormatBool(v)
+	}
+	if locked, ok := spec.PhaseLocks[phase]; ok && locked != value {
+		return "", &SettingError{Key: key, Code: "SETTING_LOCKED_IN_PHASE"}
+	}
+	return value, nil
+}
+
+// LoadGlobalSettings applies stored settings over the defaults. Rows that are
+// not schema settings (bootstrap and tick markers share the table) are
+// skipped; stored values that fail the schema for the current phase are
+// logged and ignored.
 func LoadGlobalSettings(db *sql.DB) error {
 	rows, err := db.Query(`
 		SELECT key, value
@@ -43,78 +120,251 @@ func LoadGlobalSettings(db *sql.DB) error {
 	}
 	defer rows.Close()
 
-	settingsMu.Lock()
-	defer settingsMu.Unlock()
-
+	// Rows are read before taking the lock so readers never wait on the
+	// database.
+	phase := CurrentPhase()
+	stored := map[string]string{}
 	for rows.Next() {
 		var key string
 		var value string
 		if err := rows.Scan(&key, &value); err != nil {
 			continue
 		}
-		applySetting(&cachedSettings, key, value)
+		if _, ok := settingsSchema[key]; !ok {
+			continue
+		}
+		canonical, err := validateSetting(key, value, phase)
+		if err != nil {
+			log.Println("global setting ignored:", err)
+			continue
+		}
+		stored[key] = canonical
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	for key, value := range stored {
+		_ = applySetting(&cachedSettings, key, value)
 	}
 	return nil
 }
 
+func startGlobalSettingsRefresher(db *sql.DB) {
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := LoadGlobalSettings(db); err != nil {
+				log.Println("global settings refresh failed:", err)
+			}
+		}
+	}()
+}
+
 func GetGlobalSettings() GlobalSettings {
 	settingsMu.RLock()
 	defer settingsMu.RUnlock()
 	return cachedSettings
 }
 
-func UpdateGlobalSettings(db *sql.DB, updates map[string]string) (GlobalSettings, error) {
-	settingsMu.Lock()
-	defer settingsMu.Unlock()
+// UpdateGlobalSettings validates every update against the schema for the
+// current phase, writes them as one new history version and applies them.
+// Nothing is written if any key fails.
+func UpdateGlobalSettings(db *sql.DB, updates map[string]string, actorAccountID string, reason string) (GlobalSettings, int64, error) {
+	return writeGlobalSettings(db, updates, actorAccountID, reason, 0)
+}
+
+func writeGlobalSettings(db *sql.DB, updates map[string]string, actorAccountID string, reason string, rollbackOf int64) (GlobalSettings, int64, error) {
+	phase := CurrentPhase()
+	normalized := make(map[string]string, len(updates))
 	for key, value := range updates {
-		applySetting(&cachedSettings, key, value)
-		_, err := db.Exec(`
+		canonical, err := validateSetting(strings.ToLower(strings.TrimSpace(key)), value, phase)
+		if err != nil {
+			return GetGlobalSettings(), 0, err
+		}
+		normalized[strings.ToLower(strings.TrimSpace(key))] = canonical
+	}
+
+	// The transaction runs without settingsMu so readers on the hot path
+	// never wait on the database; the table lock below orders writers.
+	tx, err := db.Begin()
+	if err != nil {
+		return GetGlobalSettings(), 0, err
+	}
+	defer tx.Rollback()
+
+	// Serializes writers so versions are gap-free and ordered.
+	if _, err := tx.Exec(`LOCK TABLE global_settings_history IN EXCLUSIVE MODE`); err != nil {
+		return GetGlobalSettings(), 0, err
+	}
+	var version int64
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(version), 0) + 1 FROM global_settings_history`).Scan(&version); err != nil {
+		return GetGlobalSettings(), 0, err
+	}
+
+	for key, value := range normalized {
+		var previous sql.NullString
+		if err := tx.QueryRow(`SELECT value FROM global_settings WHERE key = $1`, key).Scan(&previous); err != nil && err != sql.ErrNoRows {
+			return GetGlobalSettings(), 0, err
+		}
+		if _, err := tx.Exec(`
 			INSERT INTO global_settings (key, value, updated_at)
 			VALUES ($1, $2, NOW())
 			ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW()
-		`, key, value)
-		if err != nil {
-			return cachedSettings, err
+		`, key, value); err != nil {
+			return GetGlobalSettings(), 0, err
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO global_settings_history (version, key, old_value, new_value, changed_by, reason, rollback_of, created_at)
+			VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, 0), NOW())
+		`, version, key, previous, value, actorAccountID, reason, rollbackOf); err != nil {
+			return GetGlobalSettings(), 0, err
 		}
 	}
-	return cachedSettings, nil
+	if err := tx.Commit(); err != nil {
+		return GetGlobalSettings(), 0, err
+	}
+
+	// Only the written keys are applied, so a concurrent refresh or write to
+	// other keys is not overwritten by a stale copy.
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	for key, value := range normalized {
+		_ = applySetting(&cachedSettings, key, value)
+	}
+	return cachedSettings, version, nil
 }
 
-func applySetting(target *GlobalSettings, key string, value string) {
-	switch strings.ToLower(strings.TrimSpace(key)) {
-	case "active_drip_interval_seconds":
-		if v, err := strconv.Atoi(value); err == nil {
-			target.ActiveDripIntervalSeconds = v
+// settingsAtVersion reconstructs the schema settings as they stood right
+// after the given history version. Keys first changed later resolve to the
+// value they held before that change.
+func settingsAtVersion(db *sql.DB, version int64) (map[string]string, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT ON (key) key, new_value
+		FROM global_settings_history
+		WHERE version <= $1
+		ORDER BY key, version DESC, id DESC
+	`, version)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			rows.Close()
+			return nil, err
 		}
-	case "idle_drip_interval_seconds":
-		if v, err := strconv.Atoi(value); err == nil {
-			target.IdleDripIntervalSeconds = v
+		values[key] = value
+	}
+	rows.Close()
+
+	later, err := db.Query(`
+		SELECT DISTINCT ON (key) key, old_value
+		FROM global_settings_history
+		WHERE version > $1 AND old_value IS NOT NULL
+		ORDER BY key, version ASC, id ASC
+	`, version)
+	if err != nil {
+		return nil, err
+	}
+	defer later.Close()
+	for later.Next() {
+		var key, value string
+		if err := later.Scan(&key, &value); err != nil {
+			return nil, err
 		}
-	case "active_drip_amount":
-		if v, err := strconv.Atoi(value); err == nil {
-			target.ActiveDripAmount = v
+		if _, ok := values[key]; !ok {
+			values[key] = value
 		}
-	case "idle_drip_amount":
-		if v, err := strconv.Atoi(value); err == nil {
-			target.IdleDripAmount = v
+	}
+	for key := range values {
+		if _, ok := settingsSchema[key]; !ok {
+			delete(values, key)
 		}
-	case "activity_window_seconds":
-		if v, err := strconv.Atoi(value); err == nil {
-			target.ActivityWindowSeconds = v
+	}
+	return values, later.Err()
+}
+
+// RollbackGlobalSettings restores the settings recorded at version as a new
+// version. The restored values are validated against the current phase.
+func RollbackGlobalSettings(db *sql.DB, version int64, actorAccountID string, reason string) (GlobalSettings, int64, error) {
+	var exists bool
+	if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM global_settings_history WHERE version = $1)`, version).Scan(&exists); err != nil {
+		return GetGlobalSettings(), 0, err
+	}
+	if !exists {
+		return GetGlobalSettings(), 0, &SettingError{Key: strconv.FormatInt(version, 10), Code: "VERSION_NOT_FOUND"}
+	}
+	target, err := settingsAtVersion(db, version)
+	if err != nil {
+		return GetGlobalSettings(), 0, err
+	}
+	current := map[string]string{}
+	rows, err := db.Query(`SELECT key, value FROM global_settings`)
+	if err != nil {
+		return GetGlobalSettings(), 0, err
+	}
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err == nil {
+			current[key] = value
 		}
-	case "drip_enabled":
-		if v, err := parseBool(value); err == nil {
-			target.DripEnabled = v
+	}
+	rows.Close()
+
+	updates := map[string]string{}
+	for key, value := range target {
+		if current[key] != value {
+			updates[key] = value
 		}
+	}
+	if len(updates) == 0 {
+		return GetGlobalSettings(), 0, &SettingError{Key: strconv.FormatInt(version, 10), Code: "NO_CHANGES"}
+	}
+	return writeGlobalSettings(db, updates, actorAccountID, reason, version)
+}
+
+func applySetting(target *GlobalSettings, key string, value string) error {
+	key = strings.ToLower(strings.TrimSpace(key))
+	spec, ok := settingsSchema[key]
+	if !ok {
+		return &SettingError{Key: key, Code: "UNKNOWN_SETTING"}
+	}
+	var intValue int
+	var boolValue bool
+	var err error
+	switch spec.Kind {
+	case settingKindInt:
+		intValue, err = strconv.Atoi(strings.TrimSpace(value))
+	case settingKindBool:
+		boolValue, err = parseBool(value)
+	}
+	if err != nil {
+		return &SettingError{Key: key, Code: "INVALID_SETTING_TYPE"}
+	}
+	switch key {
+	case "active_drip_interval_seconds":
+		target.ActiveDripIntervalSeconds = intValue
+	case "idle_drip_interval_seconds":
+		target.IdleDripIntervalSeconds = intValue
+	case "active_drip_amount":
+		target.ActiveDripAmount = intValue
+	case "idle_drip_amount":
+		target.IdleDripAmount = intValue
+	case "activity_window_seconds":
+		target.ActivityWindowSeconds = intValue
+	case "drip_enabled":
+		target.DripEnabled = boolValue
 	case "bots_enabled":
-		if v, err := parseBool(value); err == nil {
-			target.BotsEnabled = v
-		}
+		target.BotsEnabled = boolValue
 	case "bot_min_star_interval_seconds":
-		if v, err := strconv.Atoi(value); err == nil {
-			target.BotMinStarIntervalSeconds = v
-		}
+		target.BotMinStarIntervalSeconds = intValue
 	}
+	return nil
 }
 
 func parseBool(value string) (bool, error) {
@@ -135,3 +385,18 @@ func ActiveActivityWindow() time.Duration {
 	}
 	return time.Duration(settings.ActivityWindowSeconds) * time.Second
 }
+
+func settingsSchemaList() []SettingSpec {
+	specs := make([]SettingSpec, 0, len(settingsSchema))
+	for _, spec := range settingsSchema {
+		specs = append(specs, spec)
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Key < specs[j].Key })
+	return specs
+}
+
+func currentSettingsVersion(db *sql.DB) (int64, error) {
+	var version int64
+	err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM global_settings_history`).Scan(&version)
+	return version, err
+}
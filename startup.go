@@ -64,7 +64,7 @@ func ensureAlphaAdmin(ctx context.Context, db *sql.DB) error {
 	adminErr := tx.QueryRowContext(ctx, `
 		SELECT account_id
 		FROM accounts
-		WHERE role IN ('admin', 'frozen:admin')
+		WHERE role = 'admin'
 		LIMIT 1
 		FOR UPDATE
 	`).Scan(&adminAccountID)
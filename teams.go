@@ -0,0 +1,873 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Teams group players for a shared leaderboard only. Team scores are computed
+// by summing each member's own season stars; nothing here moves coins or
+// stars between players, and no endpoint may be added that does.
+const (
+	TeamRoleOwner   = "owner"
+	TeamRoleOfficer = "officer"
+	TeamRoleMember  = "member"
+
+	defaultTeamMaxMembers = 10
+	// teamIPLookback bounds which shared IPs count as the same person when
+	// checking new members against the existing roster.
+	teamIPLookback = 30 * 24 * time.Hour
+)
+
+var teamNamePattern = regexp.MustCompile(`^[A-Za-z0-9 _-]{3,24}$`)
+var teamTagPattern = regexp.MustCompile(`^[A-Z0-9]{2,5}$`)
+
+func teamMaxMembers() int {
+	n := parseEnvInt("TEAM_MAX_MEMBERS", defaultTeamMaxMembers)
+	if n < 2 {
+		return 2
+	}
+	return n
+}
+
+func teamRoleRank(role string) int {
+	switch role {
+	case TeamRoleOwner:
+		return 3
+	case TeamRoleOfficer:
+		return 2
+	case TeamRoleMember:
+		return 1
+	}
+	return 0
+}
+
+type teamMembership struct {
+	TeamID string
+	Role   string
+}
+
+func loadTeamMembership(q interface {
+	QueryRow(string, ...interface{}) *sql.Row
+}, accountID string) (*teamMembership, error) {
+	var membership teamMembership
+	err := q.QueryRow(`
+		SELECT team_id, role FROM team_members WHERE account_id = $1
+	`, accountID).Scan(&membership.TeamID, &membership.Role)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+func logTeamMembership(tx *sql.Tx, teamID string, accountID string, action string, actorAccountID string, details map[string]interface{}) error {
+	var payload interface{}
+	if details != nil {
+		bytes, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+		payload = string(bytes)
+	}
+	_, err := tx.Exec(`
+		INSERT INTO team_membership_log (team_id, account_id, action, actor_account_id, details, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, NOW())
+	`, teamID, accountID, action, actorAccountID, payload)
+	return err
+}
+
+// teamIPConflict reports a current team member who shares a recent IP with
+// the joining player, so one person cannot fill a roster with alts.
+func teamIPConflict(tx *sql.Tx, teamID string, playerID string, now time.Time) (string, bool, error) {
+	var memberAccountID string
+	err := tx.QueryRow(`
+		SELECT tm.account_id
+		FROM team_members tm
+		JOIN accounts a ON a.account_id = tm.account_id
+		JOIN player_ip_associations member_ip ON member_ip.player_id = a.player_id
+		JOIN player_ip_associations joiner_ip ON joiner_ip.ip = member_ip.ip
+		WHERE tm.team_id = $1
+			AND joiner_ip.player_id = $2
+			AND member_ip.last_seen >= $3
+			AND joiner_ip.last_seen >= $3
+		LIMIT 1
+	`, teamID, playerID, now.Add(-teamIPLookback)).Scan(&memberAccountID)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return memberAccountID, true, nil
+}
+
+func writeTeamError(w http.ResponseWriter, code string) {
+	json.NewEncoder(w).Encode(TeamResponse{OK: false, Error: code})
+}
+
+func teamsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		rows, err := db.Query(`
+			SELECT t.team_id, t.name, t.tag, COALESCE(t.description, ''), t.max_members, t.created_at,
+				(SELECT COUNT(*) FROM team_members tm WHERE tm.team_id = t.team_id)
+			FROM teams t
+			WHERE $1 = '' OR t.name ILIKE $2 OR t.tag ILIKE $2
+			ORDER BY t.created_at ASC
+			LIMIT 100
+		`, query, "%"+query+"%")
+		if err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		defer rows.Close()
+		teams := []TeamSummary{}
+		for rows.Next() {
+			var team TeamSummary
+			var createdAt time.Time
+			if err := rows.Scan(&team.TeamID, &team.Name, &team.Tag, &team.Description, &team.MaxMembers, &createdAt, &team.MemberCount); err != nil {
+				continue
+			}
+			team.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+			teams = append(teams, team)
+		}
+		json.NewEncoder(w).Encode(TeamListResponse{OK: true, Teams: teams})
+	}
+}
+
+func teamCreateHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		account, ok := requireSession(db, w, r)
+		if !ok {
+			return
+		}
+		var req TeamRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeTeamError(w, "INVALID_REQUEST")
+			return
+		}
+		name := strings.TrimSpace(req.Name)
+		tag := strings.ToUpper(strings.TrimSpace(req.Tag))
+		description := strings.TrimSpace(req.Description)
+		if !teamNamePattern.MatchString(name) {
+			writeTeamError(w, "INVALID_TEAM_NAME")
+			return
+		}
+		if !teamTagPattern.MatchString(tag) {
+			writeTeamError(w, "INVALID_TEAM_TAG")
+			return
+		}
+		if len(description) > 240 {
+			writeTeamError(w, "INVALID_TEAM_DESCRIPTION")
+			return
+		}
+		teamID, err := randomToken(12)
+		if err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		defer tx.Rollback()
+
+		if membership, err := loadTeamMembership(tx, account.AccountID); err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		} else if membership != nil {
+			writeTeamError(w, "ALREADY_IN_TEAM")
+			return
+		}
+		var exists bool
+		if err := tx.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM teams WHERE LOWER(name) = LOWER($1) OR tag = $2)
+		`, name, tag).Scan(&exists); err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		if exists {
+			writeTeamError(w, "TEAM_NAME_TAKEN")
+			return
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO teams (team_id, name, tag, description, owner_account_id, max_members, created_at)
+			VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, NOW())
+		`, teamID, name, tag, description, account.AccountID, teamMaxMembers()); err != nil {
+			writeTeamError(w, "TEAM_NAME_TAKEN")
+			return
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO team_members (team_id, account_id, role, joined_at)
+			VALUES ($1, $2, $3, NOW())
+		`, teamID, account.AccountID, TeamRoleOwner); err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		if err := logTeamMembership(tx, teamID, account.AccountID, "created", account.AccountID, map[string]interface{}{"name": name, "tag": tag}); err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		json.NewEncoder(w).Encode(TeamResponse{OK: true, TeamID: teamID})
+	}
+}
+
+// teamDetailHandler returns the roster; officers also see pending join
+// requests.
+func teamDetailHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		teamID := strings.TrimSpace(r.URL.Query().Get("teamId"))
+		account := optionalScopedSession(db, r, ScopeReadPlayer)
+		if teamID == "" && account != nil {
+			if membership, err := loadTeamMembership(db, account.AccountID); err == nil && membership != nil {
+				teamID = membership.TeamID
+			}
+		}
+		if teamID == "" {
+			writeTeamError(w, "TEAM_NOT_FOUND")
+			return
+		}
+
+		var team TeamSummary
+		var createdAt time.Time
+		err := db.QueryRow(`
+			SELECT team_id, name, tag, COALESCE(description, ''), max_members, created_at
+			FROM teams WHERE team_id = $1
+		`, teamID).Scan(&team.TeamID, &team.Name, &team.Tag, &team.Description, &team.MaxMembers, &createdAt)
+		if err == sql.ErrNoRows {
+			writeTeamError(w, "TEAM_NOT_FOUND")
+			return
+		}
+		if err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		team.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+
+		rows, err := db.Query(`
+			SELECT tm.account_id, a.player_id, a.username, COALESCE(a.display_name, a.username), tm.role, tm.joined_at, COALESCE(p.stars, 0)
+			FROM team_members tm
+			JOIN accounts a ON a.account_id = tm.account_id
+			LEFT JOIN players p ON p.player_id = a.player_id
+			WHERE tm.team_id = $1
+			ORDER BY tm.joined_at ASC
+		`, teamID)
+		if err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		members := []TeamMemberEntry{}
+		viewerRole := ""
+		for rows.Next() {
+			var member TeamMemberEntry
+			var joinedAt time.Time
+			if err := rows.Scan(&member.AccountID, &member.PlayerID, &member.Username, &member.DisplayName, &member.Role, &joinedAt, &member.Stars); err != nil {
+				continue
+			}
+			member.JoinedAt = joinedAt.UTC().Format(time.RFC3339)
+			if account != nil && member.AccountID == account.AccountID {
+				viewerRole = member.Role
+			}
+			team.Stars += member.Stars
+			members = append(members, member)
+		}
+		rows.Close()
+		team.MemberCount = len(members)
+
+		response := TeamResponse{OK: true, TeamID: teamID, Team: &team, Members: members, Role: viewerRole}
+		if teamRoleRank(viewerRole) >= teamRoleRank(TeamRoleOfficer) {
+			requestRows, err := db.Query(`
+				SELECT r.account_id, a.username, COALESCE(a.display_name, a.username), COALESCE(r.message, ''), r.created_at
+				FROM team_join_requests r
+				JOIN accounts a ON a.account_id = r.account_id
+				WHERE r.team_id = $1 AND r.status = 'pending'
+				ORDER BY r.created_at ASC
+			`, teamID)
+			if err == nil {
+				response.Requests = []TeamJoinRequestEntry{}
+				for requestRows.Next() {
+					var entry TeamJoinRequestEntry
+					var created time.Time
+					if err := requestRows.Scan(&entry.AccountID, &entry.Username, &entry.DisplayName, &entry.Message, &created); err != nil {
+						continue
+					}
+					entry.CreatedAt = created.UTC().Format(time.RFC3339)
+					response.Requests = append(response.Requests, entry)
+				}
+				requestRows.Close()
+			}
+		}
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func teamJoinHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		account, ok := requireSession(db, w, r)
+		if !ok {
+			return
+		}
+		var req TeamRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.TeamID) == "" {
+			writeTeamError(w, "INVALID_REQUEST")
+			return
+		}
+		teamID := strings.TrimSpace(req.TeamID)
+		message := strings.TrimSpace(req.Message)
+		if len(message) > 200 {
+			writeTeamError(w, "INVALID_MESSAGE")
+			return
+		}
+
+		if membership, err := loadTeamMembership(db, account.AccountID); err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		} else if membership != nil {
+			writeTeamError(w, "ALREADY_IN_TEAM")
+			return
+		}
+		var teamName string
+		if err := db.QueryRow(`SELECT name FROM teams WHERE team_id = $1`, teamID).Scan(&teamName); err == sql.ErrNoRows {
+			writeTeamError(w, "TEAM_NOT_FOUND")
+			return
+		} else if err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+
+		if _, err := db.Exec(`
+			INSERT INTO team_join_requests (team_id, account_id, message, status, created_at)
+			VALUES ($1, $2, NULLIF($3, ''), 'pending', NOW())
+			ON CONFLICT (team_id, account_id) DO UPDATE SET
+				message = EXCLUDED.message,
+				status = 'pending',
+				created_at = EXCLUDED.created_at,
+				responded_at = NULL,
+				responded_by = NULL
+			WHERE team_join_requests.status <> 'pending'
+		`, teamID, account.AccountID, message); err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+
+		officers, err := db.Query(`
+			SELECT account_id FROM team_members WHERE team_id = $1 AND role IN ($2, $3)
+		`, teamID, TeamRoleOwner, TeamRoleOfficer)
+		if err == nil {
+			for officers.Next() {
+				var officerID string
+				if err := officers.Scan(&officerID); err != nil {
+					continue
+				}
+				emitNotification(db, NotificationInput{
+					RecipientRole:      NotificationRolePlayer,
+					RecipientAccountID: officerID,
+					Category:           NotificationCategoryPlayerAction,
+					Type:               "team_join_request",
+					Priority:           NotificationPriorityNormal,
+					Message:            account.DisplayName + " asked to join " + teamName + ".",
+					Link:               "#/teams",
+					Payload: map[string]interface{}{
+						"teamId":    teamID,
+						"accountId": account.AccountID,
+					},
+					DedupKey:    "team_join_request:" + teamID + ":" + account.AccountID + ":" + officerID,
+					DedupWindow: time.Hour,
+				})
+			}
+			officers.Close()
+		}
+		json.NewEncoder(w).Encode(TeamResponse{OK: true, TeamID: teamID})
+	}
+}
+
+// teamRequestRespondHandler lets owners and officers accept or decline a
+// pending join request. Acceptance enforces the member limit and the IP
+// association check inside the same transaction.
+func teamRequestRespondHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		account, ok := requireSession(db, w, r)
+		if !ok {
+			return
+		}
+		var req TeamRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.AccountID) == "" {
+			writeTeamError(w, "INVALID_REQUEST")
+			return
+		}
+		applicantID := strings.TrimSpace(req.AccountID)
+		now := time.Now().UTC()
+
+		tx, err := db.Begin()
+		if err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		defer tx.Rollback()
+
+		actor, err := loadTeamMembership(tx, account.AccountID)
+		if err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		if actor == nil || teamRoleRank(actor.Role) < teamRoleRank(TeamRoleOfficer) {
+			writeTeamError(w, "FORBIDDEN")
+			return
+		}
+		teamID := actor.TeamID
+
+		// Lock the team row so concurrent accepts cannot exceed the limit.
+		var maxMembers int
+		var teamName string
+		if err := tx.QueryRow(`SELECT max_members, name FROM teams WHERE team_id = $1 FOR UPDATE`, teamID).Scan(&maxMembers, &teamName); err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+
+		var applicantPlayerID string
+		err = tx.QueryRow(`
+			SELECT a.player_id
+			FROM team_join_requests r
+			JOIN accounts a ON a.account_id = r.account_id
+			WHERE r.team_id = $1 AND r.account_id = $2 AND r.status = 'pending'
+			FOR UPDATE OF r
+		`, teamID, applicantID).Scan(&applicantPlayerID)
+		if err == sql.ErrNoRows {
+			writeTeamError(w, "REQUEST_NOT_FOUND")
+			return
+		}
+		if err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+
+		status := "declined"
+		if req.Accept {
+			if membership, err := loadTeamMembership(tx, applicantID); err != nil {
+				writeTeamError(w, "INTERNAL_ERROR")
+				return
+			} else if membership != nil {
+				writeTeamError(w, "ALREADY_IN_TEAM")
+				return
+			}
+			var memberCount int
+			if err := tx.QueryRow(`SELECT COUNT(*) FROM team_members WHERE team_id = $1`, teamID).Scan(&memberCount); err != nil {
+				writeTeamError(w, "INTERNAL_ERROR")
+				return
+			}
+			if memberCount >= maxMembers {
+				writeTeamError(w, "TEAM_FULL")
+				return
+			}
+			conflictAccountID, conflict, err := teamIPConflict(tx, teamID, applicantPlayerID, now)
+			if err != nil {
+				writeTeamError(w, "INTERNAL_ERROR")
+				return
+			}
+			if conflict {
+				status = "blocked"
+				if err := logTeamMembership(tx, teamID, applicantID, "join_blocked_ip", account.AccountID, map[string]interface{}{
+					"conflictAccountId": conflictAccountID,
+				}); err != nil {
+					writeTeamError(w, "INTERNAL_ERROR")
+					return
+				}
+			} else {
+				if _, err := tx.Exec(`
+					INSERT INTO team_members (team_id, account_id, role, joined_at)
+					VALUES ($1, $2, $3, $4)
+				`, teamID, applicantID, TeamRoleMember, now); err != nil {
+					writeTeamError(w, "ALREADY_IN_TEAM")
+					return
+				}
+				status = "accepted"
+				if err := logTeamMembership(tx, teamID, applicantID, "joined", account.AccountID, nil); err != nil {
+					writeTeamError(w, "INTERNAL_ERROR")
+					return
+				}
+				// Other pending requests from the new member are void now.
+				if _, err := tx.Exec(`
+					UPDATE team_join_requests SET status = 'withdrawn', responded_at = $2
+					WHERE account_id = $1 AND status = 'pending' AND team_id <> $3
+				`, applicantID, now, teamID); err != nil {
+					writeTeamError(w, "INTERNAL_ERROR")
+					return
+				}
+			}
+		}
+
+		if _, err := tx.Exec(`
+			UPDATE team_join_requests
+			SET status = $3, responded_at = $4, responded_by = $5
+			WHERE team_id = $1 AND account_id = $2
+		`, teamID, applicantID, status, now, account.AccountID); err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+
+		if status == "blocked" {
+			writeTeamError(w, "IP_ASSOCIATION_CONFLICT")
+			return
+		}
+		message := "Your request to join " + teamName + " was declined."
+		if status == "accepted" {
+			message = "You joined " + teamName + "."
+		}
+		emitNotification(db, NotificationInput{
+			RecipientRole:      NotificationRolePlayer,
+			RecipientAccountID: applicantID,
+			Category:           NotificationCategoryPlayerAction,
+			Type:               "team_join_" + status,
+			Priority:           NotificationPriorityNormal,
+			Message:            message,
+			Link:               "#/teams",
+			Payload:            map[string]interface{}{"teamId": teamID},
+		})
+		json.NewEncoder(w).Encode(TeamResponse{OK: true, TeamID: teamID, Status: status})
+	}
+}
+
+// teamLeaveHandler removes the caller. An owner must hand over ownership
+// first unless they are the last member, in which case the team disbands.
+func teamLeaveHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		account, ok := requireSession(db, w, r)
+		if !ok {
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		defer tx.Rollback()
+
+		membership, err := loadTeamMembership(tx, account.AccountID)
+		if err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		if membership == nil {
+			writeTeamError(w, "NOT_IN_TEAM")
+			return
+		}
+		if _, err := tx.Exec(`SELECT 1 FROM teams WHERE team_id = $1 FOR UPDATE`, membership.TeamID); err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		var memberCount int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM team_members WHERE team_id = $1`, membership.TeamID).Scan(&memberCount); err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		if membership.Role == TeamRoleOwner && memberCount > 1 {
+			writeTeamError(w, "OWNER_MUST_TRANSFER")
+			return
+		}
+		if _, err := tx.Exec(`DELETE FROM team_members WHERE team_id = $1 AND account_id = $2`, membership.TeamID, account.AccountID); err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		action := "left"
+		if memberCount <= 1 {
+			action = "disbanded"
+		}
+		if err := logTeamMembership(tx, membership.TeamID, account.AccountID, action, account.AccountID, nil); err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		if memberCount <= 1 {
+			// The membership log outlives the team for audit purposes.
+			if _, err := tx.Exec(`DELETE FROM team_join_requests WHERE team_id = $1`, membership.TeamID); err != nil {
+				writeTeamError(w, "INTERNAL_ERROR")
+				return
+			}
+			if _, err := tx.Exec(`DELETE FROM teams WHERE team_id = $1`, membership.TeamID); err != nil {
+				writeTeamError(w, "INTERNAL_ERROR")
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		json.NewEncoder(w).Encode(TeamResponse{OK: true, TeamID: membership.TeamID, Status: action})
+	}
+}
+
+// teamMemberHandler covers kicks and role changes. Officers may kick plain
+// members; only the owner may promote, demote or transfer ownership.
+func teamMemberHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		account, ok := requireSession(db, w, r)
+		if !ok {
+			return
+		}
+		var req TeamRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.AccountID) == "" {
+			writeTeamError(w, "INVALID_REQUEST")
+			return
+		}
+		targetID := strings.TrimSpace(req.AccountID)
+		action := strings.TrimSpace(req.Action)
+		if targetID == account.AccountID {
+			writeTeamError(w, "INVALID_TARGET")
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		defer tx.Rollback()
+
+		actor, err := loadTeamMembership(tx, account.AccountID)
+		if err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		target, err := loadTeamMembership(tx, targetID)
+		if err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		if actor == nil || target == nil || actor.TeamID != target.TeamID {
+			writeTeamError(w, "NOT_FOUND")
+			return
+		}
+		teamID := actor.TeamID
+		if _, err := tx.Exec(`SELECT 1 FROM teams WHERE team_id = $1 FOR UPDATE`, teamID); err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+
+		details := map[string]interface{}{"previousRole": target.Role}
+		switch action {
+		case "kick":
+			if teamRoleRank(actor.Role) < teamRoleRank(TeamRoleOfficer) || teamRoleRank(actor.Role) <= teamRoleRank(target.Role) {
+				writeTeamError(w, "FORBIDDEN")
+				return
+			}
+			if _, err := tx.Exec(`DELETE FROM team_members WHERE team_id = $1 AND account_id = $2`, teamID, targetID); err != nil {
+				writeTeamError(w, "INTERNAL_ERROR")
+				return
+			}
+			action = "kicked"
+		case "promote", "demote", "transfer":
+			if actor.Role != TeamRoleOwner {
+				writeTeamError(w, "FORBIDDEN")
+				return
+			}
+			newRole := TeamRoleOfficer
+			switch action {
+			case "demote":
+				newRole = TeamRoleMember
+			case "transfer":
+				newRole = TeamRoleOwner
+			}
+			if _, err := tx.Exec(`UPDATE team_members SET role = $3 WHERE team_id = $1 AND account_id = $2`, teamID, targetID, newRole); err != nil {
+				writeTeamError(w, "INTERNAL_ERROR")
+				return
+			}
+			if action == "transfer" {
+				if _, err := tx.Exec(`UPDATE team_members SET role = $3 WHERE team_id = $1 AND account_id = $2`, teamID, account.AccountID, TeamRoleOfficer); err != nil {
+					writeTeamError(w, "INTERNAL_ERROR")
+					return
+				}
+				if _, err := tx.Exec(`UPDATE teams SET owner_account_id = $2 WHERE team_id = $1`, teamID, targetID); err != nil {
+					writeTeamError(w, "INTERNAL_ERROR")
+					return
+				}
+			}
+			details["role"] = newRole
+			action = "role_" + action
+		default:
+			writeTeamError(w, "INVALID_ACTION")
+			return
+		}
+		if err := logTeamMembership(tx, teamID, targetID, action, account.AccountID, details); err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		json.NewEncoder(w).Encode(TeamResponse{OK: true, TeamID: teamID, Status: action})
+	}
+}
+
+// teamLogHandler returns the membership change log to current members.
+func teamLogHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		account, ok := requireSession(db, w, r)
+		if !ok {
+			return
+		}
+		membership, err := loadTeamMembership(db, account.AccountID)
+		if err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		if membership == nil {
+			writeTeamError(w, "NOT_IN_TEAM")
+			return
+		}
+		rows, err := db.Query(`
+			SELECT l.account_id, COALESCE(a.username, ''), l.action, COALESCE(l.actor_account_id, ''), COALESCE(l.details::text, ''), l.created_at
+			FROM team_membership_log l
+			LEFT JOIN accounts a ON a.account_id = l.account_id
+			WHERE l.team_id = $1
+			ORDER BY l.created_at DESC, l.id DESC
+			LIMIT 200
+		`, membership.TeamID)
+		if err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		defer rows.Close()
+		entries := []TeamLogEntry{}
+		for rows.Next() {
+			var entry TeamLogEntry
+			var details string
+			var createdAt time.Time
+			if err := rows.Scan(&entry.AccountID, &entry.Username, &entry.Action, &entry.ActorAccountID, &details, &createdAt); err != nil {
+				continue
+			}
+			if details != "" {
+				entry.Details = json.RawMessage(details)
+			}
+			entry.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+			entries = append(entries, entry)
+		}
+		json.NewEncoder(w).Encode(TeamResponse{OK: true, TeamID: membership.TeamID, Log: entries})
+	}
+}
+
+// teamLeaderboardHandler ranks teams by the summed season stars of their
+// current members, read from the materialized player leaderboard.
+func teamLeaderboardHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+		seasonID := strings.TrimSpace(query.Get("seasonId"))
+		if seasonID == "" {
+			seasonID = currentSeasonID()
+		}
+		page := parsePositiveInt(query.Get("page"), 1)
+		pageSize := parsePositiveInt(query.Get("pageSize"), 50)
+		if pageSize > 200 {
+			pageSize = 200
+		}
+
+		// Rosters are rebuilt from team_membership_log as of the season's end
+		// (or now, while it runs), so later signings cannot rewrite a past
+		// season's standings.
+		rows, err := db.Query(`
+			WITH cutoff AS (
+				SELECT COALESCE((SELECT ended_at FROM season_end_snapshots WHERE season_id = $1), NOW()) AS at
+			),
+			last_event AS (
+				SELECT DISTINCT ON (l.account_id) l.account_id, l.team_id, l.action
+				FROM team_membership_log l, cutoff
+				WHERE l.created_at <= cutoff.at
+					AND l.action IN ('created', 'joined', 'left', 'kicked', 'disbanded')
+				ORDER BY l.account_id, l.created_at DESC, l.id DESC
+			),
+			roster AS (
+				SELECT account_id, team_id
+				FROM last_event
+				WHERE action IN ('created', 'joined')
+			),
+			team_stats AS (
+				SELECT
+					t.team_id,
+					t.name,
+					t.tag,
+					t.created_at,
+					COUNT(roster.account_id) AS member_count,
+					COALESCE(SUM(lr.stars), 0) AS stars
+				FROM teams t
+				JOIN roster ON roster.team_id = t.team_id
+				JOIN accounts a ON a.account_id = roster.account_id
+				LEFT JOIN leaderboard_ranks lr ON lr.season_id = $1 AND lr.player_id = a.player_id
+				GROUP BY t.team_id, t.name, t.tag, t.created_at
+			)
+			SELECT
+				ROW_NUMBER() OVER (ORDER BY stars DESC, created_at ASC, team_id ASC) AS rank,
+				team_id, name, tag, member_count, stars,
+				COUNT(*) OVER () AS total
+			FROM team_stats
+			ORDER BY rank
+			LIMIT $2 OFFSET $3
+		`, seasonID, pageSize, (page-1)*pageSize)
+		if err != nil {
+			writeTeamError(w, "INTERNAL_ERROR")
+			return
+		}
+		defer rows.Close()
+		response := TeamLeaderboardResponse{OK: true, SeasonID: seasonID, Page: page, PageSize: pageSize, Results: []TeamLeaderboardEntry{}}
+		for rows.Next() {
+			var entry TeamLeaderboardEntry
+			if err := rows.Scan(&entry.Rank, &entry.TeamID, &entry.Name, &entry.Tag, &entry.MemberCount, &entry.Stars, &response.Total); err != nil {
+				continue
+			}
+			response.Results = append(response.Results, entry)
+		}
+		json.NewEncoder(w).Encode(response)
+	}
+}
@@ -17,7 +17,7 @@ func telemetryHandler(db *sql.DB) http.HandlerFunc {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
-		if !featureFlags.Telemetry {
+		if !currentFeatureFlags().Telemetry {
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
@@ -32,7 +32,7 @@ func telemetryHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		account, _, _ := getSessionAccount(db, r)
+		account := optionalScopedSession(db, r, ScopeReadPlayer)
 		playerID := ""
 		if account != nil {
 			playerID = account.PlayerID
@@ -77,6 +77,7 @@ func startTickLoop(db *sql.DB) {
 					log.Println("Season finalization failed:", err)
 				} else if finalized {
 					log.Println("Season finalized:", currentSeasonID())
+					publishSeasonUpdate()
 					emitNotification(db, NotificationInput{
 						RecipientRole: NotificationRolePlayer,
 						Category:      NotificationCategorySystem,
@@ -101,6 +102,7 @@ func startTickLoop(db *sql.DB) {
 						DedupKey:    "season_end_admin:" + currentSeasonID(),
 						DedupWindow: 6 * time.Hour,
 					})
+					enqueueSeasonSummaryEmails(db, currentSeasonID())
 				}
 				continue
 			}
@@ -149,7 +151,7 @@ func startTickLoop(db *sql.DB) {
 
 			economy.mu.Unlock()
 
-			if featureFlags.Telemetry {
+			if currentFeatureFlags().Telemetry {
 				snapshot := economy.InvariantSnapshot()
 				emitServerTelemetry(db, nil, "", "emission_tick", map[string]interface{}{
 					"seasonId":         currentSeasonID(),
@@ -166,6 +168,8 @@ func startTickLoop(db *sql.DB) {
 			updateMarketPressure(db, now)
 			UpdateAbuseMonitoring(db, now)
 			checkEconomyInvariants(db, "tick")
+			publishEconomyUpdate()
+			requestLeaderboardRefresh()
 
 			tickCount++
 			if tickCount%5 == 0 {
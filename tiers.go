@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Leaderboard tiers are assigned by rank percentile. The same table drives the
+// live tier view and the tier recorded in season_final_rankings at season end,
+// which is what end-of-season rewards are granted from.
+const (
+	TierDiamond  = "diamond"
+	TierPlatinum = "platinum"
+	TierGold     = "gold"
+	TierSilver   = "silver"
+	TierBronze   = "bronze"
+	TierUnranked = "unranked"
+)
+
+type LeaderboardTier struct {
+	Name  string
+	Label string
+	// TopBasisPoints is the inclusive upper bound of the tier as a share of
+	// all ranked players (10000 = 100%); tiers are listed best first. Integer
+	// basis points keep the Go and SQL cutoffs identical.
+	TopBasisPoints int
+}
+
+var leaderboardTiers = []LeaderboardTier{
+	{Name: TierDiamond, Label: "Diamond", TopBasisPoints: 100},
+	{Name: TierPlatinum, Label: "Platinum", TopBasisPoints: 500},
+	{Name: TierGold, Label: "Gold", TopBasisPoints: 1500},
+	{Name: TierSilver, Label: "Silver", TopBasisPoints: 4000},
+	{Name: TierBronze, Label: "Bronze", TopBasisPoints: 10000},
+}
+
+// tierCutoffRank is the worst rank that still belongs to the tier. Rounding up
+// keeps the top tier non-empty on small leaderboards.
+func tierCutoffRank(tier LeaderboardTier, total int) int {
+	if total <= 0 {
+		return 0
+	}
+	return (total*tier.TopBasisPoints + 9999) / 10000
+}
+
+// leaderboardTierForRank returns the tier name for a rank out of total ranked
+// players. Players without stars are unranked and earn no tier reward.
+func leaderboardTierForRank(rank int, total int, stars int64) string {
+	if rank <= 0 || total <= 0 || stars <= 0 {
+		return TierUnranked
+	}
+	for _, tier := range leaderboardTiers {
+		if rank <= tierCutoffRank(tier, total) {
+			return tier.Name
+		}
+	}
+	return TierUnranked
+}
+
+// leaderboardTierSQL renders leaderboardTierForRank as a SQL CASE expression
+// for set-based writes such as season finalization.
+func leaderboardTierSQL(rankExpr string, totalExpr string, starsExpr string) string {
+	var b strings.Builder
+	b.WriteString("CASE WHEN " + starsExpr + " <= 0 THEN '" + TierUnranked + "'")
+	for _, tier := range leaderboardTiers {
+		basisPoints := strconv.Itoa(tier.TopBasisPoints)
+		b.WriteString(" WHEN " + rankExpr + " <= (" + totalExpr + " * " + basisPoints + " + 9999) / 10000 THEN '" + tier.Name + "'")
+	}
+	b.WriteString(" ELSE '" + TierUnranked + "' END")
+	return b.String()
+}
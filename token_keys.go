@@ -0,0 +1,574 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Access tokens are signed with a key from a keyring, and the key's ID (kid)
+// is carried in the token header, so keys can change without logging anyone
+// out. The configured keys are ACCESS_TOKEN_SECRET (kid ACCESS_TOKEN_KID,
+// default "primary") and any verify-only keys in ACCESS_TOKEN_PREVIOUS_KEYS
+// ("kid:secret,kid:secret"). An admin rotation adds a generated key to
+// access_token_keys and makes it the active signing key. The key it replaces
+// stays valid for verification until an admin retires it. Retiring a key
+// rejects every token it signed and signs out every session.
+//
+// Every instance polls access_token_keys, so a rotation or retirement made
+// on one instance reaches the others within tokenKeyringRefreshInterval.
+//
+// Generated secrets are sealed with AES-GCM before they are written, under a
+// key derived from ACCESS_TOKEN_KEYRING_SECRET (or ACCESS_TOKEN_SECRET when
+// that is unset), so a copy of the database alone cannot mint tokens.
+// Rotation and retirement need manage_token_keys and a reason, and
+// retirement goes through the approval queue since it signs everyone out.
+const (
+	TokenKeyActive  = "active"
+	TokenKeyVerify  = "verify"
+	TokenKeyRetired = "retired"
+
+	TokenKeySourceConfig    = "config"
+	TokenKeySourceGenerated = "generated"
+
+	tokenKeyringRefreshInterval = 5 * time.Second
+
+	tokenKeySecretPrefix = "v1:"
+)
+
+type accessTokenKey struct {
+	KID         string
+	secret      []byte
+	Status      string
+	Source      string
+	ActivatedAt *time.Time
+	RetiredAt   *time.Time
+}
+
+type accessTokenKeyring struct {
+	activeKID string
+	keys      map[string]*accessTokenKey
+}
+
+type accessTokenHeader struct {
+	Alg string `json:"alg"`
+	KID string `json:"kid"`
+}
+
+type TokenKeyInfo struct {
+	KID         string     `json:"kid"`
+	Status      string     `json:"status"`
+	Source      string     `json:"source"`
+	ActivatedAt *time.Time `json:"activatedAt,omitempty"`
+	RetiredAt   *time.Time `json:"retiredAt,omitempty"`
+}
+
+type TokenKeysResponse struct {
+	OK            bool                `json:"ok"`
+	Error         string              `json:"error,omitempty"`
+	Keys          []TokenKeyInfo      `json:"keys,omitempty"`
+	PendingAction *PendingAdminAction `json:"pendingAction,omitempty"`
+}
+
+type TokenKeyActionRequest struct {
+	KID    string `json:"kid,omitempty"`
+	Reason string `json:"reason"`
+}
+
+var (
+	tokenKeyringMu sync.RWMutex
+	tokenKeyring   = configTokenKeyring()
+)
+
+func configTokenKID() string {
+	if kid := strings.TrimSpace(os.Getenv("ACCESS_TOKEN_KID")); kid != "" {
+		return kid
+	}
+	return "primary"
+}
+
+// tokenKeyringCipher is the AEAD that seals generated secrets. Its key never
+// touches the database.
+func tokenKeyringCipher() (cipher.AEAD, error) {
+	material := []byte(strings.TrimSpace(os.Getenv("ACCESS_TOKEN_KEYRING_SECRET")))
+	if len(material) == 0 {
+		material = accessTokenSecret()
+	}
+	sum := sha256.Sum256(append([]byte("access-token-keyring:"), material...))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealTokenKeySecret encrypts a generated secret for storage. The kid is
+// bound in as associated data, so a sealed secret cannot be moved to
+// another row.
+func sealTokenKeySecret(kid string, secret string) (string, error) {
+	aead, err := tokenKeyringCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(secret), []byte(kid))
+	return tokenKeySecretPrefix + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// openTokenKeySecret decrypts a stored secret. sealed is false for a
+// plaintext secret written before encryption was added.
+func openTokenKeySecret(kid string, stored string) (secret []byte, sealed bool, err error) {
+	if !strings.HasPrefix(stored, tokenKeySecretPrefix) {
+		return []byte(stored), false, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(stored, tokenKeySecretPrefix))
+	if err != nil {
+		return nil, true, err
+	}
+	aead, err := tokenKeyringCipher()
+	if err != nil {
+		return nil, true, err
+	}
+	if len(raw) < aead.NonceSize() {
+		return nil, true, errors.New("sealed secret too short")
+	}
+	secret, err = aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], []byte(kid))
+	return secret, true, err
+}
+
+// configTokenKeyring builds the keyring from the environment alone.
+func configTokenKeyring() *accessTokenKeyring {
+	ring := &accessTokenKeyring{
+		activeKID: configTokenKID(),
+		keys:      make(map[string]*accessTokenKey),
+	}
+	for _, entry := range strings.Split(os.Getenv("ACCESS_TOKEN_PREVIOUS_KEYS"), ",") {
+		kid, secret, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		kid = strings.TrimSpace(kid)
+		if !ok || kid == "" || strings.TrimSpace(secret) == "" {
+			continue
+		}
+		ring.keys[kid] = &accessTokenKey{
+			KID:    kid,
+			secret: []byte(strings.TrimSpace(secret)),
+			Status: TokenKeyVerify,
+			Source: TokenKeySourceConfig,
+		}
+	}
+	ring.keys[ring.activeKID] = &accessTokenKey{
+		KID:    ring.activeKID,
+		secret: accessTokenSecret(),
+		Status: TokenKeyActive,
+		Source: TokenKeySourceConfig,
+	}
+	return ring
+}
+
+// loadTokenKeyring merges access_token_keys over the configured keys. A
+// generated active key outranks the configured one, which then only
+// verifies; a retired row disables the key whatever its source. A secret
+// that cannot be decrypted (the keyring secret changed) is skipped, and a
+// plaintext one is sealed in place.
+func loadTokenKeyring(db *sql.DB) error {
+	ring := configTokenKeyring()
+	rows, err := db.Query(`
+		SELECT kid, secret, source, status, activated_at, retired_at
+		FROM access_token_keys
+		ORDER BY activated_at ASC NULLS FIRST
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	plaintext := map[string]string{}
+	for rows.Next() {
+		var kid, source, status string
+		var secret sql.NullString
+		var activatedAt, retiredAt sql.NullTime
+		if err := rows.Scan(&kid, &secret, &source, &status, &activatedAt, &retiredAt); err != nil {
+			return err
+		}
+		key := ring.keys[kid]
+		if key == nil {
+			if !secret.Valid || secret.String == "" {
+				// A retired configured key that is no longer configured.
+				key = &accessTokenKey{KID: kid, Source: source}
+			} else {
+				opened, sealed, err := openTokenKeySecret(kid, secret.String)
+				if err != nil {
+					log.Println("token keyring: cannot decrypt key", kid, "- check ACCESS_TOKEN_KEYRING_SECRET:", err)
+					continue
+				}
+				if !sealed {
+					plaintext[kid] = secret.String
+				}
+				key = &accessTokenKey{KID: kid, secret: opened, Source: source}
+			}
+			ring.keys[kid] = key
+		}
+		key.Status = status
+		if activatedAt.Valid {
+			at := activatedAt.Time
+			key.ActivatedAt = &at
+		}
+		if retiredAt.Valid {
+			at := retiredAt.Time
+			key.RetiredAt = &at
+		}
+		if status == TokenKeyActive {
+			ring.activeKID = kid
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for kid, key := range ring.keys {
+		if kid != ring.activeKID && key.Status == TokenKeyActive {
+			key.Status = TokenKeyVerify
+		}
+	}
+
+	tokenKeyringMu.Lock()
+	tokenKeyring = ring
+	tokenKeyringMu.Unlock()
+
+	for kid, secret := range plaintext {
+		sealed, err := sealTokenKeySecret(kid, secret)
+		if err != nil {
+			log.Println("token keyring: seal failed for", kid, ":", err)
+			continue
+		}
+		if _, err := db.Exec(`
+			UPDATE access_token_keys SET secret = $3 WHERE kid = $1 AND secret = $2
+		`, kid, secret, sealed); err != nil {
+			log.Println("token keyring: seal failed for", kid, ":", err)
+		}
+	}
+	return nil
+}
+
+func startTokenKeyringRefresher(db *sql.DB) {
+	if err := loadTokenKeyring(db); err != nil {
+		log.Println("token keyring load failed:", err)
+	}
+	go func() {
+		ticker := time.NewTicker(tokenKeyringRefreshInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := loadTokenKeyring(db); err != nil {
+				log.Println("token keyring refresh failed:", err)
+			}
+		}
+	}()
+}
+
+// activeTokenKey returns the signing key, or nil if it has been retired
+// without a replacement.
+func activeTokenKey() *accessTokenKey {
+	tokenKeyringMu.RLock()
+	defer tokenKeyringMu.RUnlock()
+	key := tokenKeyring.keys[tokenKeyring.activeKID]
+	if key == nil || key.Status != TokenKeyActive || len(key.secret) == 0 {
+		return nil
+	}
+	return key
+}
+
+// verificationTokenKey returns the secret for kid if it may still verify.
+func verificationTokenKey(kid string) []byte {
+	tokenKeyringMu.RLock()
+	defer tokenKeyringMu.RUnlock()
+	key := tokenKeyring.keys[kid]
+	if key == nil || key.Status == TokenKeyRetired || len(key.secret) == 0 {
+		return nil
+	}
+	return key.secret
+}
+
+func signAccessToken(payload string) (string, error) {
+	key := activeTokenKey()
+	if key == nil {
+		return "", errors.New("NO_ACTIVE_KEY")
+	}
+	header, err := json.Marshal(accessTokenHeader{Alg: "HS256", KID: key.KID})
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString([]byte(payload))
+	mac := hmac.New(sha256.New, key.secret)
+	mac.Write([]byte(signed))
+	return signed + "." + hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// openAccessToken checks a token's signature and returns its payload.
+// Tokens from before key IDs existed had no header; they also carry no
+// session and are refused.
+func openAccessToken(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errors.New("INVALID_TOKEN")
+	}
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", errors.New("INVALID_TOKEN")
+	}
+	var header accessTokenHeader
+	if err := json.Unmarshal(headerBytes, &header); err != nil || header.Alg != "HS256" || header.KID == "" {
+		return "", errors.New("INVALID_TOKEN")
+	}
+	kid, signed, encodedPayload, sig := header.KID, parts[0]+"."+parts[1], parts[1], parts[2]
+
+	secret := verificationTokenKey(kid)
+	if secret == nil {
+		return "", errors.New("INVALID_TOKEN")
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if subtle.ConstantTimeCompare([]byte(sig), []byte(expected)) != 1 {
+		return "", errors.New("INVALID_TOKEN")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return "", errors.New("INVALID_TOKEN")
+	}
+	return string(payload), nil
+}
+
+func listTokenKeys() []TokenKeyInfo {
+	tokenKeyringMu.RLock()
+	defer tokenKeyringMu.RUnlock()
+	keys := make([]TokenKeyInfo, 0, len(tokenKeyring.keys))
+	for _, key := range tokenKeyring.keys {
+		keys = append(keys, TokenKeyInfo{
+			KID:         key.KID,
+			Status:      key.Status,
+			Source:      key.Source,
+			ActivatedAt: key.ActivatedAt,
+			RetiredAt:   key.RetiredAt,
+		})
+	}
+	statusOrder := map[string]int{TokenKeyActive: 0, TokenKeyVerify: 1, TokenKeyRetired: 2}
+	sort.Slice(keys, func(i, j int) bool {
+		if statusOrder[keys[i].Status] != statusOrder[keys[j].Status] {
+			return statusOrder[keys[i].Status] < statusOrder[keys[j].Status]
+		}
+		return keys[i].KID < keys[j].KID
+	})
+	return keys
+}
+
+// rotateTokenKey generates a new signing key. The previous active key keeps
+// verifying until it is retired.
+func rotateTokenKey(db *sql.DB, actorAccountID string) (string, error) {
+	suffix, err := randomToken(6)
+	if err != nil {
+		return "", err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	kid := "k" + time.Now().UTC().Format("20060102") + "-" + suffix
+	sealed, err := sealTokenKeySecret(kid, secret)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`
+		UPDATE access_token_keys
+		SET status = $1
+		WHERE status = $2
+	`, TokenKeyVerify, TokenKeyActive); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO access_token_keys (kid, secret, source, status, created_by, created_at, activated_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NOW(), NOW())
+	`, kid, sealed, TokenKeySourceGenerated, TokenKeyActive, actorAccountID); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return kid, loadTokenKeyring(db)
+}
+
+// checkTokenKeyRetirable returns the key's source, or an error code if kid
+// cannot be retired. The active key cannot be retired; rotate first.
+func checkTokenKeyRetirable(kid string) (string, string) {
+	tokenKeyringMu.RLock()
+	defer tokenKeyringMu.RUnlock()
+	key := tokenKeyring.keys[kid]
+	if key == nil {
+		return "", "NOT_FOUND"
+	}
+	if key.Status == TokenKeyRetired {
+		return "", "ALREADY_RETIRED"
+	}
+	if kid == tokenKeyring.activeKID {
+		return "", "KEY_ACTIVE"
+	}
+	return key.Source, ""
+}
+
+// retireTokenKey stops kid from verifying and signs out every session, since
+// any of them may hold tokens it signed.
+func retireTokenKey(db *sql.DB, kid string) (int64, error) {
+	source, code := checkTokenKeyRetirable(kid)
+	if code != "" {
+		return 0, errors.New(code)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	// The secret is dropped: a retired key never verifies again.
+	if _, err := tx.Exec(`
+		INSERT INTO access_token_keys (kid, secret, source, status, created_at, retired_at)
+		VALUES ($1, NULL, $2, $3, NOW(), NOW())
+		ON CONFLICT (kid) DO UPDATE SET secret = NULL, status = EXCLUDED.status, retired_at = EXCLUDED.retired_at
+	`, kid, source, TokenKeyRetired); err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec(`DELETE FROM sessions`)
+	if err != nil {
+		return 0, err
+	}
+	signedOut, _ := res.RowsAffected()
+	if _, err := tx.Exec(`UPDATE refresh_tokens SET revoked_at = NOW() WHERE revoked_at IS NULL`); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return signedOut, loadTokenKeyring(db)
+}
+
+func adminTokenKeysHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if _, ok := requirePermission(db, w, r, PermViewSettings); !ok {
+			return
+		}
+		json.NewEncoder(w).Encode(TokenKeysResponse{OK: true, Keys: listTokenKeys()})
+	}
+}
+
+func adminTokenKeyRotateHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		admin, ok := requirePermission(db, w, r, PermManageTokenKeys)
+		if !ok {
+			return
+		}
+		var req TokenKeyActionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			json.NewEncoder(w).Encode(TokenKeysResponse{OK: false, Error: "INVALID_REQUEST"})
+			return
+		}
+		reason := strings.TrimSpace(req.Reason)
+		if reason == "" {
+			json.NewEncoder(w).Encode(TokenKeysResponse{OK: false, Error: "REASON_REQUIRED"})
+			return
+		}
+		previous := ""
+		if key := activeTokenKey(); key != nil {
+			previous = key.KID
+		}
+		kid, err := rotateTokenKey(db, admin.AccountID)
+		if err != nil {
+			log.Println("token key rotate: error:", err)
+			json.NewEncoder(w).Encode(TokenKeysResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		_ = logAdminAction(db, admin.AccountID, "token_key_rotate", "token_key", kid, reason, map[string]interface{}{
+			"previousKid": previous,
+		})
+		json.NewEncoder(w).Encode(TokenKeysResponse{OK: true, Keys: listTokenKeys()})
+	}
+}
+
+func adminTokenKeyRetireHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		admin, ok := requirePermission(db, w, r, PermManageTokenKeys)
+		if !ok {
+			return
+		}
+		var req TokenKeyActionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.KID) == "" {
+			json.NewEncoder(w).Encode(TokenKeysResponse{OK: false, Error: "INVALID_REQUEST"})
+			return
+		}
+		reason := strings.TrimSpace(req.Reason)
+		if reason == "" {
+			json.NewEncoder(w).Encode(TokenKeysResponse{OK: false, Error: "REASON_REQUIRED"})
+			return
+		}
+		kid := strings.TrimSpace(req.KID)
+		if _, code := checkTokenKeyRetirable(kid); code != "" {
+			json.NewEncoder(w).Encode(TokenKeysResponse{OK: false, Error: code})
+			return
+		}
+		pending, errCode := submitAdminAction(db, admin.AccountID, PendingActionTokenKeyRetire, map[string]interface{}{
+			"kid": kid,
+		}, reason)
+		if errCode != "" {
+			json.NewEncoder(w).Encode(TokenKeysResponse{OK: false, Error: errCode})
+			return
+		}
+		json.NewEncoder(w).Encode(TokenKeysResponse{OK: true, Keys: listTokenKeys(), PendingAction: pending})
+	}
+}
+
+func executeTokenKeyRetire(db *sql.DB, action PendingAdminAction) string {
+	kid := pendingPayloadString(action.Payload, "kid")
+	signedOut, err := retireTokenKey(db, kid)
+	if err != nil {
+		switch err.Error() {
+		case "NOT_FOUND", "ALREADY_RETIRED", "KEY_ACTIVE":
+			return err.Error()
+		}
+		log.Println("token key retire: error:", err)
+		return "INTERNAL_ERROR"
+	}
+	_ = logAdminAction(db, action.RequestedBy, "token_key_retire", "token_key", kid, action.Reason, pendingActionAuditDetails(action, map[string]interface{}{
+		"sessionsSignedOut": signedOut,
+	}))
+	return ""
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Two-factor authentication uses RFC 6238 TOTP: HMAC-SHA1, six digits and
+// 30 second steps, the defaults every authenticator app understands.
+// Enrollment stores a pending secret until the player proves it with a code.
+// Recovery codes are stored hashed and each works once. Secrets are sealed
+// with the token keyring cipher (see token_keys.go) before they are written.
+const (
+	totpIssuer        = "Too Many Coins"
+	totpDigits        = 6
+	totpPeriodSeconds = 30
+	totpSkewSteps     = 1
+	totpSecretBytes   = 20
+
+	recoveryCodeCount = 10
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// adminTwoFactorRequired keeps admin access behind 2FA. Local setups can turn
+// it off with ADMIN_2FA_REQUIRED=false.
+func adminTwoFactorRequired() bool {
+	raw := strings.ToLower(strings.TrimSpace(os.Getenv("ADMIN_2FA_REQUIRED")))
+	return raw != "false" && raw != "0" && raw != "no"
+}
+
+// twoFactorRequiredFor reports whether policy forces 2FA on the account:
+// admins, moderators and anyone holding an admin permission.
+func twoFactorRequiredFor(account *Account, permissions []string) bool {
+	if account == nil || !adminTwoFactorRequired() {
+		return false
+	}
+	return account.Role == "admin" || account.Role == "moderator" || len(permissions) > 0
+}
+
+func generateTOTPSecret() (string, error) {
+	buf := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+func totpProvisioningURI(username string, secret string) string {
+	label := url.PathEscape(totpIssuer + ":" + username)
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", totpIssuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", strconv.Itoa(totpDigits))
+	query.Set("period", strconv.Itoa(totpPeriodSeconds))
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+func totpCodeAt(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	code := strconv.FormatUint(uint64(value%1000000), 10)
+	for len(code) < totpDigits {
+		code = "0" + code
+	}
+	return code, nil
+}
+
+// sealTOTPSecret encrypts a TOTP secret for storage. The pending and the
+// active secret share the account's associated data, so confirming can move
+// one into the other without opening it.
+func sealTOTPSecret(accountID string, secret string) (string, error) {
+	return sealTokenKeySecret("totp:"+accountID, secret)
+}
+
+// openTOTPSecret decrypts a stored TOTP secret. A plaintext secret written
+// before encryption was added passes through.
+func openTOTPSecret(accountID string, stored string) (string, error) {
+	secret, _, err := openTokenKeySecret("totp:"+accountID, stored)
+	return string(secret), err
+}
+
+// sealLegacyTOTPSecrets encrypts TOTP secrets still stored in plaintext.
+func sealLegacyTOTPSecrets(db *sql.DB) {
+	rows, err := db.Query(`
+		SELECT account_id, totp_secret, totp_pending_secret
+		FROM accounts
+		WHERE totp_secret NOT LIKE $1 OR totp_pending_secret NOT LIKE $1
+	`, tokenKeySecretPrefix+"%")
+	if err != nil {
+		log.Println("totp: legacy secret scan failed:", err)
+		return
+	}
+	type legacySecrets struct {
+		accountID string
+		active    sql.NullString
+		pending   sql.NullString
+	}
+	var legacy []legacySecrets
+	for rows.Next() {
+		var entry legacySecrets
+		if err := rows.Scan(&entry.accountID, &entry.active, &entry.pending); err != nil {
+			log.Println("totp: legacy secret scan failed:", err)
+			rows.Close()
+			return
+		}
+		legacy = append(legacy, entry)
+	}
+	rows.Close()
+
+	for _, entry := range legacy {
+		for column, secret := range map[string]sql.NullString{"totp_secret": entry.active, "totp_pending_secret": entry.pending} {
+			if !secret.Valid || secret.String == "" || strings.HasPrefix(secret.String, tokenKeySecretPrefix) {
+				continue
+			}
+			sealed, err := sealTOTPSecret(entry.accountID, secret.String)
+			if err != nil {
+				log.Println("totp: seal failed for", entry.accountID, ":", err)
+				continue
+			}
+			if _, err := db.Exec(`
+				UPDATE accounts SET `+column+` = $3 WHERE account_id = $1 AND `+column+` = $2
+			`, entry.accountID, secret.String, sealed); err != nil {
+				log.Println("totp: seal failed for", entry.accountID, ":", err)
+			}
+		}
+	}
+}
+
+// matchTOTP returns the time step a code belongs to, allowing one step of
+// clock drift either way. Steps at or before lastStep were already used.
+func matchTOTP(secret string, code string, now time.Time, lastStep int64) (int64, bool) {
+	code = normalizeOneTimeCode(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriodSeconds
+	for delta := int64(-totpSkewSteps); delta <= totpSkewSteps; delta++ {
+		step := current + delta
+		if step <= lastStep {
+			continue
+		}
+		expected, err := totpCodeAt(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func normalizeOneTimeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+}
+
+func generateRecoveryCodes() ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(totpEncoding.EncodeToString(buf))
+		codes = append(codes, raw[:4]+"-"+raw[4:])
+	}
+	return codes, nil
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, accountID string, codes []string) error {
+	if _, err := tx.Exec(`DELETE FROM account_recovery_codes WHERE account_id = $1`, accountID); err != nil {
+		return err
+	}
+	for _, code := range codes {
+		if _, err := tx.Exec(`
+			INSERT INTO account_recovery_codes (account_id, code_hash, created_at)
+			VALUES ($1, $2, NOW())
+		`, accountID, hashToken(normalizeOneTimeCode(code))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifySecondFactor checks a TOTP code or, failing that, burns a recovery
+// code. It returns TOTP_REQUIRED when neither was supplied.
+func verifySecondFactor(db *sql.DB, accountID string, code string, recoveryCode string) error {
+	code = strings.TrimSpace(code)
+	recoveryCode = strings.TrimSpace(recoveryCode)
+	if code == "" && recoveryCode == "" {
+		return errors.New("TOTP_REQUIRED")
+	}
+	if code != "" {
+		var secret sql.NullString
+		var lastStep int64
+		if err := db.QueryRow(`
+			SELECT totp_secret, totp_last_step
+			FROM accounts
+			WHERE account_id = $1 AND totp_enabled_at IS NOT NULL
+		`, accountID).Scan(&secret, &lastStep); err != nil || !secret.Valid {
+			return errors.New("INVALID_TOTP_CODE")
+		}
+		opened, err := openTOTPSecret(accountID, secret.String)
+		if err != nil {
+			log.Println("totp: cannot decrypt secret for", accountID, "- check ACCESS_TOKEN_KEYRING_SECRET:", err)
+			return errors.New("INVALID_TOTP_CODE")
+		}
+		step, ok := matchTOTP(opened, code, time.Now().UTC(), lastStep)
+		if !ok {
+			return errors.New("INVALID_TOTP_CODE")
+		}
+		// Recording the step stops the same code being replayed.
+		result, err := db.Exec(`
+			UPDATE accounts
+			SET totp_last_step = $2
+			WHERE account_id = $1 AND totp_last_step < $2
+		`, accountID, step)
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected != 1 {
+			return errors.New("INVALID_TOTP_CODE")
+		}
+		return nil
+	}
+	result, err := db.Exec(`
+		UPDATE account_recovery_codes
+		SET used_at = NOW()
+		WHERE account_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, accountID, hashToken(normalizeOneTimeCode(recoveryCode)))
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected != 1 {
+		return errors.New("INVALID_RECOVERY_CODE")
+	}
+	return nil
+}
+
+type TwoFactorRequest struct {
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recoveryCode,omitempty"`
+	Password     string `json:"password,omitempty"`
+}
+
+type TwoFactorResponse struct {
+	OK                     bool     `json:"ok"`
+	Error                  string   `json:"error,omitempty"`
+	Enabled                bool     `json:"enabled"`
+	Required               bool     `json:"required"`
+	Secret                 string   `json:"secret,omitempty"`
+	ProvisioningURI        string   `json:"provisioningUri,omitempty"`
+	RecoveryCodes          []string `json:"recoveryCodes,omitempty"`
+	RecoveryCodesRemaining int      `json:"recoveryCodesRemaining"`
+}
+
+func twoFactorStatus(db *sql.DB, account *Account) TwoFactorResponse {
+	resp := TwoFactorResponse{
+		OK:       true,
+		Enabled:  account.TwoFactorEnabled,
+		Required: twoFactorRequiredFor(account, accountPermissions(db, account)),
+	}
+	_ = db.QueryRow(`
+		SELECT COUNT(*) FROM account_recovery_codes
+		WHERE account_id = $1 AND used_at IS NULL
+	`, account.AccountID).Scan(&resp.RecoveryCodesRemaining)
+	return resp
+}
+
+func twoFactorStatusHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		account, ok := requireSession(db, w, r)
+		if !ok {
+			return
+		}
+		json.NewEncoder(w).Encode(twoFactorStatus(db, account))
+	}
+}
+
+func twoFactorEnrollHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		account, ok := requireSession(db, w, r)
+		if !ok {
+			return
+		}
+		if account.TwoFactorEnabled {
+			json.NewEncoder(w).Encode(TwoFactorResponse{OK: false, Error: "TWO_FACTOR_ALREADY_ENABLED", Enabled: true})
+			return
+		}
+		secret, err := generateTOTPSecret()
+		if err != nil {
+			json.NewEncoder(w).Encode(TwoFactorResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		sealed, err := sealTOTPSecret(account.AccountID, secret)
+		if err != nil {
+			json.NewEncoder(w).Encode(TwoFactorResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if _, err := db.Exec(`UPDATE accounts SET totp_pending_secret = $2 WHERE account_id = $1`, account.AccountID, sealed); err != nil {
+			json.NewEncoder(w).Encode(TwoFactorResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		json.NewEncoder(w).Encode(TwoFactorResponse{
+			OK:              true,
+			Secret:          secret,
+			ProvisioningURI: totpProvisioningURI(account.Username, secret),
+		})
+	}
+}
+
+func twoFactorConfirmHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		account, ok := requireSession(db, w, r)
+		if !ok {
+			return
+		}
+		var req TwoFactorRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			json.NewEncoder(w).Encode(TwoFactorResponse{OK: false, Error: "INVALID_REQUEST"})
+			return
+		}
+		var pending sql.NullString
+		if err := db.QueryRow(`SELECT totp_pending_secret FROM accounts WHERE account_id = $1`, account.AccountID).Scan(&pending); err != nil {
+			json.NewEncoder(w).Encode(TwoFactorResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if !pending.Valid || pending.String == "" {
+			json.NewEncoder(w).Encode(TwoFactorResponse{OK: false, Error: "NO_PENDING_ENROLLMENT"})
+			return
+		}
+		pendingSecret, err := openTOTPSecret(account.AccountID, pending.String)
+		if err != nil {
+			log.Println("totp: cannot decrypt pending secret for", account.AccountID, ":", err)
+			json.NewEncoder(w).Encode(TwoFactorResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		step, matched := matchTOTP(pendingSecret, req.Code, time.Now().UTC(), 0)
+		if !matched {
+			json.NewEncoder(w).Encode(TwoFactorResponse{OK: false, Error: "INVALID_TOTP_CODE"})
+			return
+		}
+		codes, err := generateRecoveryCodes()
+		if err != nil {
+			json.NewEncoder(w).Encode(TwoFactorResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			json.NewEncoder(w).Encode(TwoFactorResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec(`
+			UPDATE accounts
+			SET totp_secret = totp_pending_secret,
+				totp_pending_secret = NULL,
+				totp_enabled_at = NOW(),
+				totp_last_step = $2
+			WHERE account_id = $1
+		`, account.AccountID, step); err != nil {
+			json.NewEncoder(w).Encode(TwoFactorResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if err := replaceRecoveryCodes(tx, account.AccountID, codes); err != nil {
+			json.NewEncoder(w).Encode(TwoFactorResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			json.NewEncoder(w).Encode(TwoFactorResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+
+		// Recovery codes are only ever shown here.
+		json.NewEncoder(w).Encode(TwoFactorResponse{
+			OK:                     true,
+			Enabled:                true,
+			Required:               twoFactorRequiredFor(account, accountPermissions(db, account)),
+			RecoveryCodes:          codes,
+			RecoveryCodesRemaining: len(codes),
+		})
+	}
+}
+
+// twoFactorDisableHandler asks for the password and a current second factor
+// again, so a stolen session alone cannot strip 2FA.
+func twoFactorDisableHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		account, ok := requireSession(db, w, r)
+		if !ok {
+			return
+		}
+		if !account.TwoFactorEnabled {
+			json.NewEncoder(w).Encode(TwoFactorResponse{OK: false, Error: "TWO_FACTOR_NOT_ENABLED"})
+			return
+		}
+		var req TwoFactorRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			json.NewEncoder(w).Encode(TwoFactorResponse{OK: false, Error: "INVALID_REQUEST"})
+			return
+		}
+		limit, window := authRateLimitConfig("two_factor_disable")
+		allowed, retryAfter, err := checkAuthRateLimit(db, getClientIP(r), "two_factor_disable", limit, window)
+		if err != nil {
+			json.NewEncoder(w).Encode(TwoFactorResponse{OK: false, Error: "INTERNAL_ERROR", Enabled: true})
+			return
+		}
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(TwoFactorResponse{OK: false, Error: "RATE_LIMIT", Enabled: true})
+			return
+		}
+		if code, lockFor := verifyReauthentication(db, account, r, req.Password, req.Code, req.RecoveryCode); code != "" {
+			if lockFor > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(lockFor.Seconds())+1))
+				w.WriteHeader(http.StatusTooManyRequests)
+			}
+			json.NewEncoder(w).Encode(TwoFactorResponse{OK: false, Error: code, Enabled: true})
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			json.NewEncoder(w).Encode(TwoFactorResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec(`
+			UPDATE accounts
+			SET totp_secret = NULL,
+				totp_pending_secret = NULL,
+				totp_enabled_at = NULL,
+				totp_last_step = 0
+			WHERE account_id = $1
+		`, account.AccountID); err != nil {
+			json.NewEncoder(w).Encode(TwoFactorResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if err := replaceRecoveryCodes(tx, account.AccountID, nil); err != nil {
+			json.NewEncoder(w).Encode(TwoFactorResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			json.NewEncoder(w).Encode(TwoFactorResponse{OK: false, Error: "INTERNAL_ERROR"})
+			return
+		}
+		account.TwoFactorEnabled = false
+		json.NewEncoder(w).Encode(twoFactorStatus(db, account))
+	}
+}
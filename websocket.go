@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Minimal RFC 6455 server side: enough for JSON text messages, ping/pong and
+// close. Extensions and subprotocols are not negotiated.
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+
+	wsMaxMessageBytes = 64 * 1024
+	wsHandshakeGUID   = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+var (
+	errWebSocketClosed   = errors.New("websocket closed")
+	errWebSocketTooLarge = errors.New("websocket message too large")
+	errWebSocketProtocol = errors.New("websocket protocol error")
+)
+
+type wsConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writeMu sync.Mutex
+}
+
+func headerContainsToken(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameOriginRequest rejects cross-site sockets; browsers attach cookies to
+// WebSocket handshakes, so the Origin check stands in for CSRF protection.
+func sameOriginRequest(r *http.Request) bool {
+	origin := strings.TrimSpace(r.Header.Get("Origin"))
+	if origin == "" {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(parsed.Host, r.Host)
+}
+
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if r.Method != http.MethodGet ||
+		!headerContainsToken(r.Header, "Connection", "upgrade") ||
+		!headerContainsToken(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" {
+		http.Error(w, "WebSocket upgrade required", http.StatusBadRequest)
+		return nil, errWebSocketProtocol
+	}
+	key := strings.TrimSpace(r.Header.Get("Sec-WebSocket-Key"))
+	if key == "" {
+		http.Error(w, "Missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errWebSocketProtocol
+	}
+	if !sameOriginRequest(r) {
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return nil, errWebSocketProtocol
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket unsupported", http.StatusInternalServerError)
+		return nil, errWebSocketProtocol
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum([]byte(key + wsHandshakeGUID))
+	accept := base64.StdEncoding.EncodeToString(sum[:])
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + accept + "\r\n\r\n"
+	if _, err := rw.WriteString(response); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if err := rw.Flush(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return &wsConn{conn: conn, reader: rw.Reader}, nil
+}
+
+func (c *wsConn) readFrame() (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, errWebSocketProtocol
+	}
+	opcode := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	if !masked {
+		// Clients must mask every frame.
+		return false, 0, nil, errWebSocketProtocol
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > wsMaxMessageBytes {
+		return false, 0, nil, errWebSocketTooLarge
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// ReadMessage returns the next complete text or binary message, answering
+// pings and reassembling fragments along the way.
+func (c *wsConn) ReadMessage() (byte, []byte, error) {
+	var messageOp byte
+	var message []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch opcode {
+		case wsOpPing:
+			if err := c.WriteMessage(wsOpPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			_ = c.WriteMessage(wsOpClose, payload)
+			return 0, nil, errWebSocketClosed
+		case wsOpText, wsOpBinary:
+			if message != nil {
+				return 0, nil, errWebSocketProtocol
+			}
+			messageOp = opcode
+			message = payload
+		case wsOpContinuation:
+			if message == nil {
+				return 0, nil, errWebSocketProtocol
+			}
+			if len(message)+len(payload) > wsMaxMessageBytes {
+				return 0, nil, errWebSocketTooLarge
+			}
+			message = append(message, payload...)
+		default:
+			return 0, nil, errWebSocketProtocol
+		}
+		if fin {
+			return messageOp, message, nil
+		}
+	}
+}
+
+func (c *wsConn) WriteMessage(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	header := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		header = append(header, byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(len(payload)))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(len(payload)))
+	}
+	_ = c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := c.conn.Write(header); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(payload)
+	return err
+}
+
+func (c *wsConn) WriteJSON(value interface{}) error {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(wsOpText, payload)
+}
+
+func (c *wsConn) Close() error {
+	_ = c.WriteMessage(wsOpClose, []byte{0x03, 0xE8})
+	return c.conn.Close()
+}
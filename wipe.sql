@@ -37,14 +37,40 @@ TRUNCATE star_purchase_log RESTART IDENTITY;
 -- Season archives / leaderboards / economy state
 TRUNCATE season_calibration;
 TRUNCATE season_final_rankings;
+TRUNCATE leaderboard_ranks;
+TRUNCATE leaderboard_rank_history RESTART IDENTITY;
 TRUNCATE season_end_snapshots;
 TRUNCATE season_economy;
+TRUNCATE season_controls;
+
+-- Social graph
+TRUNCATE friendships;
+TRUNCATE team_membership_log RESTART IDENTITY;
+TRUNCATE team_join_requests;
+TRUNCATE team_members;
+TRUNCATE teams;
 
 -- Accounts and players (including bots)
+TRUNCATE account_permissions;
+TRUNCATE account_recovery_codes;
+TRUNCATE account_devices;
+TRUNCATE email_verifications;
+TRUNCATE api_tokens;
+TRUNCATE account_deletions RESTART IDENTITY;
+TRUNCATE account_login_failures;
+TRUNCATE account_login_ranges;
 TRUNCATE accounts;
 TRUNCATE players;
 
 -- Global settings (including alpha/test/playtest flags)
 TRUNCATE global_settings;
+TRUNCATE global_settings_history RESTART IDENTITY;
+TRUNCATE feature_flags;
+TRUNCATE role_permissions;
+TRUNCATE permissions;
+TRUNCATE admin_pending_actions RESTART IDENTITY;
+TRUNCATE mail_outbox RESTART IDENTITY;
+TRUNCATE pow_redemptions;
+TRUNCATE access_token_keys;
 
 COMMIT;